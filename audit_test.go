@@ -0,0 +1,41 @@
+package gcplog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func ExampleLogger_Audit() {
+	logger := New(INFO)
+	logger.WithLabel("team", "payments").Audit("refund approved")
+	// Output:
+	// {"severity":"NOTICE","message":"refund approved","logging.googleapis.com/labels":{"audit":"true","team":"payments"}}
+}
+
+func TestAudit(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(DEBUG)
+	logger.out = &buf
+	logger.Audit("user ", 42, " signed in")
+	logger.Auditf("user %d signed out", 42)
+	logger.Print("not audited")
+	want := `{"severity":"NOTICE","message":"user 42 signed in","logging.googleapis.com/labels":{"audit":"true"}}` + "\n" +
+		`{"severity":"NOTICE","message":"user 42 signed out","logging.googleapis.com/labels":{"audit":"true"}}` + "\n" +
+		`{"severity":"DEBUG","message":"not audited"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestAuditReplacesLabel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithLabel(auditLabel, "false")
+	logger.out = &buf
+	logger.Audit("x")
+	logger.Print("y")
+	want := `{"severity":"NOTICE","message":"x","logging.googleapis.com/labels":{"audit":"true"}}` + "\n" +
+		`{"severity":"INFO","message":"y","logging.googleapis.com/labels":{"audit":"false"}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
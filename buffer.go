@@ -0,0 +1,248 @@
+package gcplog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// buffer holds encoded log entries in memory until they're flushed to the underlying io.Writer.
+type buffer struct {
+	mu         sync.Mutex
+	w          io.Writer
+	size       int    // the number of bytes to hold before flushing
+	flushAbove string // entries at or above this severity are flushed immediately
+	data       []byte
+	ends       []int // the offset in data of the end of each entry
+	closed     bool  // when true, entries are written straight through, for Loggers which still share the buffer after Close
+}
+
+// flushChunk is roughly how many bytes FlushContext writes at a time, between checking whether its context is done.
+const flushChunk = 32 * 1024
+
+// SetBuffered turns on buffered mode, where log entries are held in memory and written in batches.
+//
+// Entries are flushed once the buffer holds at least size bytes, when an entry at or above the flushAbove severity is written,
+// or when Flush is called. So with a flushAbove of ERROR, errors appear straight away but lower severities are batched.
+// If flushAbove is not a valid severity, then ERROR is used.
+//
+// Loggers created from this one with methods like With share the same buffer, so calling SetBuffered again
+// changes the size and flushAbove severity for all of them.
+// A size of zero or less turns buffered mode off again, for all of them. Any entries which are already buffered are flushed first.
+func (l *Logger) SetBuffered(size int, flushAbove string) {
+	if !isValidSeverity(flushAbove) {
+		flushAbove = ERROR
+	}
+	flushAbove = canonicalSeverity(flushAbove)
+	l.mu.Lock()
+	old := l.buf
+	if old != nil && size > 0 && old.resize(size, flushAbove) {
+		l.mu.Unlock()
+		return
+	}
+	l.buf = nil
+	if size > 0 {
+		w := l.out
+		if w == nil {
+			w = os.Stdout
+		}
+		l.buf = &buffer{w: w, size: size, flushAbove: flushAbove}
+	}
+	l.mu.Unlock()
+	if old != nil {
+		_ = old.close()
+	}
+}
+
+// Flush writes any buffered log entries to the underlying io.Writer.
+// It does nothing if buffered mode is off.
+func (l *Logger) Flush() error {
+	l.mu.RLock()
+	b := l.buf
+	l.mu.RUnlock()
+	if b == nil {
+		return nil
+	}
+	return b.flush()
+}
+
+// FlushContext is the same as Flush, but stops early if the context is done, for example when a shutdown deadline is reached.
+// Entries are written in batches of whole entries, and the context is checked before each batch, so a batch which has started
+// is always finished, even if that takes longer than the context allows. When it stops early, the entries which were written
+// are removed from the buffer, and the rest are kept, in order, to be written by a later flush. The error then reports how many
+// entries are left, and wraps the error of the context, so errors.Is(err, context.DeadlineExceeded) can be used to check for it.
+// It does nothing if buffered mode is off.
+func (l *Logger) FlushContext(ctx context.Context) error {
+	l.mu.RLock()
+	b := l.buf
+	l.mu.RUnlock()
+	if b == nil {
+		return nil
+	}
+	return b.flushContext(ctx)
+}
+
+// Close flushes any buffered log entries and turns buffered mode off, so later entries are written straight away.
+// Loggers which share the buffer, because they were created from this one with methods like With, write straight away too.
+// It's safe to call Close more than once, so the usual pattern is to defer it as soon as buffered mode is turned on:
+//
+//	logger.SetBuffered(64*1024, gcplog.ERROR)
+//	defer logger.Close()
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	b := l.buf
+	l.buf = nil
+	l.mu.Unlock()
+	if b == nil {
+		return nil
+	}
+	return b.close()
+}
+
+// FlushOnSignal flushes any buffered log entries when the process receives one of the provided signals,
+// or SIGTERM and SIGINT if none are provided. Cloud Run sends SIGTERM before shutting down an instance,
+// so this stops the last entries being lost. The signal is then raised again with its default behaviour,
+// so the process still exits as it would have done. It returns a function which stops listening for the signals.
+//
+// This is intended for programs which don't handle the signals themselves. Programs which do should call Close
+// from their own handler instead.
+func (l *Logger) FlushOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		select {
+		case sig := <-ch:
+			signal.Stop(ch)
+			_ = l.Flush()
+			raise(sig)
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// raise sends the provided signal to the current process with its default behaviour restored,
+// exiting with code 1 if the signal can't be sent. It's a variable so tests can replace it.
+var raise = func(sig os.Signal) {
+	signal.Reset(sig)
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// write adds an encoded entry with the provided severity to the buffer, flushing it if required.
+// Once the buffer is closed, the entry is written straight to the underlying io.Writer instead.
+func (b *buffer) write(p []byte, severity string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		_, err := b.w.Write(p)
+		return err
+	}
+	b.data = append(b.data, p...)
+	b.ends = append(b.ends, len(b.data))
+	if len(b.data) >= b.size || SeverityAtLeast(severity, b.flushAbove) {
+		return b.flushLocked()
+	}
+	return nil
+}
+
+// detach returns a new, empty buffer with the same size and flushAbove severity, which writes to w,
+// or nil if the buffer is closed, so buffered mode is off.
+func (b *buffer) detach(w io.Writer) *buffer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	return &buffer{w: w, size: b.size, flushAbove: b.flushAbove}
+}
+
+// flush writes the buffered entries to the underlying io.Writer.
+func (b *buffer) flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked()
+}
+
+// resize changes the size and flushAbove severity of the buffer, flushing it if it now holds enough.
+// It returns false, and changes nothing, if the buffer is closed.
+func (b *buffer) resize(size int, flushAbove string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return false
+	}
+	b.size, b.flushAbove = size, flushAbove
+	if len(b.data) >= b.size {
+		_ = b.flushLocked()
+	}
+	return true
+}
+
+// close flushes the buffered entries, then makes later writes go straight to the underlying io.Writer.
+func (b *buffer) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return b.flushLocked()
+}
+
+// flushLocked is the same as flush, but must be called with b.mu held.
+// The buffer is emptied even if the write fails, so a broken io.Writer can't make it grow forever.
+func (b *buffer) flushLocked() error {
+	if len(b.data) == 0 {
+		return nil
+	}
+	_, err := b.w.Write(b.data)
+	b.data = b.data[:0]
+	b.ends = b.ends[:0]
+	return err
+}
+
+// flushContext writes the buffered entries to the underlying io.Writer, in batches of about flushChunk bytes,
+// until they've all been written or the context is done, as described by FlushContext.
+func (b *buffer) flushContext(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	written, start := 0, 0 // the number of entries, and bytes, written so far
+	var err error
+	for written < len(b.ends) && err == nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = fmt.Errorf("gcplog: flush stopped with %d entries left: %w", len(b.ends)-written, ctxErr)
+			break
+		}
+		end := written
+		for end < len(b.ends)-1 && b.ends[end]-start < flushChunk {
+			end++
+		}
+		_, err = b.w.Write(b.data[start:b.ends[end]])
+		written, start = end+1, b.ends[end]
+	}
+	// Remove the written entries. Like flushLocked, entries in a batch which failed to write are removed too.
+	b.data = b.data[:copy(b.data, b.data[start:])]
+	n := copy(b.ends, b.ends[written:])
+	for i := range b.ends[:n] {
+		b.ends[i] -= start
+	}
+	b.ends = b.ends[:n]
+	return err
+}
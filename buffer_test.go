@@ -0,0 +1,261 @@
+package gcplog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSetBuffered(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.SetBuffered(1<<20, ERROR)
+	logger.Print("one")
+	logger.With("a", 1).Print("two")
+	if buf.Len() != 0 {
+		t.Fatalf("entries below ERROR were written before a flush: %s", buf.String())
+	}
+	logger.PrintAt(ERROR, "three")
+	want := `{"severity":"INFO","message":"one"}` + "\n" +
+		`{"severity":"INFO","message":"two","a":1}` + "\n" +
+		`{"severity":"ERROR","message":"three"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	logger.Print("four")
+	if err := logger.Flush(); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	if got := buf.String(); got != `{"severity":"INFO","message":"four"}`+"\n" {
+		t.Errorf("Flush() wrote %s", got)
+	}
+}
+
+func TestSetBufferedSize(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(DEBUG)
+	logger.out = &buf
+	line := `{"severity":"DEBUG","message":"Hello World"}` + "\n"
+	logger.SetBuffered(3*len(line), "BOGUS")
+	logger.Print("Hello World")
+	logger.Print("Hello World")
+	if buf.Len() != 0 {
+		t.Fatalf("entries were written before the buffer was full: %s", buf.String())
+	}
+	logger.Print("Hello World")
+	if got := buf.String(); got != strings.Repeat(line, 3) {
+		t.Errorf("got:\n%s\nwant three entries", got)
+	}
+	buf.Reset()
+	logger.PrintAt(ERROR, "Hello World")
+	if buf.Len() == 0 {
+		t.Error("an invalid flushAbove severity didn't default to ERROR")
+	}
+}
+
+func TestSetBufferedOff(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.SetBuffered(1<<20, ERROR)
+	logger.Print("buffered")
+	logger.SetBuffered(0, ERROR)
+	logger.Print("direct")
+	want := `{"severity":"INFO","message":"buffered"}` + "\n" +
+		`{"severity":"INFO","message":"direct"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if err := logger.Flush(); err != nil {
+		t.Errorf("Flush() with buffering off = %v", err)
+	}
+}
+
+func TestSetBufferedShared(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.SetBuffered(1<<20, ERROR)
+	child := logger.With("child", true)
+	child.Print("first")
+	logger.SetBuffered(1<<20, WARNING)
+	child.PrintAt(WARNING, "flushed at the new severity")
+	if got := strings.Count(buf.String(), "\n"); got != 2 {
+		t.Errorf("wrote %d entries after resizing, want 2:\n%s", got, buf.String())
+	}
+	child.Print("buffered")
+	logger.SetBuffered(0, ERROR)
+	child.Print("direct")
+	want := `{"severity":"INFO","message":"first","child":true}` + "\n" +
+		`{"severity":"WARNING","message":"flushed at the new severity","child":true}` + "\n" +
+		`{"severity":"INFO","message":"buffered","child":true}` + "\n" +
+		`{"severity":"INFO","message":"direct","child":true}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	buf.Reset()
+	child.SetBuffered(1<<20, ERROR)
+	child.Print("buffered again")
+	logger.Print("parent")
+	if got, want := buf.String(), `{"severity":"INFO","message":"parent"}`+"\n"; got != want {
+		t.Errorf("after buffering the child again, got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestClose(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.SetBuffered(1<<20, ERROR)
+	logger.Print("buffered")
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatalf("second Close() = %v", err)
+	}
+	logger.Print("direct")
+	want := `{"severity":"INFO","message":"buffered"}` + "\n" +
+		`{"severity":"INFO","message":"direct"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCloseSharedBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.SetBuffered(1<<20, ERROR)
+	child := logger.With("child", true)
+	warn := logger.At(WARNING)
+	child.Print("buffered")
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	child.Print("after close")
+	warn.Print("at warning")
+	want := `{"severity":"INFO","message":"buffered","child":true}` + "\n" +
+		`{"severity":"INFO","message":"after close","child":true}` + "\n" +
+		`{"severity":"WARNING","message":"at warning"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// cancelWriter is an io.Writer which cancels a context after its first write.
+type cancelWriter struct {
+	bytes.Buffer
+	writes int
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.writes++
+	w.cancel()
+	return w.Buffer.Write(p)
+}
+
+func TestFlushContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &cancelWriter{cancel: cancel}
+	logger := New(INFO)
+	logger.out = out
+	logger.SetBuffered(1<<20, EMERGENCY)
+	big := strings.Repeat("x", 20*1024)
+	for i := 0; i < 4; i++ {
+		logger.Printf("%d %s", i, big)
+	}
+	err := logger.FlushContext(ctx)
+	if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "2 entries left") {
+		t.Errorf("FlushContext() = %v, want it to report 2 entries left", err)
+	}
+	if out.writes != 1 || strings.Count(out.String(), "\n") != 2 {
+		t.Fatalf("FlushContext wrote %d entries in %d writes, want 2 entries in 1 write", strings.Count(out.String(), "\n"), out.writes)
+	}
+	if err := logger.Flush(); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("wrote %d entries in total, want 4", len(lines))
+	}
+	for i, line := range lines {
+		if want := `{"severity":"INFO","message":"` + strconv.Itoa(i) + " " + big + `"}`; line != want {
+			t.Errorf("entry %d is %.40s…, want %.40s…", i, line, want)
+		}
+	}
+}
+
+func TestFlushContextDone(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	if err := logger.FlushContext(context.Background()); err != nil {
+		t.Errorf("FlushContext() with buffering off = %v", err)
+	}
+	logger.SetBuffered(1<<20, ERROR)
+	logger.Print("one")
+	logger.Print("two")
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	if err := logger.FlushContext(ctx); !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "2 entries left") {
+		t.Errorf("FlushContext() = %v, want it to report 2 entries left", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("FlushContext wrote %s after its context was done", buf.String())
+	}
+	if err := logger.FlushContext(context.Background()); err != nil || strings.Count(buf.String(), "\n") != 2 {
+		t.Errorf("FlushContext() = %v, and wrote %s", err, buf.String())
+	}
+}
+
+func TestFatalFlushesBuffer(t *testing.T) {
+	if name := os.Getenv("GCPLOG_TEST_FATAL"); name != "" {
+		logger := New(INFO)
+		logger.SetBuffered(64*1024, ERROR)
+		logger.Print("buffered")
+		switch name {
+		case "Fatal":
+			logger.Fatal("fatal")
+		case "Fatalf":
+			logger.Fatalf("%s", "fatal")
+		case "PrefixFatal":
+			logger.PrefixFatal("fatal")
+		case "PrefixFatalf":
+			logger.PrefixFatalf("%s", "fatal")
+		}
+		return
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Fatal", "fatal"},
+		{"Fatalf", "fatal"},
+		{"PrefixFatal", "INFO: fatal"},
+		{"PrefixFatalf", "INFO: fatal"},
+	}
+	for _, tt := range tests {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestFatalFlushesBuffer$")
+		cmd.Env = append(os.Environ(), "GCPLOG_TEST_FATAL="+tt.name)
+		out, err := cmd.Output()
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) || exit.ExitCode() != 1 {
+			t.Errorf("%s: exited with %v, want exit code 1", tt.name, err)
+		}
+		want := `{"severity":"INFO","message":"buffered"}` + "\n" + `{"severity":"INFO","message":"` + tt.want + `"}` + "\n"
+		if got := string(out); got != want {
+			t.Errorf("%s got:\n%s\nwant:\n%s", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package gcplog
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFlushOnSignal(t *testing.T) {
+	raised := make(chan os.Signal, 1)
+	defer func(r func(os.Signal)) { raise = r }(raise)
+	raise = func(sig os.Signal) { raised <- sig }
+
+	var buf syncBuffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.SetBuffered(1<<20, ERROR)
+	stop := logger.FlushOnSignal(syscall.SIGUSR1)
+	defer stop()
+	logger.Print("buffered")
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(syscall.SIGUSR1); err != nil {
+		t.Fatalf("sending signal: %v", err)
+	}
+	select {
+	case sig := <-raised:
+		if sig != syscall.SIGUSR1 {
+			t.Errorf("raised %v, want %v", sig, syscall.SIGUSR1)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal wasn't raised again after flushing")
+	}
+	if got := buf.String(); got != `{"severity":"INFO","message":"buffered"}`+"\n" {
+		t.Errorf("got %s after the signal", got)
+	}
+}
@@ -0,0 +1,133 @@
+package gcplog
+
+// Builder builds a single log entry step by step, as an alternative to combining methods like With, WithLabel and At,
+// and writes it with Send. It's created by Logger.Entry, for example:
+//
+//	logger.Entry().Severity(gcplog.ERROR).Msgf("save failed: %v", err).Label("shard", s).Field("order_id", id).Send()
+//
+// The entry is encoded in the same way as one written by Print, so the same content gives the same output.
+// Each method only changes this entry, never the Logger. A Builder is for a single entry: once Send has been called,
+// every other method does nothing, and calling Send again writes nothing. A Builder must not be used by more than one goroutine at once.
+type Builder struct {
+	l    *Logger
+	r    record
+	args []any
+	sent bool
+}
+
+// Entry returns a Builder for a log entry which starts with the severity, fields, labels and other settings of the Logger.
+// Nothing is written until Send is called.
+func (l *Logger) Entry() *Builder {
+	return &Builder{l: l}
+}
+
+// Severity sets the severity of the entry. If it's not valid, then the severity of the Logger is used.
+func (b *Builder) Severity(s string) *Builder {
+	if !b.sent {
+		b.r.severity = s
+	}
+	return b
+}
+
+// Msg sets the message of the entry.
+func (b *Builder) Msg(msg string) *Builder {
+	if !b.sent {
+		b.r.message, b.r.printf, b.args = msg, false, nil
+	}
+	return b
+}
+
+// Msgf sets the message of the entry, using the same format as fmt.Printf. It's only formatted if the entry is written.
+func (b *Builder) Msgf(format string, v ...any) *Builder {
+	if !b.sent {
+		b.r.message, b.r.printf, b.args = format, true, v
+	}
+	return b
+}
+
+// Field adds a structured field to the entry, replacing any field of the Logger, or added earlier, with the same key.
+func (b *Builder) Field(key string, value any) *Builder {
+	if !b.sent {
+		if b.r.fields == nil {
+			b.r.fields = make(map[string]any)
+		}
+		b.r.fields[key] = value
+	}
+	return b
+}
+
+// Fields adds the provided typed fields to the entry, as Field does.
+func (b *Builder) Fields(fields ...Field) *Builder {
+	for _, f := range fields {
+		b.Field(f.Key, f)
+	}
+	return b
+}
+
+// Err adds the provided error to the entry in an "error" field. A nil error adds nothing.
+func (b *Builder) Err(err error) *Builder {
+	if err == nil {
+		return b
+	}
+	return b.Fields(Err(err))
+}
+
+// Label adds a Cloud Logging label to the entry, replacing any label of the Logger, or added earlier, with the same key.
+func (b *Builder) Label(key, value string) *Builder {
+	if !b.sent {
+		if b.r.labels == nil {
+			b.r.labels = make(map[string]string)
+		}
+		b.r.labels[key] = value
+	}
+	return b
+}
+
+// Trace links the entry to the provided Cloud Trace trace, in the project set by SetProjectID, as WithTraceID does.
+func (b *Builder) Trace(traceID string) *Builder {
+	if !b.sent {
+		b.l.mu.RLock()
+		projectID := b.l.projectID
+		b.l.mu.RUnlock()
+		t := b.traceContext().with(projectID, traceID)
+		b.r.trace = &t
+	}
+	return b
+}
+
+// SpanID sets the span ID of the entry, within its trace, as WithSpanID does.
+func (b *Builder) SpanID(spanID string) *Builder {
+	if !b.sent {
+		t := b.traceContext()
+		t.spanID = spanID
+		b.r.trace = &t
+	}
+	return b
+}
+
+// traceContext returns the trace of the entry so far, which is the trace of the Logger until Trace or SpanID is called.
+func (b *Builder) traceContext() traceContext {
+	if b.r.trace != nil {
+		return *b.r.trace
+	}
+	b.l.mu.RLock()
+	defer b.l.mu.RUnlock()
+	return b.l.trace
+}
+
+// InsertID sets the insertId of the entry, as PrintWithInsertID does.
+func (b *Builder) InsertID(id string) *Builder {
+	if !b.sent {
+		b.r.insertID = id
+	}
+	return b
+}
+
+// Send writes the entry, and returns any error from writing it. Only the first call writes anything.
+func (b *Builder) Send() error {
+	if b.sent {
+		return nil
+	}
+	b.sent = true
+	return b.l.output(b.r, b.args...)
+}
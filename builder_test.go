@@ -0,0 +1,120 @@
+package gcplog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+)
+
+// newBuilderTestLogger returns a Logger with fields, labels, a group and a project ID, which writes to buf.
+func newBuilderTestLogger(buf *bytes.Buffer) *Logger {
+	logger := New(INFO).With("service", "orders").WithLabel("env", "prod").WithSpanID("span1")
+	logger.SetProjectID("my-project")
+	logger.out = buf
+	return logger
+}
+
+func TestBuilder(t *testing.T) {
+	err := errors.New("disk full")
+	tests := []struct {
+		name    string
+		builder func(l *Logger)
+		print   func(l *Logger)
+	}{
+		{
+			name: "all",
+			builder: func(l *Logger) {
+				l.Entry().Severity(ERROR).Msgf("save failed: %v", err).Label("shard", "7").Field("order_id", 42).Trace("abc123").Err(err).Send()
+			},
+			print: func(l *Logger) {
+				l.WithLabel("shard", "7").With("order_id", 42).WithTraceID("abc123").With(Err(err)).At(ERROR).Printf("save failed: %v", err)
+			},
+		},
+		{
+			name:    "empty",
+			builder: func(l *Logger) { l.Entry().Send() },
+			print:   func(l *Logger) { l.Print("") },
+		},
+		{
+			name: "overrides",
+			builder: func(l *Logger) {
+				l.Entry().Msg("first").Msg("second").Field("service", "billing").Label("env", "dev").SpanID("span2").InsertID("id1").Send()
+			},
+			print: func(l *Logger) {
+				l.With("service", "billing").WithLabel("env", "dev").WithSpanID("span2").PrintWithInsertID("id1", "second")
+			},
+		},
+		{
+			name:    "invalid severity",
+			builder: func(l *Logger) { l.Entry().Severity("BOGUS").Fields(Int("n", 1), String("s", "x")).Msg("m").Send() },
+			print:   func(l *Logger) { l.PrintFields("m", Int("n", 1), String("s", "x")) },
+		},
+		{
+			name:    "group",
+			builder: func(l *Logger) { l.WithGroup("req").Entry().Field("id", 1).Msg("m").Send() },
+			print:   func(l *Logger) { l.WithGroup("req").Printw("m", "id", 1) },
+		},
+	}
+	for _, tt := range tests {
+		var viaBuilder, viaPrint bytes.Buffer
+		tt.builder(newBuilderTestLogger(&viaBuilder))
+		tt.print(newBuilderTestLogger(&viaPrint))
+		if viaBuilder.Len() == 0 || viaBuilder.String() != viaPrint.String() {
+			t.Errorf("%s: builder wrote:\n%s\nPrint wrote:\n%s", tt.name, viaBuilder.String(), viaPrint.String())
+		}
+	}
+}
+
+func TestBuilderSendOnce(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	b := logger.Entry().Msg("once")
+	if err := b.Send(); err != nil {
+		t.Errorf("Send() = %v", err)
+	}
+	b.Msg("changed").Severity(ERROR).Field("k", 1).Label("l", "v")
+	if err := b.Send(); err != nil {
+		t.Errorf("second Send() = %v", err)
+	}
+	if want := `{"severity":"INFO","message":"once"}` + "\n"; buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	logger.out = errWriter{io.ErrClosedPipe}
+	if err := logger.Entry().Msg("failed").Send(); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Send() = %v, want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestBuilderSourceLocation(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithSourceLocation(DEFAULT)
+	logger.out = &buf
+	logger.Entry().Msg("builder").Send()
+	line := callerLine() - 1
+	if want := `"line":"` + strconv.Itoa(line) + `","function":"github.com/tinyinput/gcplog.TestBuilderSourceLocation"`; !bytes.Contains(buf.Bytes(), []byte(want)) {
+		t.Errorf("got %s, want source location containing %s", buf.String(), want)
+	}
+}
+
+func TestBuilderLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.Entry().Field("k", 1).Label("l", "v").Trace("projects/p/traces/t").Send()
+	logger.Print("unchanged")
+	if want := `{"severity":"INFO","message":"unchanged"}` + "\n"; !bytes.HasSuffix(buf.Bytes(), []byte(want)) {
+		t.Errorf("got:\n%s\nwant last line:\n%s", buf.String(), want)
+	}
+}
+
+func BenchmarkBuilder(b *testing.B) {
+	logger := New(INFO)
+	logger.out = io.Discard
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Entry().Severity(WARNING).Msg("Hello World").Send()
+	}
+}
@@ -0,0 +1,59 @@
+package gcplog
+
+import (
+	"runtime/debug"
+	"strconv"
+)
+
+// BuildInfo is the version of the running binary, read from the build information embedded by the Go toolchain.
+// It can be used for the labels added by WithBuildInfoLabels, or elsewhere, like the serviceContext of error reports.
+type BuildInfo struct {
+	Version  string // The version of the main module, like "v1.2.3", or "" if it's not known
+	Revision string // The version control revision the binary was built from, or "" if it's not known
+	Modified bool   // Whether the source code had uncommitted changes when the binary was built, only meaningful if Revision is set
+}
+
+// readBuildInfo is debug.ReadBuildInfo, replaced by tests.
+var readBuildInfo = debug.ReadBuildInfo
+
+// ReadBuildInfo returns the version of the running binary. Any parts which aren't known are left empty, as they are
+// for binaries built without module support, or from outside a version control checkout, or by go test.
+func ReadBuildInfo() BuildInfo {
+	var b BuildInfo
+	info, ok := readBuildInfo()
+	if !ok {
+		return b
+	}
+	if v := info.Main.Version; v != "(devel)" {
+		b.Version = v
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+// WithBuildInfoLabels returns a new Logger which adds the version of the running binary, from ReadBuildInfo, as labels
+// to every log entry: "app_version", "vcs_revision" and "vcs_modified". Each label is left out if it's not known.
+// The build information is read once, when WithBuildInfoLabels is called. The original Logger is not changed.
+func (l *Logger) WithBuildInfoLabels() *Logger {
+	return l.withLabels(ReadBuildInfo().labels())
+}
+
+// labels returns the labels WithBuildInfoLabels adds for the build information.
+func (b BuildInfo) labels() map[string]string {
+	labels := make(map[string]string, 3)
+	if b.Version != "" {
+		labels["app_version"] = b.Version
+	}
+	if b.Revision != "" {
+		labels["vcs_revision"] = b.Revision
+		labels["vcs_modified"] = strconv.FormatBool(b.Modified)
+	}
+	return labels
+}
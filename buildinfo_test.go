@@ -0,0 +1,56 @@
+package gcplog
+
+import (
+	"bytes"
+	"runtime/debug"
+	"testing"
+)
+
+// fakeBuildInfo makes ReadBuildInfo return info, until the test finishes. A nil info means there's no build information.
+func fakeBuildInfo(t *testing.T, info *debug.BuildInfo) {
+	t.Helper()
+	orig := readBuildInfo
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return info, info != nil }
+	t.Cleanup(func() { readBuildInfo = orig })
+}
+
+func TestWithBuildInfoLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		info   *debug.BuildInfo
+		labels map[string]string
+		want   string
+	}{
+		{"none", nil, nil, `{"severity":"INFO","message":"started"}`},
+		{"devel", &debug.BuildInfo{Main: debug.Module{Version: "(devel)"}}, nil, `{"severity":"INFO","message":"started"}`},
+		{"version", &debug.BuildInfo{Main: debug.Module{Version: "v1.2.3"}}, nil,
+			`{"severity":"INFO","message":"started","logging.googleapis.com/labels":{"app_version":"v1.2.3"}}`},
+		{"vcs", &debug.BuildInfo{
+			Main:     debug.Module{Version: "v1.2.4-0.20240229131415-0123456789ab"},
+			Settings: []debug.BuildSetting{{Key: "vcs", Value: "git"}, {Key: "vcs.revision", Value: "0123456789abcdef"}, {Key: "vcs.modified", Value: "true"}},
+		}, map[string]string{"env": "prod"}, `{"severity":"INFO","message":"started","logging.googleapis.com/labels":{"app_version":"v1.2.4-0.20240229131415-0123456789ab","env":"prod","vcs_modified":"true","vcs_revision":"0123456789abcdef"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeBuildInfo(t, tt.info)
+			var buf bytes.Buffer
+			logger := New(INFO).WithLabels(tt.labels).WithBuildInfoLabels()
+			logger.out = &buf
+			logger.Print("started")
+			if got := buf.String(); got != tt.want+"\n" {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBuildInfo(t *testing.T) {
+	fakeBuildInfo(t, &debug.BuildInfo{
+		Main:     debug.Module{Version: "v0.1.0"},
+		Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "abc"}, {Key: "vcs.modified", Value: "false"}},
+	})
+	want := BuildInfo{Version: "v0.1.0", Revision: "abc"}
+	if got := ReadBuildInfo(); got != want {
+		t.Errorf("ReadBuildInfo() = %+v, want %+v", got, want)
+	}
+}
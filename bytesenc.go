@@ -0,0 +1,118 @@
+package gcplog
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// BytesEncoding controls how []byte field values are written, see WithBytesEncoding.
+type BytesEncoding int
+
+const (
+	BytesBase64    BytesEncoding = iota + 1 // Standard base64, as encoding/json writes them
+	BytesHex                                // Lower case hex, two characters for each byte
+	BytesUTF8Lossy                          // As text, with each invalid UTF-8 sequence replaced by U+FFFD
+)
+
+// defaultBytesLimit is the number of bytes of a []byte field value which are written, by default, once WithBytesEncoding is used.
+const defaultBytesLimit = 1024
+
+// WithBytesEncoding returns a new Logger which writes []byte field values in the provided encoding, rather than as the base64
+// encoding/json uses, which is hard to read when the bytes are really text. Only the first 1KB of each value is written, or the limit
+// set by WithBytesLimit, followed by a note of the original length, like "…[truncated, 4096 bytes]", so one large payload
+// can't make an entry too large for Cloud Logging. A nil slice is written as null, and an empty one as "".
+//
+// It applies to []byte field values, including those of Fields created by Any and those inside groups.
+// Byte slices nested inside other maps, slices and structs aren't changed. The encoded values are masked and scrubbed,
+// by WithMasking and WithPIIScrubbing, like other strings. An invalid encoding is ignored.
+// The original Logger is not changed.
+func (l *Logger) WithBytesEncoding(enc BytesEncoding) *Logger {
+	c := l.clone()
+	if enc >= BytesBase64 && enc <= BytesUTF8Lossy {
+		c.bytesFormat.enc = enc
+	}
+	return c
+}
+
+// WithBytesLimit returns a new Logger which writes at most n bytes of each []byte field value, as described by WithBytesEncoding,
+// which is base64 by default. A limit of zero or less restores the default of 1KB. The original Logger is not changed.
+func (l *Logger) WithBytesLimit(n int) *Logger {
+	c := l.clone()
+	c.bytesFormat.limit = max(n, 0)
+	if c.bytesFormat.enc == 0 {
+		c.bytesFormat.enc = BytesBase64
+	}
+	return c
+}
+
+// bytesFormat holds how []byte field values are written, set by WithBytesEncoding and WithBytesLimit.
+type bytesFormat struct {
+	enc   BytesEncoding // 0 when byte slices are left to encoding/json
+	limit int           // the number of bytes written, or 0 for defaultBytesLimit
+}
+
+// fields returns fields with every []byte value, including those of Fields and those inside groups, encoded, and whether any were.
+func (f bytesFormat) fields(fields map[string]any) (map[string]any, bool) {
+	if f.enc == 0 {
+		return fields, false
+	}
+	return rewriteFields(fields, f.value)
+}
+
+// value returns the field value v encoded as a string, if it's a non-nil []byte, and whether it changed.
+func (f bytesFormat) value(v any) (any, bool) {
+	switch t := v.(type) {
+	case []byte:
+		if t != nil {
+			return f.encode(t), true
+		}
+	case Field:
+		if t.kind == anyKind {
+			if ev, ok := f.value(t.val); ok {
+				return Any(t.Key, ev), true
+			}
+		}
+	case group:
+		if g, ok := f.fields(t); ok {
+			return group(g), true
+		}
+	}
+	return v, false
+}
+
+// encode returns b in the encoding, cut to the limit with a note of its original length if it's longer.
+func (f bytesFormat) encode(b []byte) string {
+	n, cut := len(b), f.limit
+	if cut == 0 {
+		cut = defaultBytesLimit
+	}
+	if cut >= n {
+		cut = n
+	} else if f.enc == BytesUTF8Lossy {
+		// Cut at the start of a character, rather than leaving half of one to be replaced, unless the bytes aren't UTF-8 anyway.
+		c := cut
+		for c > 0 && cut-c < utf8.UTFMax-1 && !utf8.RuneStart(b[c]) {
+			c--
+		}
+		if utf8.RuneStart(b[c]) {
+			cut = c
+		}
+	}
+	b = b[:cut]
+	var s string
+	switch f.enc {
+	case BytesHex:
+		s = hex.EncodeToString(b)
+	case BytesUTF8Lossy:
+		s = strings.ToValidUTF8(string(b), string(utf8.RuneError))
+	default:
+		s = base64.StdEncoding.EncodeToString(b)
+	}
+	if len(b) < n {
+		s += "…[truncated, " + strconv.Itoa(n) + " bytes]"
+	}
+	return s
+}
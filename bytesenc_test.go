@@ -0,0 +1,72 @@
+package gcplog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWithBytesEncoding(t *testing.T) {
+	long := bytes.Repeat([]byte("ab"), 600)
+	tests := []struct {
+		name  string
+		enc   BytesEncoding
+		limit int
+		v     any
+		want  string
+	}{
+		{"base64", BytesBase64, 0, []byte("hi!"), `"aGkh"`},
+		{"hex", BytesHex, 0, []byte("hi!"), `"686921"`},
+		{"utf8", BytesUTF8Lossy, 0, []byte("héllo"), `"héllo"`},
+		{"utf8 invalid", BytesUTF8Lossy, 0, []byte("a\xffb\xc3"), `"a�b�"`},
+		{"nil", BytesHex, 0, []byte(nil), `null`},
+		{"empty", BytesHex, 0, []byte{}, `""`},
+		{"empty utf8", BytesUTF8Lossy, 0, []byte{}, `""`},
+		{"default limit", BytesUTF8Lossy, 0, long, `"` + string(long[:1024]) + `…[truncated, 1200 bytes]"`},
+		{"at limit", BytesUTF8Lossy, 4, []byte("abcd"), `"abcd"`},
+		{"limit hex", BytesHex, 2, []byte("abcd"), `"6162…[truncated, 4 bytes]"`},
+		{"limit base64", BytesBase64, 3, []byte("hi!!"), `"aGkh…[truncated, 4 bytes]"`},
+		{"limit character", BytesUTF8Lossy, 2, []byte("aé"), `"a…[truncated, 3 bytes]"`},
+		{"limit invalid", BytesUTF8Lossy, 4, []byte("\x80\x80\x80\x80\x80"), `"�…[truncated, 5 bytes]"`},
+		{"Any field", BytesHex, 0, Any("v", []byte{0, 255}), `"00ff"`},
+		{"group", BytesHex, 0, group{"b": []byte{1}, "n": 1}, `{"b":"01","n":1}`},
+		{"string", BytesHex, 0, "text", `"text"`},
+		{"nested", BytesHex, 0, map[string]any{"b": []byte("hi!")}, `{"b":"aGkh"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO).WithBytesEncoding(tt.enc)
+			if tt.limit != 0 {
+				logger = logger.WithBytesLimit(tt.limit)
+			}
+			logger.out = &buf
+			logger.Printw("m", "v", tt.v)
+			want := `{"severity":"INFO","message":"m","v":` + tt.want + "}\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestWithBytesEncodingDefault(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).With("b", bytes.Repeat([]byte{1}, 2000))
+	logger.out = &buf
+	logger.Print("unchanged")
+	logger.WithBytesEncoding(BytesEncoding(9)).Print("invalid")
+	limited := logger.WithBytesLimit(2)
+	limited.Print("limited")
+	limited.WithBytesLimit(0).WithBytesEncoding(BytesHex).Print("restored")
+	logger.WithBytesEncoding(BytesUTF8Lossy).WithMasking().Printw("masked", "b", []byte("password=hunter2"))
+	full := `"` + strings.Repeat("AQEB", 2000/3) + `AQE="`
+	want := `{"severity":"INFO","message":"unchanged","b":` + full + "}\n" +
+		`{"severity":"INFO","message":"invalid","b":` + full + "}\n" +
+		`{"severity":"INFO","message":"limited","b":"AQE=…[truncated, 2000 bytes]"}` + "\n" +
+		`{"severity":"INFO","message":"restored","b":"` + strings.Repeat("01", 1024) + `…[truncated, 2000 bytes]"}` + "\n" +
+		`{"severity":"INFO","message":"masked","b":"password=***"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+package gcplog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinyinput/gcplog"
+	"github.com/tinyinput/gcplog/gcplogtest"
+)
+
+func TestWithClock(t *testing.T) {
+	var buf bytes.Buffer
+	clock := gcplogtest.NewClock(time.Date(2024, 2, 29, 13, 14, 15, 500000000, time.UTC))
+	logger := gcplog.New(gcplog.INFO).WithClock(clock)
+	logger.SetOutput(&buf)
+	logger.WithTimestamps().Print("rfc3339")
+	logger.WithTimestamps(gcplog.TimestampObject).Print("object")
+	done := logger.Timer("timed")
+	clock.Advance(1500 * time.Millisecond)
+	done()
+	want := `{"severity":"INFO","message":"rfc3339","time":"2024-02-29T13:14:15.5Z"}` + "\n" +
+		`{"severity":"INFO","message":"object","timestamp":{"seconds":1709212455,"nanos":500000000}}` + "\n" +
+		`{"severity":"INFO","message":"timed","elapsed":"1.5s"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := logger.With("k", 1).Now(); !got.Equal(clock.Now()) {
+		t.Errorf("Now() = %v, want the time of the Clock, %v", got, clock.Now())
+	}
+	if got := gcplog.New(gcplog.INFO).Now(); time.Since(got) > time.Minute {
+		t.Errorf("Now() without a Clock = %v, want the system time", got)
+	}
+}
+
+func TestWithClockSampling(t *testing.T) {
+	var buf bytes.Buffer
+	clock := gcplogtest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	logger := gcplog.New(gcplog.DEBUG).WithSampling(gcplog.DEBUG, 0).WithClock(clock)
+	logger.SetOutput(&buf)
+	logger.Print("dropped")
+	logger.Print("dropped")
+	clock.Advance(59 * time.Second)
+	logger.PrintAt(gcplog.INFO, "too soon")
+	clock.Advance(time.Second)
+	logger.PrintAt(gcplog.INFO, "summary due")
+	want := `{"severity":"INFO","message":"too soon"}` + "\n" +
+		`{"severity":"DEBUG","message":"sampled out 2 DEBUG entries in the last 60s"}` + "\n" +
+		`{"severity":"INFO","message":"summary due"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := gcplog.New(gcplog.DEBUG)
+	logger.SetOutput(&buf)
+	clock := gcplogtest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	i := 0
+	random := func() float64 {
+		i++
+		return float64(i%4) / 4 // 0.25, 0.5, 0.75, 0.0, ...
+	}
+	sampled := logger.WithSampling("debug", 0.5).WithSamplingSource(random).WithClock(clock)
+	for n := 0; n < 8; n++ {
+		sampled.Print("debug")
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 4 {
+		t.Errorf("wrote %d of 8 sampled entries, want 4", got)
+	}
+	if got := sampled.Counts()[gcplog.DEBUG]; got != 4 {
+		t.Errorf("Counts()[DEBUG] = %d, want 4", got)
+	}
+
+	buf.Reset()
+	clock.Advance(time.Minute)
+	sampled.SetSeverity(gcplog.INFO)
+	sampled.Print("info")
+	want := `{"severity":"DEBUG","message":"sampled out 4 DEBUG entries in the last 60s"}` + "\n" +
+		`{"severity":"INFO","message":"info"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	clock.Advance(time.Minute)
+	sampled.Print("info")
+	if got := buf.String(); got != `{"severity":"INFO","message":"info"}`+"\n" {
+		t.Errorf("wrote a summary when nothing was dropped: %s", got)
+	}
+}
+
+func TestSetLogEntryFormat(t *testing.T) {
+	var buf bytes.Buffer
+	clock := gcplogtest.NewClock(time.Date(2024, 2, 29, 13, 14, 15, 500000000, time.UTC))
+	logger := gcplog.Named("orders", gcplog.INFO).WithClock(clock).WithTimestamps(gcplog.TimestampObject).WithComponent("billing").
+		WithLabel("env", "prod").WithTrace("my-project", "abc123").WithSpanID("0001").WithReportedErrors()
+	logger.SetOutput(&buf)
+	logger.SetLogEntryFormat(true)
+	logger.WithInsertID(func() string { return "id-1" }).With("orderId", 1234, "message", "field").Printw("saved", "items", 3)
+	logger.At(gcplog.ERROR).Print("failed")
+	logger.At(gcplog.TRACE).WithMessageKey("msg").Print("traced")
+	logger.SetLogEntryFormat(false)
+	logger.Print("agent")
+	want := `{"severity":"INFO","timestamp":"2024-02-29T13:14:15.5Z","insertId":"id-1","labels":{"env":"prod"},` +
+		`"trace":"projects/my-project/traces/abc123","spanId":"0001","traceSampled":true,` +
+		`"jsonPayload":{"message":"saved","logger":"orders","component":"billing","field_message":"field","items":3,"orderId":1234}}` + "\n" +
+		`{"severity":"ERROR","timestamp":"2024-02-29T13:14:15.5Z","labels":{"env":"prod"},` +
+		`"trace":"projects/my-project/traces/abc123","spanId":"0001","traceSampled":true,` +
+		`"jsonPayload":{"message":"failed","logger":"orders","component":"billing","@type":"type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"}}` + "\n" +
+		`{"severity":"DEBUG","timestamp":"2024-02-29T13:14:15.5Z","labels":{"env":"prod","gcplog_level":"TRACE"},` +
+		`"trace":"projects/my-project/traces/abc123","spanId":"0001","traceSampled":true,` +
+		`"jsonPayload":{"msg":"traced","logger":"orders","component":"billing"}}` + "\n" +
+		`{"severity":"INFO","message":"agent","timestamp":{"seconds":1709212455,"nanos":500000000},"logger":"orders","component":"billing",` +
+		`"logging.googleapis.com/labels":{"env":"prod"},"logging.googleapis.com/trace":"projects/my-project/traces/abc123",` +
+		`"logging.googleapis.com/spanId":"0001","logging.googleapis.com/trace_sampled":true}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
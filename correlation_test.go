@@ -0,0 +1,52 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestWithCorrelationID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithLabel("service", "orders")
+	logger.out = &buf
+	req := logger.WithCorrelationID("req-42")
+	req.Print("received")
+	req.With("items", 3).Print("saved")
+	req.WithCorrelationID("req-43").Print("replaced")
+	logger.Print("none")
+	want := `{"severity":"INFO","message":"received","logging.googleapis.com/labels":{"correlation_id":"req-42","service":"orders"}}` + "\n" +
+		`{"severity":"INFO","message":"saved","items":3,"logging.googleapis.com/labels":{"correlation_id":"req-42","service":"orders"}}` + "\n" +
+		`{"severity":"INFO","message":"replaced","logging.googleapis.com/labels":{"correlation_id":"req-43","service":"orders"}}` + "\n" +
+		`{"severity":"INFO","message":"none","logging.googleapis.com/labels":{"service":"orders"}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := req.CorrelationID(); got != "req-42" {
+		t.Errorf("CorrelationID() = %q, want %q", got, "req-42")
+	}
+	if got := logger.CorrelationID(); got != "" {
+		t.Errorf("CorrelationID() = %q without an ID, want \"\"", got)
+	}
+}
+
+func TestWithCorrelationIDGenerated(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	a, b := logger.WithCorrelationID(""), logger.WithCorrelationID("")
+	id := a.CorrelationID()
+	if raw, err := hex.DecodeString(id); err != nil || len(raw) != 16 {
+		t.Errorf("CorrelationID() = %q, want 16 random bytes as hex", id)
+	}
+	if id == b.CorrelationID() {
+		t.Errorf("two generated correlation IDs are both %q", id)
+	}
+	a.Print("first")
+	a.Print("second")
+	want := `{"severity":"INFO","message":"first","logging.googleapis.com/labels":{"correlation_id":"` + id + `"}}` + "\n" +
+		`{"severity":"INFO","message":"second","logging.googleapis.com/labels":{"correlation_id":"` + id + `"}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,357 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// entry holds everything needed to encode a single log entry.
+type entry struct {
+	severity   string
+	message    string
+	name       string
+	component  string
+	seq        uint64         // the sequence number of the entry, or 0 when sequence numbers are off
+	stack      string         // the stack trace of the entry, or "" when stack traces are off
+	reported   bool           // whether the entry is marked as an error for Error Reporting, see WithReportedErrors
+	service    serviceContext // the service the entry's error comes from, only written when reported is true
+	fields     map[string]any
+	typed      []Field // fields added by PrintFields, which replace fields with the same key, kept unboxed until they're encoded
+	labels     map[string]string
+	insertID   string
+	trace      traceContext
+	time       time.Time // when the entry was written, or the zero time when timestamps are off
+	timeFormat TimestampFormat
+	source     *sourceLocation
+	logEntry   bool // whether the entry is written in the LogEntry format of the Cloud Logging API, see SetLogEntryFormat
+
+	severityKey string // the key the severity is written with, or "" for "severity"
+	messageKey  string // the key the message is written with, or "" for "message"
+	nameKey     string // the key the name is written with, or "" for "logger"
+}
+
+// componentKey is the key the component set by WithComponent is written with.
+const componentKey = "component"
+
+// labelsKey is the key Cloud Logging uses for the labels of a log entry.
+const labelsKey = "logging.googleapis.com/labels"
+
+// insertIDKey is the key Cloud Logging uses for the insertId of a log entry, which it uses to remove duplicate entries.
+const insertIDKey = "logging.googleapis.com/insertId"
+
+// sourceLocationKey is the key Cloud Logging uses for the source code location of a log entry.
+const sourceLocationKey = "logging.googleapis.com/sourceLocation"
+
+// reservedKeys are the keys used by the package itself, or which Cloud Logging gives a special meaning to,
+// which structured fields are not allowed to overwrite. Every key starting with reservedGCPPrefix is also reserved.
+var reservedKeys = map[string]bool{
+	"severity":    true,
+	"message":     true,
+	"logger":      true,
+	"time":        true,
+	"timestamp":   true,
+	"httpRequest": true,
+}
+
+// reservedGCPPrefix is the prefix of the special keys Cloud Logging uses for fields like the trace, labels, insertId and sourceLocation.
+const reservedGCPPrefix = "logging.googleapis.com/"
+
+// reservedPrefix is prepended to the key of any structured field which collides with a reserved key.
+const reservedPrefix = "field_"
+
+// appendJSON appends the JSON encoding of the entry to b, followed by a newline, and returns the extended buffer.
+// The severity and message always come first, with their keys set by WithSeverityKey and WithMessageKey, followed by the timestamp, the logger name, component and sequence number, then the fields, sorted by key, the stack trace, the Error Reporting type, the labels, the insertId, the trace and the source location.
+// The order never depends on map iteration, so the same entry is always encoded to the same bytes.
+// TRACE entries are written as DEBUG, with a label to tell them apart. Entries in the LogEntry format are encoded by appendLogEntryJSON instead.
+func (e *entry) appendJSON(b []byte) []byte {
+	if e.logEntry {
+		return e.appendLogEntryJSON(b)
+	}
+	b = append(b, '{')
+	b = appendJSONString(b, orDefault(e.severityKey, "severity"))
+	b = append(b, ':')
+	b = appendJSONString(b, e.gcpSeverity())
+	b = append(b, ',')
+	b = appendJSONString(b, orDefault(e.messageKey, "message"))
+	b = append(b, ':')
+	b = appendJSONString(b, e.message)
+	if !e.time.IsZero() {
+		b = e.timeFormat.appendJSON(b, e.time)
+	}
+	b = e.appendPayload(b)
+	b = appendLabels(b, labelsKey, e.allLabels())
+	if e.insertID != "" {
+		b = append(b, `,"`+insertIDKey+`":`...)
+		b = appendJSONString(b, e.insertID)
+	}
+	b = e.trace.appendJSON(b, traceKey, spanIDKey, traceSampledKey)
+	if e.source != nil {
+		b = append(b, `,"`+sourceLocationKey+`":`...)
+		b = appendJSONValue(b, e.source)
+	}
+	return append(b, '}', '\n')
+}
+
+// gcpSeverity returns the severity Cloud Logging is given for the entry, which is DEBUG for TRACE entries.
+func (e *entry) gcpSeverity() string {
+	if e.severity == TRACE {
+		return DEBUG
+	}
+	return e.severity
+}
+
+// allLabels returns the labels of the entry, with a "gcplog_level" label added to TRACE entries to tell them apart from DEBUG.
+func (e *entry) allLabels() map[string]string {
+	if e.severity != TRACE {
+		return e.labels
+	}
+	labels := make(map[string]string, len(e.labels)+1)
+	for k, v := range e.labels {
+		labels[k] = v
+	}
+	labels["gcplog_level"] = TRACE
+	return labels
+}
+
+// appendPayload appends the members of the entry which follow the message and timestamp to b: the logger name, component
+// and sequence number, then the fields, sorted by key, the stack trace, and the Error Reporting type and service context.
+func (e *entry) appendPayload(b []byte) []byte {
+	if e.name != "" {
+		b = append(b, ',')
+		b = appendJSONString(b, orDefault(e.nameKey, "logger"))
+		b = append(b, ':')
+		b = appendJSONString(b, e.name)
+	}
+	if e.component != "" {
+		b = append(b, `,"`+componentKey+`":`...)
+		b = appendJSONString(b, e.component)
+	}
+	if e.seq != 0 {
+		b = append(b, `,"`+sequenceKey+`":`...)
+		b = strconv.AppendUint(b, e.seq, 10)
+	}
+	b = appendFields(b, fieldSet{e.fields, e.typed}, e.isReserved)
+	if e.stack != "" {
+		b = append(b, `,"`+stackTraceKey+`":`...)
+		b = appendJSONString(b, e.stack)
+	}
+	if e.reported {
+		b = append(b, `,"`+reportedErrorKey+`":"`+reportedErrorType+`"`...)
+		b = e.service.appendJSON(b)
+	}
+	return b
+}
+
+// appendLabels appends the labels to b as a JSON object member with the provided key, sorted by key.
+// Nothing is appended if there are no labels.
+func appendLabels(b []byte, key string, labels map[string]string) []byte {
+	if len(labels) == 0 {
+		return b
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b = appendMemberKey(b, key)
+	b = append(b, '{')
+	for i, k := range keys {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, k)
+		b = append(b, ':')
+		b = appendJSONString(b, labels[k])
+	}
+	return append(b, '}')
+}
+
+// isReserved reports whether the provided key is used by the entry itself, so can't be used by a structured field.
+func (e *entry) isReserved(k string) bool {
+	return reservedKeys[k] || strings.HasPrefix(k, reservedGCPPrefix) || k == e.severityKey || k == e.messageKey ||
+		(k == e.nameKey && e.name != "") ||
+		(k == componentKey && e.component != "") || (k == sequenceKey && e.seq != 0) ||
+		(k == stackTraceKey && e.stack != "") || (k == reportedErrorKey && e.reported) ||
+		(k == serviceContextKey && e.reported && e.service.service != "")
+}
+
+// fieldSet is the fields of an entry: a map of fields, and typed fields which replace those in the map with the same key.
+// Where typed fields share a key, the last one is used.
+type fieldSet struct {
+	m     map[string]any
+	typed []Field
+}
+
+// typedIndex returns the index of the last typed field with the key k, or -1 if there isn't one.
+func (s fieldSet) typedIndex(k string) int {
+	for i := len(s.typed) - 1; i >= 0; i-- {
+		if s.typed[i].Key == k {
+			return i
+		}
+	}
+	return -1
+}
+
+// has reports whether there's a field with the key k.
+func (s fieldSet) has(k string) bool {
+	if s.typedIndex(k) >= 0 {
+		return true
+	}
+	_, ok := s.m[k]
+	return ok
+}
+
+// appendValue appends the JSON encoding of the value of the field with the key k to b.
+func (s fieldSet) appendValue(b []byte, k string) []byte {
+	if i := s.typedIndex(k); i >= 0 {
+		return s.typed[i].appendJSON(b)
+	}
+	return appendJSONValue(b, s.m[k])
+}
+
+// appendFields appends each of the fields to b as a JSON member, sorted by key.
+// Any key for which reserved returns true is prefixed with "field_", unless that key is already used, in which case it's dropped.
+func appendFields(b []byte, fields fieldSet, reserved func(string) bool) []byte {
+	var stack [16]string
+	keys := stack[:0]
+	var renamed map[string]string // the original key of each renamed field, by its new key
+	add := func(k string) {
+		if reserved(k) {
+			if fields.has(reservedPrefix + k) {
+				return
+			}
+			if renamed == nil {
+				renamed = make(map[string]string)
+			}
+			renamed[reservedPrefix+k] = k
+			k = reservedPrefix + k
+		}
+		keys = append(keys, k)
+	}
+	for k := range fields.m {
+		if fields.typedIndex(k) < 0 {
+			add(k)
+		}
+	}
+	for i, f := range fields.typed {
+		if fields.typedIndex(f.Key) == i {
+			add(f.Key)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		orig := k
+		if o, ok := renamed[k]; ok {
+			orig = o
+		}
+		b = append(b, ',')
+		b = appendJSONString(b, k)
+		b = append(b, ':')
+		b = fields.appendValue(b, orig)
+	}
+	return b
+}
+
+// appendJSONValue appends the JSON encoding of v to b.
+// A Redactor is encoded as the value returned by its Redact method, and Redactors inside other values are replaced in the same way.
+// A LogFielder is encoded as an object of the fields it returns, which takes precedence over any other encoding it has.
+// An error is encoded as the string returned by its Error method, as errors rarely have exported fields for json.Marshal to use.
+// A fmt.Stringer is encoded as the string returned by its String method, unless it has its own JSON or text encoding, like time.Time.
+// If the Error or String method panics, for example on a nil pointer, then v is encoded as normal.
+// A json.RawMessage is spliced in as it is, apart from removing insignificant white space, or encoded as a string if it's not valid JSON.
+// Values which contain themselves, are nested too deeply, or hold things JSON can't represent, like functions, are encoded as
+// far as possible, with those parts replaced, as described by guard.
+func appendJSONValue(b []byte, v any) []byte {
+	switch t := v.(type) {
+	case string:
+		return appendJSONString(b, t)
+	case bool:
+		return strconv.AppendBool(b, t)
+	case int:
+		return strconv.AppendInt(b, int64(t), 10)
+	case int64:
+		return strconv.AppendInt(b, t, 10)
+	case float64:
+		return appendJSONFloat(b, t)
+	case Field:
+		return t.appendJSON(b)
+	case group:
+		return appendGroup(b, t)
+	case Redactor:
+		return appendJSONValue(b, redact(reflect.ValueOf(t), 0))
+	case LogFielder:
+		return appendGroup(b, logFielderGroup(t, 0))
+	case error:
+		if s, ok := safeString(t.Error); ok {
+			return appendJSONString(b, s)
+		}
+	case json.RawMessage:
+		return appendRawJSON(b, t)
+	case json.Marshaler, encoding.TextMarshaler:
+	case fmt.Stringer:
+		if s, ok := safeString(t.String); ok {
+			return appendJSONString(b, s)
+		}
+	}
+	v = prepareValue(v)
+	j, err := marshalGuarded(v)
+	if err != nil {
+		return appendJSONString(b, "("+reflect.TypeOf(v).String()+")")
+	}
+	return append(b, j...)
+}
+
+// safeString returns the result of fn, or false if it panics.
+func safeString(fn func() string) (s string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	return fn(), true
+}
+
+// appendRawJSON appends raw to b with any insignificant white space removed, so it can't break the entry across lines.
+// If raw is not valid JSON, then it's encoded as a string instead.
+func appendRawJSON(b []byte, raw json.RawMessage) []byte {
+	if !json.Valid(raw) {
+		return appendJSONValue(b, string(raw))
+	}
+	buf := bytes.NewBuffer(b)
+	_ = json.Compact(buf, raw)
+	return buf.Bytes()
+}
+
+// appendMemberKey appends a comma and the key of a JSON object member, followed by a colon, to b.
+func appendMemberKey(b []byte, key string) []byte {
+	b = append(b, ',')
+	b = appendJSONString(b, key)
+	return append(b, ':')
+}
+
+// orDefault returns s, or def if s is empty.
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// appendGroup appends the fields in g to b as a JSON object, sorted by key. Keys aren't reserved inside a group.
+func appendGroup(b []byte, g group) []byte {
+	start := len(b)
+	b = appendFields(b, fieldSet{m: g}, func(string) bool { return false })
+	if len(b) == start {
+		b = append(b, '{')
+	} else {
+		b[start] = '{' // replace the comma appendFields puts before the first field
+	}
+	return append(b, '}')
+}
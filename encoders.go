@@ -0,0 +1,81 @@
+package gcplog
+
+import "time"
+
+// FieldEncoder converts a structured field value before it's encoded as JSON.
+// It returns the value to encode in its place, and true, or false if it doesn't handle values of that type.
+type FieldEncoder func(v any) (any, bool)
+
+// WithFieldEncoder returns a new Logger which passes every structured field value, including those inside groups, through the provided encoder.
+// Values the encoder doesn't handle are encoded as normal. When there are several encoders, the most recently added is tried first,
+// and the first one to handle a value wins, so the value it returns isn't passed to the others. The original Logger is not changed.
+func (l *Logger) WithFieldEncoder(enc FieldEncoder) *Logger {
+	c := l.clone()
+	if enc == nil {
+		return c
+	}
+	encoders := make([]FieldEncoder, len(c.encoders), len(c.encoders)+1)
+	copy(encoders, c.encoders)
+	c.encoders = append(encoders, enc)
+	return c
+}
+
+// WithDurationEncoding returns a new Logger which encodes time.Duration field values in the provided format,
+// instead of with their String method, like "1m30s". The original Logger is not changed.
+func (l *Logger) WithDurationEncoding(f DurationFormat) *Logger {
+	return l.WithFieldEncoder(func(v any) (any, bool) {
+		d, ok := v.(time.Duration)
+		if !ok {
+			return nil, false
+		}
+		return formatDuration(d, f), true
+	})
+}
+
+// WithTimeEncoding returns a new Logger which encodes time.Time field values using the provided layout, as used by time.Time.Format,
+// instead of RFC 3339 with nanoseconds. The original Logger is not changed.
+func (l *Logger) WithTimeEncoding(layout string) *Logger {
+	return l.WithFieldEncoder(func(v any) (any, bool) {
+		t, ok := v.(time.Time)
+		if !ok {
+			return nil, false
+		}
+		return t.Format(layout), true
+	})
+}
+
+// encodeFields returns a copy of fields with every value, including those inside groups, passed through the encoders.
+func encodeFields(fields map[string]any, encoders []FieldEncoder) map[string]any {
+	out := make(map[string]any, len(fields))
+	for k, v := range fields {
+		if g, ok := v.(group); ok {
+			out[k] = group(encodeFields(g, encoders))
+			continue
+		}
+		out[k] = encodeValue(v, encoders)
+	}
+	return out
+}
+
+// encodeValue returns v passed through the first of the encoders to handle it, trying the most recently added first.
+// The encoders are passed the value of a Field, rather than the Field itself.
+func encodeValue(v any, encoders []FieldEncoder) any {
+	if f, ok := v.(Field); ok {
+		if enc, ok := encodeHandled(f.value(), encoders); ok {
+			return enc
+		}
+		return f
+	}
+	enc, _ := encodeHandled(v, encoders)
+	return enc
+}
+
+// encodeHandled returns v passed through the first of the encoders to handle it, and whether any did.
+func encodeHandled(v any, encoders []FieldEncoder) (any, bool) {
+	for i := len(encoders) - 1; i >= 0; i-- {
+		if enc, ok := encoders[i](v); ok {
+			return enc, true
+		}
+	}
+	return v, false
+}
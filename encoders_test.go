@@ -0,0 +1,74 @@
+package gcplog
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func ExampleLogger_WithDurationEncoding() {
+	logger := New(INFO).WithDurationEncoding(DurationSeconds)
+	logger.Printw("done", "took", 1500*time.Millisecond)
+	// Output:
+	// {"severity":"INFO","message":"done","took":"1.5s"}
+}
+
+func TestWithDurationEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.With("took", 90*time.Second).Print("default")
+	logger.WithDurationEncoding(DurationSeconds).With("took", 90*time.Second).Print("seconds")
+	logger.WithDurationEncoding(DurationMillis).WithGroup("req").Printw("millis", "took", 1500*time.Millisecond, "n", 3)
+	want := `{"severity":"INFO","message":"default","took":"1m30s"}` + "\n" +
+		`{"severity":"INFO","message":"seconds","took":"90s"}` + "\n" +
+		`{"severity":"INFO","message":"millis","req":{"n":3,"took":1500}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithTimeEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithTimeEncoding("2006-01-02 15:04")
+	logger.out = &buf
+	when := time.Date(2024, 3, 9, 17, 45, 30, 0, time.UTC)
+	logger.Printw("at", "when", when, "ptr", &when)
+	want := `{"severity":"INFO","message":"at","ptr":"2024-03-09T17:45:30Z","when":"2024-03-09 17:45"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestWithFieldEncoderChain(t *testing.T) {
+	var buf bytes.Buffer
+	upper := func(v any) (any, bool) {
+		s, ok := v.(string)
+		return "upper:" + s, ok
+	}
+	stringer := func(v any) (any, bool) {
+		s, ok := v.(fmt.Stringer)
+		if !ok {
+			return nil, false
+		}
+		return s.String(), true
+	}
+	logger := New(INFO).WithFieldEncoder(upper).WithFieldEncoder(nil).WithFieldEncoder(stringer).WithDurationEncoding(DurationMillis)
+	logger.out = &buf
+	logger.Printw("chained", "d", time.Second, "s", "x", "n", 1, "ip", address{})
+	want := `{"severity":"INFO","message":"chained","d":1000,"ip":"10.0.0.1","n":1,"s":"upper:x"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	base := New(INFO).WithFieldEncoder(upper)
+	base.WithFieldEncoder(stringer)
+	if len(base.encoders) != 1 {
+		t.Error("WithFieldEncoder changed the original Logger")
+	}
+}
+
+// address is a fmt.Stringer for testing encoders.
+type address struct{}
+
+func (address) String() string { return "10.0.0.1" }
@@ -0,0 +1,63 @@
+package gcplog
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errorChainKey is the key PrintError writes the chain of wrapped errors with.
+const errorChainKey = "errorChain"
+
+// maxErrorChain is the most errors PrintError includes in a chain, so an error which wraps itself can't be followed forever.
+const maxErrorChain = 32
+
+// errorLink is one error in the chain written by PrintError.
+type errorLink struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// PrintError writes a log message with the severity of the Logger, adding the message of the provided error in an "error" field,
+// in the same way as Err. If the error wraps others, with fmt.Errorf and %w or errors.Join, then an "errorChain" field is added too,
+// holding the message and type of the error and each one it wraps, in the order errors.Is checks them, for example:
+//
+//	"errorChain":[{"message":"save order: connection refused","type":"*fmt.wrapError"},{"message":"connection refused","type":"*net.OpError"}]
+//
+// A nil error adds neither field, so the entry is the same as Print(msg). The chain is limited to 32 errors.
+func (l *Logger) PrintError(msg string, err error) {
+	l.output(record{message: msg, fields: errorFields(err)})
+}
+
+// errorFields returns the structured fields PrintError adds for err.
+func errorFields(err error) map[string]any {
+	if err == nil {
+		return nil
+	}
+	fields := map[string]any{"error": Err(err)}
+	if chain := errorChain(err, nil); len(chain) > 1 {
+		fields[errorChainKey] = chain
+	}
+	return fields
+}
+
+// errorChain appends err, and each error it wraps, depth first, to chain.
+func errorChain(err error, chain []errorLink) []errorLink {
+	if err == nil || len(chain) == maxErrorChain {
+		return chain
+	}
+	typ := fmt.Sprintf("%T", err)
+	msg, ok := safeString(err.Error)
+	if !ok {
+		msg = "(" + typ + ")"
+	}
+	chain = append(chain, errorLink{Message: msg, Type: typ})
+	switch u := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, e := range u.Unwrap() {
+			chain = errorChain(e, chain)
+		}
+	default:
+		chain = errorChain(errors.Unwrap(err), chain)
+	}
+	return chain
+}
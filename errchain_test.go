@@ -0,0 +1,88 @@
+package gcplog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// notFoundError is a custom error type, which wraps the error that caused it.
+type notFoundError struct {
+	Key string
+	Err error
+}
+
+func (e *notFoundError) Error() string { return e.Key + " not found: " + e.Err.Error() }
+func (e *notFoundError) Unwrap() error { return e.Err }
+
+// loopError wraps itself.
+type loopError struct{}
+
+func (e loopError) Error() string { return "loop" }
+func (e loopError) Unwrap() error { return e }
+
+// nilError panics when its Error method is called on a nil pointer.
+type nilError struct{ msg string }
+
+func (e *nilError) Error() string { return e.msg }
+
+func TestPrintError(t *testing.T) {
+	base := errors.New("connection refused")
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ``},
+		{"plain", io.EOF, `,"error":"EOF"`},
+		{"custom", &notFoundError{Key: "order", Err: io.EOF},
+			`,"error":"order not found: EOF","errorChain":[` +
+				`{"message":"order not found: EOF","type":"*gcplog.notFoundError"},` +
+				`{"message":"EOF","type":"*errors.errorString"}]`},
+		{"wrapped", fmt.Errorf("save order: %w", base),
+			`,"error":"save order: connection refused","errorChain":[` +
+				`{"message":"save order: connection refused","type":"*fmt.wrapError"},` +
+				`{"message":"connection refused","type":"*errors.errorString"}]`},
+		{"three deep", fmt.Errorf("handle: %w", fmt.Errorf("save: %w", &notFoundError{Key: "order", Err: base})),
+			`,"error":"handle: save: order not found: connection refused","errorChain":[` +
+				`{"message":"handle: save: order not found: connection refused","type":"*fmt.wrapError"},` +
+				`{"message":"save: order not found: connection refused","type":"*fmt.wrapError"},` +
+				`{"message":"order not found: connection refused","type":"*gcplog.notFoundError"},` +
+				`{"message":"connection refused","type":"*errors.errorString"}]`},
+		{"joined", errors.Join(io.EOF, fmt.Errorf("b: %w", base)),
+			`,"error":"EOF\nb: connection refused","errorChain":[` +
+				`{"message":"EOF\nb: connection refused","type":"*errors.joinError"},` +
+				`{"message":"EOF","type":"*errors.errorString"},` +
+				`{"message":"b: connection refused","type":"*fmt.wrapError"},` +
+				`{"message":"connection refused","type":"*errors.errorString"}]`},
+		{"panicking", fmt.Errorf("wrap: %w", (*nilError)(nil)),
+			`,"error":"wrap: \u003cnil\u003e","errorChain":[` +
+				`{"message":"wrap: \u003cnil\u003e","type":"*fmt.wrapError"},` +
+				`{"message":"(*gcplog.nilError)","type":"*gcplog.nilError"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(ERROR)
+			logger.out = &buf
+			logger.PrintError("failed", tt.err)
+			want := `{"severity":"ERROR","message":"failed"` + tt.want + "}\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestPrintErrorLoop(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(ERROR)
+	logger.out = &buf
+	logger.PrintError("failed", loopError{})
+	if got := strings.Count(buf.String(), `"type":"gcplog.loopError"`); got != maxErrorChain {
+		t.Errorf("errorChain has %d errors, want %d: %s", got, maxErrorChain, buf.String())
+	}
+}
@@ -0,0 +1,344 @@
+package gcplog
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DurationFormat controls how durations are recorded by WithDuration and WithDurationEncoding.
+type DurationFormat int
+
+const (
+	DurationSeconds DurationFormat = iota // A string of seconds with an "s" suffix, like "1.5s", which is the format GCP uses for durations
+	DurationMillis                        // A number of milliseconds, like 1500
+)
+
+// LogFielder is implemented by types which control how they're logged, for example to include a curated set of fields and leave out secrets.
+// A structured field value which implements LogFielder is written as a JSON object of the fields it returns, in place of its usual JSON encoding.
+// Values inside the returned map which implement LogFielder are expanded in the same way, up to a depth of maxLogFielderDepth.
+type LogFielder interface {
+	LogFields() map[string]any
+}
+
+// maxLogFielderDepth is how deeply LogFielder values are expanded inside each other, which stops a value which includes itself looping forever.
+const maxLogFielderDepth = 8
+
+// maxDepthValue is used in place of a LogFielder value which is nested too deeply to be expanded.
+const maxDepthValue = "(MAX DEPTH)"
+
+// missingValue is used as the value of a trailing key passed to With, which has no value to go with it.
+const missingValue = "(MISSING)"
+
+// With returns a new Logger which adds the provided key/value pairs as structured fields to every log entry.
+// The arguments alternate between keys and values, for example:
+//
+//	logger.With("userId", 42, "ok", true)
+//
+// A Field, created by functions like String and Int, can be used in place of a key/value pair.
+// Keys which aren't strings are converted with fmt.Sprint. If there's an odd number of arguments,
+// then the final key is given the value "(MISSING)". Fields are written after the severity and message, sorted by key.
+// The original Logger is not changed.
+func (l *Logger) With(args ...any) *Logger {
+	fields := make(map[string]any, (len(args)+1)/2)
+	for i := 0; i < len(args); i++ {
+		if f, ok := args[i].(Field); ok {
+			fields[f.Key] = f
+			continue
+		}
+		k := fmt.Sprint(args[i])
+		if i+1 < len(args) {
+			fields[k] = args[i+1]
+			i++
+		} else {
+			fields[k] = missingValue
+		}
+	}
+	return l.WithFields(fields)
+}
+
+// WithField returns a new Logger which adds the provided key and value as a structured field to every log entry.
+// The original Logger is not changed.
+func (l *Logger) WithField(key string, value any) *Logger {
+	c := l.clone()
+	if c.fieldsCap > 0 && len(c.groups) == 0 {
+		c.pending, c.pendingTo = appendPending(c.pending, c.pendingTo, fieldPair{key, value}, c.fieldsCap)
+		return c
+	}
+	c.addFields(map[string]any{key: value})
+	return c
+}
+
+// WithFieldsCapacity returns a new Logger which expects around n more fields to be added to it, one at a time, by WithField.
+// Normally each call to WithField copies all of the fields of the Logger, so a request-scoped Logger built up with many
+// calls copies its fields many times. With a capacity hint, WithField appends to a list with room for n fields instead,
+// which is merged with the other fields once, when the first entry is written. It's only a hint, and never limits
+// the number of fields. A hint of zero or less turns this off. The original Logger is not changed.
+func (l *Logger) WithFieldsCapacity(n int) *Logger {
+	c := l.clone()
+	c.fieldsCap = max(n, 0)
+	return c
+}
+
+// fieldPair is a structured field added by WithField, which hasn't been merged into the fields of its Logger yet.
+type fieldPair struct {
+	key   string
+	value any
+}
+
+// pendingFields holds the fields added by a chain of WithField calls on Loggers with a capacity hint.
+// Each Logger in the chain sees a prefix of pairs, which is never changed. Only a Logger which sees all of pairs
+// can append to it, so appending never changes the fields of another Logger.
+type pendingFields struct {
+	mu    sync.Mutex
+	pairs []fieldPair
+}
+
+// appendPending returns the pending fields with p added, and where they're held. If to holds nothing after pending,
+// then p is appended to it, otherwise the fields are copied to a new pendingFields with room for at least size fields.
+func appendPending(pending []fieldPair, to *pendingFields, p fieldPair, size int) ([]fieldPair, *pendingFields) {
+	if to != nil {
+		to.mu.Lock()
+		defer to.mu.Unlock()
+		if len(to.pairs) == len(pending) {
+			to.pairs = append(to.pairs, p)
+			return to.pairs, to
+		}
+	}
+	pairs := make([]fieldPair, len(pending), max(len(pending)+1, size))
+	copy(pairs, pending)
+	to = &pendingFields{pairs: append(pairs, p)}
+	return to.pairs, to
+}
+
+// flushPending merges any pending fields into the fields of the Logger, and returns them.
+func (l *Logger) flushPending() map[string]any {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) > 0 {
+		l.fields = mergePending(l.fields, l.pending)
+		l.pending, l.pendingTo = nil, nil
+	}
+	return l.fields
+}
+
+// mergePending returns a new map holding the fields in a, replaced or added to by the pending fields, in order.
+func mergePending(a map[string]any, pending []fieldPair) map[string]any {
+	merged := make(map[string]any, len(a)+len(pending))
+	for k, v := range a {
+		merged[k] = v
+	}
+	for _, p := range pending {
+		merged[p.key] = p.value
+	}
+	return merged
+}
+
+// WithFields returns a new Logger which adds the provided map as structured fields to every log entry.
+// Fields are written after the message, sorted by key, and replace any existing fields with the same key.
+// Fields which would overwrite a key used by the package itself or by Cloud Logging, like "severity", "message", "time"
+// or any key starting with "logging.googleapis.com/", are prefixed with "field_", and reported to the error handler.
+// The original Logger is not changed.
+func (l *Logger) WithFields(fields map[string]any) *Logger {
+	c := l.clone()
+	c.addFields(fields)
+	return c
+}
+
+// addFields adds the provided fields to the open group of a Logger which hasn't been shared yet, merging in any pending fields first.
+func (l *Logger) addFields(fields map[string]any) {
+	if len(l.pending) > 0 {
+		l.fields = mergePending(l.fields, l.pending)
+		l.pending, l.pendingTo = nil, nil
+	}
+	l.fields = mergeGroup(l.fields, l.groups, fields)
+}
+
+// Reset clears the per-request state of the Logger in place, so it can be reused, for example from a sync.Pool.
+// It clears the structured fields, open groups, labels and Cloud Trace span, including the span ID and sampling decision.
+// Everything else is kept, including the severity, writers, name, component, sampling, buffering, source locations,
+// field and label settings, and the capacity hint from WithFieldsCapacity.
+// Loggers created from this one before Reset was called keep their fields, labels and span.
+func (l *Logger) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fields, l.groups, l.pending, l.pendingTo = nil, nil, nil, nil
+	l.labels = nil
+	l.trace = traceContext{}
+}
+
+// WithGroup returns a new Logger which nests any structured fields added after it, by methods like With, Printw and Printm,
+// inside a JSON object with the provided name. For example:
+//
+//	logger.WithGroup("db").With("query", q, "rows", n)
+//
+// adds {"db":{"query":…,"rows":…}} to every log entry. Groups can be nested by calling WithGroup again, and a group
+// with no fields in it is left out. An empty name returns a Logger with the same groups. The original Logger is not changed.
+func (l *Logger) WithGroup(name string) *Logger {
+	c := l.clone()
+	if name != "" {
+		c.groups = append(c.groups[:len(c.groups):len(c.groups)], name)
+	}
+	return c
+}
+
+// Printw writes a log message with the severity of the Logger, adding the provided key/value pairs as structured fields
+// to this entry only. The arguments alternate between keys and values, for example:
+//
+//	logger.Printw("order saved", "orderId", 1234, "items", 3)
+//
+// A Field can be used in place of a key/value pair.
+// These fields replace any fields of the Logger with the same key. Keys must be strings: an argument in the key position
+// which isn't a string, or a final key without a value, is written as the value of a "!BADKEY" field instead.
+func (l *Logger) Printw(msg string, keysAndValues ...any) {
+	l.output(record{message: msg, fields: pairsToFields(keysAndValues)})
+}
+
+// Printm writes a log message with the severity of the Logger, adding the provided map as structured fields to this entry only.
+// Fields are written sorted by key, and nested maps and slices are written as nested JSON. The fields replace any fields
+// of the Logger with the same key, and keys used by the package itself are prefixed with "field_". A nil map is the same as Print.
+// Floats which JSON can't represent are written as the strings "NaN", "+Inf" and "-Inf", wherever they are, so the entry is never lost.
+func (l *Logger) Printm(msg string, fields map[string]any) {
+	l.output(record{message: msg, fields: fields})
+}
+
+// badKey is the key used by Printw for arguments which aren't in a valid key/value pair.
+const badKey = "!BADKEY"
+
+// pairsToFields converts alternating key/value arguments into a map of fields, as described by Printw.
+func pairsToFields(args []any) map[string]any {
+	fields := make(map[string]any, (len(args)+1)/2)
+	var bad []any
+	for i := 0; i < len(args); i++ {
+		if f, ok := args[i].(Field); ok {
+			fields[f.Key] = f
+			continue
+		}
+		k, ok := args[i].(string)
+		if !ok || i+1 == len(args) {
+			bad = append(bad, args[i])
+			continue
+		}
+		fields[k] = args[i+1]
+		i++
+	}
+	switch len(bad) {
+	case 0:
+	case 1:
+		fields[badKey] = bad[0]
+	default:
+		fields[badKey] = bad
+	}
+	return fields
+}
+
+// group is a set of structured fields nested inside another, created by WithGroup.
+// It's a distinct type so it can't be confused with a map provided as the value of a field.
+type group map[string]any
+
+// logFielderGroup returns the fields of v as a group, with any LogFielder values inside them expanded as well, up to maxLogFielderDepth.
+func logFielderGroup(v LogFielder, depth int) group {
+	fields := v.LogFields()
+	g := make(group, len(fields))
+	for k, fv := range fields {
+		if lf, ok := fv.(LogFielder); ok {
+			if depth+1 >= maxLogFielderDepth {
+				g[k] = maxDepthValue
+			} else {
+				g[k] = logFielderGroup(lf, depth+1)
+			}
+			continue
+		}
+		g[k] = fv
+	}
+	return g
+}
+
+// rewriteFields returns fields with each value replaced by the result of value, which reports whether it changed the value, and whether any changed.
+// If none did, then fields itself is returned, otherwise a copy is, as fields are shared between entries.
+func rewriteFields(fields map[string]any, value func(any) (any, bool)) (map[string]any, bool) {
+	var rewritten map[string]any
+	for k, v := range fields {
+		rv, ok := value(v)
+		if !ok {
+			continue
+		}
+		if rewritten == nil {
+			rewritten = make(map[string]any, len(fields))
+			for k, v := range fields {
+				rewritten[k] = v
+			}
+		}
+		rewritten[k] = rv
+	}
+	if rewritten == nil {
+		return fields, false
+	}
+	return rewritten, true
+}
+
+// mergeGroup returns a new map holding the fields in a, with the fields in b added to the group at the provided path.
+// Each group along the path is copied rather than changed. If b is empty, then a is returned, so empty groups aren't created.
+func mergeGroup(a map[string]any, path []string, b map[string]any) map[string]any {
+	if len(b) == 0 {
+		return a
+	}
+	if len(path) == 0 {
+		return mergeFields(a, b)
+	}
+	inner, _ := a[path[0]].(group)
+	return mergeFields(a, map[string]any{path[0]: group(mergeGroup(inner, path[1:], b))})
+}
+
+// mergeFields returns a new map holding the fields in a, replaced or added to by the fields in b.
+func mergeFields(a, b map[string]any) map[string]any {
+	merged := make(map[string]any, len(a)+len(b))
+	for k, v := range a {
+		merged[k] = v
+	}
+	for k, v := range b {
+		merged[k] = v
+	}
+	return merged
+}
+
+// WithDuration returns a new Logger which adds the provided duration as a structured field to every log entry.
+// The duration is recorded in the format set by WithDurationFormat, which is a string of seconds, like "1.5s", by default.
+// The original Logger is not changed.
+func (l *Logger) WithDuration(key string, d time.Duration) *Logger {
+	l.mu.RLock()
+	f := l.durfmt
+	l.mu.RUnlock()
+	return l.WithField(key, formatDuration(d, f))
+}
+
+// WithDurationFormat returns a new Logger which records durations passed to WithDuration in the provided format.
+// The original Logger is not changed.
+func (l *Logger) WithDurationFormat(f DurationFormat) *Logger {
+	c := l.clone()
+	c.durfmt = f
+	return c
+}
+
+// Timer returns a function which writes a log message with the provided name, and the time elapsed since Timer was called
+// as an "elapsed" field. It's designed to be deferred, for example:
+//
+//	defer logger.Timer("saveOrder")()
+func (l *Logger) Timer(name string) func() {
+	l.mu.RLock()
+	clock := l.clock
+	l.mu.RUnlock()
+	start := now(clock)
+	return func() {
+		l.WithDuration("elapsed", now(clock).Sub(start)).output(record{message: name}) // called directly, so the source location is the caller's
+	}
+}
+
+// formatDuration returns the provided duration in the provided format.
+func formatDuration(d time.Duration, f DurationFormat) any {
+	if f == DurationMillis {
+		return float64(d) / float64(time.Millisecond)
+	}
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
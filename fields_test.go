@@ -0,0 +1,595 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWith(t *testing.T) {
+	tests := []struct {
+		name string
+		args []any
+		want string
+	}{
+		{"pairs", []any{"userId", 42, "ok", true}, `{"severity":"INFO","message":"Hello World","ok":true,"userId":42}`},
+		{"odd", []any{"userId", 42, "trailing"}, `{"severity":"INFO","message":"Hello World","trailing":"(MISSING)","userId":42}`},
+		{"non-string key", []any{7, "seven", 1.5, "float"}, `{"severity":"INFO","message":"Hello World","1.5":"float","7":"seven"}`},
+		{"repeated key", []any{"a", 1, "a", 2}, `{"severity":"INFO","message":"Hello World","a":2}`},
+		{"reserved key", []any{"severity", "EMERGENCY", "message", "hi"}, `{"severity":"INFO","message":"Hello World","field_message":"hi","field_severity":"EMERGENCY"}`},
+		{"none", nil, `{"severity":"INFO","message":"Hello World"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO)
+			logger.out = &buf
+			logger.With(tt.args...).Print("Hello World")
+			if got := buf.String(); got != tt.want+"\n" {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithDoesNotChangeParent(t *testing.T) {
+	var buf bytes.Buffer
+	parent := New(INFO).WithField("a", 1)
+	parent.out = &buf
+	child := parent.WithFields(map[string]any{"a": 2, "b": 3})
+	child.Print("child")
+	parent.Print("parent")
+	want := `{"severity":"INFO","message":"child","a":2,"b":3}` + "\n" +
+		`{"severity":"INFO","message":"parent","a":1}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := parent.Counts()[INFO]; got != 2 {
+		t.Errorf("parent Counts()[INFO] = %d, want 2", got)
+	}
+}
+
+func ExampleLogger_With() {
+	logger := New(INFO)
+	logger.With("userId", 42, "ok", true).Print("Hello World")
+	// Output:
+	// {"severity":"INFO","message":"Hello World","ok":true,"userId":42}
+}
+
+func ExampleLogger_WithGroup() {
+	logger := New(INFO).WithGroup("http")
+	logger.WithField("method", "GET").WithField("status", 200).WithGroup("client").WithField("ip", "10.0.0.1").Print("request")
+	// Output:
+	// {"severity":"INFO","message":"request","http":{"client":{"ip":"10.0.0.1"},"method":"GET","status":200}}
+}
+
+func TestWithDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		format DurationFormat
+		d      time.Duration
+		want   string
+	}{
+		{"seconds", DurationSeconds, 1500 * time.Millisecond, `"1.5s"`},
+		{"whole seconds", DurationSeconds, 2 * time.Second, `"2s"`},
+		{"nanoseconds", DurationSeconds, time.Nanosecond, `"0.000000001s"`},
+		{"zero", DurationSeconds, 0, `"0s"`},
+		{"negative", DurationSeconds, -time.Second, `"-1s"`},
+		{"millis", DurationMillis, 1500 * time.Millisecond, `1500`},
+		{"fractional millis", DurationMillis, 1500 * time.Microsecond, `1.5`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO).WithDurationFormat(tt.format)
+			logger.out = &buf
+			logger.WithDuration("took", tt.d).Print("Hello World")
+			want := `{"severity":"INFO","message":"Hello World","took":` + tt.want + "}\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestTimerSourceLocation(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithSourceLocation(INFO).WithStackTraces(INFO)
+	logger.out = &buf
+	func() {
+		defer logger.Timer("x")()
+	}()
+	var e struct {
+		Source sourceLocation `json:"logging.googleapis.com/sourceLocation"`
+		Stack  string         `json:"stack_trace"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	const caller = "github.com/tinyinput/gcplog.TestTimerSourceLocation.func1"
+	if e.Source.Function != caller || !strings.HasSuffix(e.Source.File, "/fields_test.go") {
+		t.Errorf("source location = %+v, want the deferring function", e.Source)
+	}
+	if frames := strings.Split(e.Stack, "\n"); len(frames) < 2 || frames[1] != caller+"(...)" {
+		t.Errorf("stack trace starts %q, want the deferring function", frames[:min(len(frames), 2)])
+	}
+}
+
+func TestTimer(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	func() {
+		defer logger.Timer("work")()
+		time.Sleep(time.Millisecond)
+	}()
+	var e struct {
+		Message string
+		Elapsed string
+	}
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if e.Message != "work" {
+		t.Errorf("message = %q, want %q", e.Message, "work")
+	}
+	d, err := time.ParseDuration(e.Elapsed)
+	if err != nil || !strings.HasSuffix(e.Elapsed, "s") {
+		t.Fatalf("elapsed = %q isn't a duration in seconds", e.Elapsed)
+	}
+	if d < time.Millisecond {
+		t.Errorf("elapsed = %v, want at least 1ms", d)
+	}
+}
+
+func TestWithValueTypes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.With(
+		"string", "text",
+		"int", -7,
+		"uint64", uint64(18446744073709551615),
+		"float", 1.25,
+		"bool", false,
+		"error", errors.New("it broke"),
+		"when", time.Date(2024, 2, 29, 13, 14, 15, 500, time.UTC),
+		"nil", nil,
+	).Print("Hello World")
+	want := `{"severity":"INFO","message":"Hello World","bool":false,"error":"it broke","float":1.25,"int":-7,"nil":null,` +
+		`"string":"text","uint64":18446744073709551615,"when":"2024-02-29T13:14:15.0000005Z"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithChained(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	req := logger.With("order_id", 1234, "user", "ann")
+	step := req.With("step", "save").With("user", "bob")
+	step.Print("child")
+	req.Print("parent")
+	logger.Print("root")
+	want := `{"severity":"INFO","message":"child","order_id":1234,"step":"save","user":"bob"}` + "\n" +
+		`{"severity":"INFO","message":"parent","order_id":1234,"user":"ann"}` + "\n" +
+		`{"severity":"INFO","message":"root"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithFieldsCapacity(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).With("service", "orders")
+	logger.out = &buf
+	req := logger.WithFieldsCapacity(2)
+	a := req.WithField("order_id", 1234)
+	b := a.WithField("user", "ann").WithField("step", 1).WithField("step", 2)
+	c := a.WithField("user", "bob")
+	d := b.With("done", true).WithGroup("db").WithField("rows", 3)
+	c.Print("c")
+	b.Print("b")
+	b.WithField("extra", "x").Print("b extra")
+	d.Print("d")
+	a.Print("a")
+	req.Print("req")
+	logger.WithFieldsCapacity(-1).WithField("n", 1).Print("negative")
+	want := `{"severity":"INFO","message":"c","order_id":1234,"service":"orders","user":"bob"}` + "\n" +
+		`{"severity":"INFO","message":"b","order_id":1234,"service":"orders","step":2,"user":"ann"}` + "\n" +
+		`{"severity":"INFO","message":"b extra","extra":"x","order_id":1234,"service":"orders","step":2,"user":"ann"}` + "\n" +
+		`{"severity":"INFO","message":"d","db":{"rows":3},"done":true,"order_id":1234,"service":"orders","step":2,"user":"ann"}` + "\n" +
+		`{"severity":"INFO","message":"a","order_id":1234,"service":"orders"}` + "\n" +
+		`{"severity":"INFO","message":"req","service":"orders"}` + "\n" +
+		`{"severity":"INFO","message":"negative","n":1,"service":"orders"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if len(b.pending) != 0 {
+		t.Errorf("writing an entry left %d pending fields", len(b.pending))
+	}
+}
+
+func TestReset(t *testing.T) {
+	var buf bytes.Buffer
+	base := New(WARNING).WithComponent("orders").WithSequenceNumbers()
+	base.out = &buf
+	logger := base.WithFieldsCapacity(2).With("user", "ann").WithLabel("env", "prod").WithTrace("p", "t").WithSpanID("s").WithGroup("db").WithField("rows", 3)
+	logger = logger.WithField("pending", true)
+	child := logger.WithField("child", true)
+	logger.Reset()
+	logger.Print("reset")
+	logger.WithField("after", 1).Print("after")
+	child.Print("child")
+	want := `{"severity":"WARNING","message":"reset","component":"orders","seq":1}` + "\n" +
+		`{"severity":"WARNING","message":"after","component":"orders","seq":2,"after":1}` + "\n" +
+		`{"severity":"WARNING","message":"child","component":"orders","seq":3,"db":{"child":true,"pending":true,"rows":3},"user":"ann",` +
+		`"logging.googleapis.com/labels":{"env":"prod"},"logging.googleapis.com/trace":"projects/p/traces/t","logging.googleapis.com/spanId":"s",` +
+		`"logging.googleapis.com/trace_sampled":true}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithFieldsCapacityConcurrent(t *testing.T) {
+	var buf syncBuffer
+	logger := New(INFO).WithFieldsCapacity(4)
+	logger.out = &buf
+	parent := logger.WithField("a", 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			parent.WithField("b", i).WithField("c", i).Print("child")
+			parent.Print("parent")
+		}(i)
+	}
+	wg.Wait()
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		switch entry["message"] {
+		case "parent":
+			if len(entry) != 3 {
+				t.Errorf("parent entry has another Logger's fields: %s", line)
+			}
+		case "child":
+			if entry["b"] != entry["c"] {
+				t.Errorf("child entry has another Logger's fields: %s", line)
+			}
+		}
+	}
+}
+
+func benchmarkWithField(b *testing.B, capacity int) {
+	logger := New(INFO).WithFieldsCapacity(capacity)
+	keys := make([]string, 10)
+	for i := range keys {
+		keys[i] = "field" + strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := logger
+		for j, k := range keys {
+			l = l.WithField(k, j)
+		}
+	}
+}
+
+func BenchmarkWithField(b *testing.B)         { benchmarkWithField(b, 0) }
+func BenchmarkWithFieldCapacity(b *testing.B) { benchmarkWithField(b, 10) }
+
+func TestWithConcurrent(t *testing.T) {
+	var buf syncBuffer
+	parent := New(INFO).With("parent", true)
+	parent.out = &buf
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			child := parent.With("child", i)
+			for j := 0; j < 20; j++ {
+				child = child.With("j", j)
+				child.Print("child")
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				parent.Print("parent")
+			}
+		}()
+	}
+	wg.Wait()
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		_, hasChild := e["child"]
+		if hasChild != (e["message"] == "child") || e["parent"] != true {
+			t.Errorf("unexpected fields in %s", line)
+		}
+	}
+}
+
+func TestPrintw(t *testing.T) {
+	tests := []struct {
+		name string
+		args []any
+		want string
+	}{
+		{"pairs", []any{"orderId", 1234, "ok", true}, `"ok":true,"orderId":1234,"user":"ann"`},
+		{"odd", []any{"orderId", 1234, "trailing"}, `"!BADKEY":"trailing","orderId":1234,"user":"ann"`},
+		{"non-string key", []any{42, "orderId", 1234}, `"!BADKEY":42,"orderId":1234,"user":"ann"`},
+		{"several bad", []any{42, 43, "orderId", 1234, "trailing"}, `"!BADKEY":[42,43,"trailing"],"orderId":1234,"user":"ann"`},
+		{"conflict with With", []any{"user", "bob"}, `"user":"bob"`},
+		{"none", nil, `"user":"ann"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO).With("user", "ann")
+			logger.out = &buf
+			logger.Printw("Hello World", tt.args...)
+			logger.Print("again")
+			want := `{"severity":"INFO","message":"Hello World",` + tt.want + "}\n" +
+				`{"severity":"INFO","message":"again","user":"ann"}` + "\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestRawMessageFields(t *testing.T) {
+	audit := json.RawMessage(`{
+		"actor": {"id": 7, "roles": ["admin", {"scope": "all"}]},
+		"ok": true
+	}`)
+	invalid := json.RawMessage(`{"actor": `)
+	var buf bytes.Buffer
+	logger := New(NOTICE)
+	logger.out = &buf
+	logger.With("audit", audit).Print("with")
+	logger.Printw("printw", "audit", audit, "invalid", invalid)
+	logger.PrintJSON("json", map[string]any{"audit": audit})
+	logger.With("invalid", invalid, "empty", json.RawMessage(nil)).Print("invalid")
+	compact := `{"actor":{"id":7,"roles":["admin",{"scope":"all"}]},"ok":true}`
+	want := `{"severity":"NOTICE","message":"with","audit":` + compact + "}\n" +
+		`{"severity":"NOTICE","message":"printw","audit":` + compact + `,"invalid":"{\"actor\": "}` + "\n" +
+		`{"severity":"NOTICE","message":"json","audit":` + compact + "}\n" +
+		`{"severity":"NOTICE","message":"invalid","empty":"","invalid":"{\"actor\": "}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("invalid JSON entry %s", line)
+		}
+	}
+}
+
+func TestPrintm(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]any
+		want   string
+	}{
+		{"nil", nil, `"user":"ann"`},
+		{"empty", map[string]any{}, `"user":"ann"`},
+		{"nested", map[string]any{"http": map[string]any{"status": 200, "path": "/"}, "ids": []any{1, "two", []int{3}}}, `"http":{"path":"/","status":200},"ids":[1,"two",[3]],"user":"ann"`},
+		{"ordering", map[string]any{"b": 2, "a": 1, "c": 3, "A": 0}, `"A":0,"a":1,"b":2,"c":3,"user":"ann"`},
+		{"reserved", map[string]any{"message": "spoof", labelsKey: "spoof"}, `"field_logging.googleapis.com/labels":"spoof","field_message":"spoof","user":"ann"`},
+		{"override", map[string]any{"user": "bob"}, `"user":"bob"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for run := 0; run < 20; run++ {
+				var buf bytes.Buffer
+				logger := New(INFO).With("user", "ann")
+				logger.out = &buf
+				logger.Printm("Hello World", tt.fields)
+				want := `{"severity":"INFO","message":"Hello World",` + tt.want + "}\n"
+				if got := buf.String(); got != want {
+					t.Fatalf("run %d got:\n%s\nwant:\n%s", run, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		logger func(*Logger) *Logger
+		want   string
+	}{
+		{"group", func(l *Logger) *Logger { return l.WithGroup("db").With("query", "select", "rows", 3) },
+			`"db":{"query":"select","rows":3}`},
+		{"nested", func(l *Logger) *Logger { return l.WithGroup("a").WithGroup("b").With("x", 1) },
+			`"a":{"b":{"x":1}}`},
+		{"fields at each level", func(l *Logger) *Logger { return l.With("x", 0).WithGroup("a").With("x", 1).WithGroup("b").With("x", 2) },
+			`"a":{"b":{"x":2},"x":1},"x":0`},
+		{"empty group", func(l *Logger) *Logger { return l.WithGroup("empty") }, ``},
+		{"empty nested group", func(l *Logger) *Logger { return l.WithGroup("a").With("x", 1).WithGroup("b").WithGroup("c") },
+			`"a":{"x":1}`},
+		{"empty name", func(l *Logger) *Logger { return l.WithGroup("").With("x", 1) }, `"x":1`},
+		{"WithField", func(l *Logger) *Logger {
+			return l.WithGroup("http").WithField("method", "GET").WithField("status", 200)
+		},
+			`"http":{"method":"GET","status":200}`},
+		{"WithFields", func(l *Logger) *Logger {
+			return l.WithGroup("a").WithGroup("b").WithFields(map[string]any{"x": 1, "y": 2})
+		},
+			`"a":{"b":{"x":1,"y":2}}`},
+		{"typed fields", func(l *Logger) *Logger { return l.WithGroup("http").With(String("method", "GET"), Int("status", 200)) },
+			`"http":{"method":"GET","status":200}`},
+		{"reserved keys inside", func(l *Logger) *Logger { return l.WithGroup("g").With("message", "ok", "severity", "ok") },
+			`"g":{"message":"ok","severity":"ok"}`},
+		{"reserved group name", func(l *Logger) *Logger { return l.WithGroup("message").With("x", 1) },
+			`"field_message":{"x":1}`},
+		{"map value isn't a group", func(l *Logger) *Logger {
+			return l.With("g", map[string]any{"y": 2}).WithGroup("g").With("x", 1)
+		}, `"g":{"x":1}`},
+		{"values inside", func(l *Logger) *Logger {
+			return l.WithGroup("g").With("err", errors.New("broke"), "raw", json.RawMessage(`{"a": 1}`))
+		}, `"g":{"err":"broke","raw":{"a":1}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO)
+			logger.out = &buf
+			tt.logger(logger).Print("Hello World")
+			want := `{"severity":"INFO","message":"Hello World"` + tt.want + "}\n"
+			if tt.want != "" {
+				want = `{"severity":"INFO","message":"Hello World",` + tt.want + "}\n"
+			}
+			if got := buf.String(); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestWithGroupPerCallFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	g := logger.With("top", 1).WithGroup("req").With("id", 7).WithGroup("db")
+	g.Printw("printw", "rows", 3)
+	g.Printm("printm", map[string]any{"rows": 4})
+	g.PrintJSON("json", map[string]int{"rows": 5})
+	g.Printw("none")
+	want := `{"severity":"INFO","message":"printw","req":{"db":{"rows":3},"id":7},"top":1}` + "\n" +
+		`{"severity":"INFO","message":"printm","req":{"db":{"rows":4},"id":7},"top":1}` + "\n" +
+		`{"severity":"INFO","message":"json","req":{"db":{"rows":5},"id":7},"top":1}` + "\n" +
+		`{"severity":"INFO","message":"none","req":{"id":7},"top":1}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFieldOrderDeterministic(t *testing.T) {
+	logger := New(INFO).With("zeta", 1, "alpha", "a", "Mid", true, "beta", nil).
+		WithGroup("req").With("path", "/x", "method", "GET").
+		WithLabels(map[string]string{"z": "1", "a": "2"})
+	want := `{"severity":"INFO","message":"order","Mid":true,"alpha":"a","beta":null,"req":{"id":7,"method":"GET","path":"/x"},"zeta":1,` +
+		`"logging.googleapis.com/labels":{"a":"2","z":"1"}}` + "\n"
+	for i := 0; i < 50; i++ {
+		var buf bytes.Buffer
+		logger.out = &buf
+		logger.Printw("order", "id", 7)
+		if got := buf.String(); got != want {
+			t.Fatalf("attempt %d got:\n%s\nwant:\n%s", i, got, want)
+		}
+	}
+}
+
+// status is a fmt.Stringer with no exported fields, like many errors.
+type status struct{ code int }
+
+func (s *status) String() string { return "status " + strconv.Itoa(s.code) }
+
+// codedError is an error type with no exported fields.
+type codedError struct{ code int }
+
+func (e *codedError) Error() string { return "code " + strconv.Itoa(e.code) }
+
+func TestWithFieldsErrorAndStringer(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.WithFields(map[string]any{
+		"err":        &codedError{404},
+		"wrapped":    fmt.Errorf("fetch: %w", &codedError{500}),
+		"status":     &status{200},
+		"nil_status": (*status)(nil),
+		"nil_err":    (*codedError)(nil),
+		"ip":         netip.MustParseAddr("10.0.0.1"),
+	}).Print("Hello World")
+	want := `{"severity":"INFO","message":"Hello World","err":"code 404","ip":"10.0.0.1","nil_err":null,"nil_status":null,` +
+		`"status":"status 200","wrapped":"fetch: code 500"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// auditedOrder implements LogFielder to log a curated set of fields, leaving out the card number its MarshalJSON includes.
+type auditedOrder struct {
+	ID   int
+	Card string
+	User *user
+}
+
+func (o auditedOrder) LogFields() map[string]any { return map[string]any{"id": o.ID, "user": o.User} }
+
+func (o auditedOrder) MarshalJSON() ([]byte, error) {
+	return []byte(`{"id":` + strconv.Itoa(o.ID) + `,"card":"` + o.Card + `"}`), nil
+}
+
+// user implements LogFielder, and is nested inside auditedOrder.
+type user struct{ Name, Password string }
+
+func (u *user) LogFields() map[string]any { return map[string]any{"name": u.Name} }
+
+// loop implements LogFielder by including itself.
+type loop struct{}
+
+func (l loop) LogFields() map[string]any { return map[string]any{"next": l} }
+
+func TestLogFielder(t *testing.T) {
+	o := auditedOrder{ID: 7, Card: "4111111111111111", User: &user{"ann", "hunter2"}}
+	want := `"order":{"id":7,"user":{"name":"ann"}}`
+	paths := map[string]func(l *Logger){
+		"With":          func(l *Logger) { l.With("order", o).Print("Hello World") },
+		"Printw":        func(l *Logger) { l.Printw("Hello World", "order", o) },
+		"Printm":        func(l *Logger) { l.Printm("Hello World", map[string]any{"order": o}) },
+		"PrintJSON key": func(l *Logger) { l.WithJSONKey("order").PrintJSON("Hello World", o) },
+	}
+	for name, path := range paths {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO)
+			logger.out = &buf
+			path(logger)
+			got := buf.String()
+			if !strings.Contains(got, want) || strings.Contains(got, "4111") || strings.Contains(got, "hunter2") {
+				t.Errorf("got %s, want it to contain %s", got, want)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.PrintJSON("merged", o)
+	if got, want := buf.String(), `{"severity":"INFO","message":"merged","id":7,"user":{"name":"ann"}}`+"\n"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestLogFielderDepth(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.With("loop", loop{}).Print("Hello World")
+	want := `{"severity":"INFO","message":"Hello World","loop":` + strings.Repeat(`{"next":`, maxLogFielderDepth) + `"(MAX DEPTH)"` +
+		strings.Repeat("}", maxLogFielderDepth) + "}\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
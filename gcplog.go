@@ -65,10 +65,21 @@
 package gcplog
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unicode"
+	"unsafe"
 )
 
 const (
@@ -84,123 +95,1112 @@ const (
 	ALERT     string = "ALERT"
 	EMERGENCY string = "EMERGENCY"
 	DEBUG     string = "DEBUG"
+	TRACE     string = "TRACE" // Not a GCP severity level, so it's written as DEBUG with a "gcplog_level" label of "TRACE"
 )
 
 var (
-	severityAll = [9]string{DEFAULT, INFO, NOTICE, WARNING, ERROR, CRITICAL, ALERT, EMERGENCY, DEBUG} // A variable to contain all valid severity levels
+	ErrInvalidSeverity = errors.New("gcplog: invalid severity")          // Returned, wrapped with more detail, when a severity level isn't valid
+	ErrReservedKey     = errors.New("gcplog: field uses a reserved key") // Reported, wrapped with more detail, when a structured field uses a reserved key
+	ErrInvalidLabel    = errors.New("gcplog: invalid label key")         // Reported, wrapped with more detail, when a label is dropped by SetStrictLabels
+	ErrClosedOutput    = errors.New("gcplog: output is closed")          // Returned, wrapping the write error, when an entry is dropped because its output was closed
+	ErrInvalidRemap    = errors.New("gcplog: invalid severity remap")    // Returned, wrapped with more detail, by TryWithSeverityRemap when a pair would be ignored
 )
 
-// gcpLogMessage is a simple struct type to represent part of the standard GCP logging structure.
-type gcpLogMessage struct {
-	Severity string `json:"severity"`
-	Message  string `json:"message"`
-}
+var (
+	severityAll     = [10]string{DEFAULT, TRACE, DEBUG, INFO, NOTICE, WARNING, ERROR, CRITICAL, ALERT, EMERGENCY} // A variable to contain all valid severity levels, in order
+	severityAliases = map[string]string{"WARN": WARNING, "ERR": ERROR, "CRIT": CRITICAL}                          // Short names accepted as input, mapped to the severity level they stand for
+)
 
 // Logger is the main logging object.
 type Logger struct {
-	severity string
+	mu           sync.RWMutex
+	severity     string
+	hooks        []func(severity, message string)
+	transforms   []func(string) string // change the message of every entry, see SetMessageTransform
+	name         string                // the registry name of the Logger, see Named
+	component    string                // the subsystem written in the "component" field, see WithComponent
+	fields       map[string]any        // structured fields added to every log entry, never modified once set
+	groups       []string              // the open groups that new fields are added to, see WithGroup
+	fieldsCap    int                   // the number of fields WithField expects to be added, see WithFieldsCapacity
+	pending      []fieldPair           // fields added by WithField which haven't been merged into fields yet
+	pendingTo    *pendingFields        // holds pending, nil when there are no pending fields
+	labels       map[string]string     // Cloud Logging labels added to every log entry, never modified once set
+	out          io.Writer             // where log entries are written, os.Stdout when nil
+	discard      bool                  // when true, entries are dropped before they're formatted, see NewDiscard
+	insertID     func() string         // generates the insertId of each entry, nil when insertIds are off
+	seq          *atomic.Uint64        // numbers each entry written, nil when sequence numbers are off, see WithSequenceNumbers
+	trace        traceContext          // the Cloud Trace span that entries belong to, see WithTrace
+	projectID    string                // the Google Cloud project that WithTraceID uses, see SetProjectID
+	timestamps   bool                  // when true, entries include the time they were written, in timeFormat
+	clock        Clock                 // tells the time, or nil for the system clock, see WithClock
+	timeFormat   TimestampFormat
+	counts       *severityCounts
+	sampler      *sampler          // drops a fraction of low severity entries, nil when sampling is off
+	remap        map[string]string // replaces the severity of entries, never modified once set
+	buf          *buffer           // holds entries until they're flushed, nil when buffering is off
+	durfmt       DurationFormat    // how WithDuration records durations
+	encoders     []FieldEncoder    // applied to field values before they're encoded, see WithFieldEncoder, never modified once set
+	keepSpace    bool              // when true, leading and trailing white space isn't trimmed from messages
+	keepControl  bool              // when true, control characters in messages aren't escaped, see SetSanitize
+	maxMessage   int               // the maximum length of a message in bytes, or 0 for no limit, see SetMaxMessageBytes
+	masks        []*regexp.Regexp  // patterns replaced in messages and string field values, see WithMasking, never modified once set
+	pii          []PIIKind         // kinds of personal data replaced in messages and string field values, see WithPIIScrubbing, never modified once set
+	jsonKey      string            // the field PrintJSON nests values under, or "" to merge objects into the entry
+	jsonDetect   JSONDetection     // whether messages which are JSON objects are turned into fields, see WithJSONDetection
+	int64Strings Int64Strings      // whether 64-bit integer field values are written as strings, see WithInt64AsString
+	bytesFormat  bytesFormat       // how []byte field values are written, see WithBytesEncoding
+	textFields   TextFields        // whether fields are appended to messages as text, see WithTextFields
+	logEntry     bool              // when true, entries are written in the LogEntry format of the Cloud Logging API, see SetLogEntryFormat
+	service      serviceContext    // the service reported errors come from, see WithServiceContext
+	sourceMin    string            // the lowest severity to add a source location to, or "" when source locations are off
+	stackMin     string            // the lowest severity to add a stack trace to, or "" when stack traces are off
+	stackFrames  int               // the most frames a stack trace has, or 0 for no limit, see WithStackTraces
+	reportErrors bool              // when true, entries at ERROR or above are marked for Error Reporting, see WithReportedErrors
+	callerSkip   int               // extra stack frames to skip when finding the source location, see WithCallerSkip
+	callerPrefix CallerFormat      // how the source location is written at the start of messages, see WithCallerPrefix
+	severityKey  string            // the JSON key for the severity, or "" for the default
+	messageKey   string            // the JSON key for the message, or "" for the default
+	nameKey      string            // the JSON key for the name, or "" for the default
+	errOut       io.Writer         // where entries at or above errAbove are written, nil when there's a single writer
+	errAbove     string
+	sevOut       map[string]io.Writer // where entries of each severity are written, see SetSeverityWriters, never modified once set
+	indentPrefix string               // starts each line of indented entries, see SetIndent
+	indent       string               // indents the JSON of entries, or "" with indentPrefix for compact entries
+	labelLimit   int                  // the maximum length of a label value in bytes, or 0 for defaultLabelLimit
+	strictLabels bool                 // when true, labels with invalid keys are dropped instead of sanitized
+	onError      func(error)          // called with problems which don't stop an entry being written, see SetErrorHandler
+	reported     *sync.Map            // the reserved keys and label keys which have already been reported to onError
+	writers      *writerLocks         // serializes writes to each io.Writer which isn't behind a buffer, shared with Loggers created from this one
 }
 
+// severityCounts holds the number of log entries written at each severity level, in the same order as severityAll.
+type severityCounts [len(severityAll)]atomic.Uint64
+
 // New returns a pointer to a new Logger.
 func New(s ...string) *Logger {
+	l := defaultLogger()
 	if len(s) >= 1 {
 		if isValidSeverity(s[0]) {
-			return &Logger{
-				severity: s[0],
-			}
+			l.severity = canonicalSeverity(s[0])
 		}
 	}
-	return defaultLogger()
+	return l
+}
+
+// NewDiscard returns a pointer to a new Logger which discards everything, for silencing logs in tests and benchmarks.
+// Its Writer is io.Discard, but entries are dropped before any formatting or encoding, so writing to it is almost free
+// and doesn't allocate. Hooks aren't called and nothing is counted,
+// but entries sent to other writers by SetErrorStream or SetSeverityWriters are still written. Calling SetOutput stops it discarding entries.
+func NewDiscard(s ...string) *Logger {
+	l := New(s...)
+	l.out = io.Discard
+	l.discard = true
+	return l
 }
 
 // Print uses the same format as fmt.Print to write a log message with the severity of the Logger.
 func (l *Logger) Print(v ...any) {
-	l.output(fmt.Sprint(v...))
+	l.output(record{}, v...)
+}
+
+// PrintFunc writes the message returned by fn with the severity of the Logger, only calling fn if the entry will be written,
+// so an expensive message costs nothing when it's filtered out by SetLevel, sampled out or discarded:
+//
+//	logger.PrintFunc(func() string { return dump(state) })
+//
+// A nil fn writes an empty message.
+func (l *Logger) PrintFunc(fn func() string) {
+	l.output(record{fn: fn})
+}
+
+// Enabled reports whether an entry written by the Logger now, at its severity, would be written, so expensive work to build
+// an entry can be skipped when it wouldn't be, for example:
+//
+//	if logger.Enabled() {
+//		logger.Printf("state: %s", dump(state))
+//	}
+//
+// It's false when the entry would be filtered out by the level set by SetLevel, after any severity remapping, when all entries
+// at the severity, before remapping, are sampled out, or when the Logger discards everything, like one from NewDiscard. When only some entries are
+// sampled out, it's true, as whether an entry is kept is only decided once it's written.
+func (l *Logger) Enabled() bool {
+	l.mu.RLock()
+	severity, name, sampler := l.severity, l.name, l.sampler
+	discard := l.discard && l.errOut == nil && l.sevOut == nil
+	remapped, ok := l.remap[canonicalSeverity(severity)]
+	if !ok {
+		remapped = severity
+	}
+	l.mu.RUnlock()
+	switch {
+	case discard:
+		return false
+	case name != "" && !SeverityAtLeast(remapped, levels.resolve(name)):
+		return false
+	case sampler != nil && sampler.dropsAll(severity):
+		return false
+	}
+	return true
 }
 
 // Printf uses the same format as fmt.Printf to write a log message with the severity of the Logger.
 func (l *Logger) Printf(format string, v ...any) {
-	l.output(fmt.Sprintf(format, v...))
+	l.output(record{message: format, printf: true}, v...)
+}
+
+// PrintBytes writes a log message with the severity of the Logger, using the provided bytes as the message, without formatting them.
+// The message is JSON-escaped as usual. Unless the Logger has hooks, the bytes aren't copied, so writing an already rendered message is cheap.
+// The bytes aren't kept after PrintBytes returns, so they can be reused straight away.
+func (l *Logger) PrintBytes(b []byte) {
+	if b == nil {
+		b = []byte{}
+	}
+	l.output(record{raw: b})
+}
+
+// PrintLines writes each line of s as its own log message with the severity of the Logger, which keeps captured output,
+// like that of a subprocess, readable rather than writing it as one large entry. Lines are split on "\n", and a trailing "\r" is removed,
+// so Windows line endings are handled. Lines which are empty or only white space are skipped, including any trailing newline.
+func (l *Logger) PrintLines(s string) {
+	for s != "" {
+		var line string
+		line, s, _ = strings.Cut(s, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		l.output(record{message: line})
+	}
+}
+
+// PrintErr is the same as Print, but returns any error from writing the log message.
+// A log message which isn't written because of its severity is not an error.
+//
+// If the output has been closed, like a pipe whose reader has gone away while the process is shutting down, then the entry is dropped
+// and the error wraps ErrClosedOutput, as well as the original error, like syscall.EPIPE. These are usually safe to ignore,
+// so errors.Is(err, ErrClosedOutput) tells them apart from other write errors, which may need acting on.
+func (l *Logger) PrintErr(v ...any) error {
+	return l.output(record{}, v...)
+}
+
+// PrintfErr is the same as Printf, but returns any error from writing the log message.
+// A log message which isn't written because of its severity is not an error.
+func (l *Logger) PrintfErr(format string, v ...any) error {
+	return l.output(record{message: format, printf: true}, v...)
+}
+
+// At returns a new Logger with the provided severity, so a single entry can be written at a different severity in one line:
+//
+//	logger.At(gcplog.WARNING).Print("disk nearly full")
+//
+// If the provided severity is not valid, then the severity of the original Logger is kept. The original Logger is not changed.
+func (l *Logger) At(severity string) *Logger {
+	c := l.clone()
+	if sev := canonicalSeverity(severity); sev != "" {
+		c.severity = sev
+	}
+	return c
+}
+
+// PrintAt uses the same format as fmt.Print to write a log message with the provided severity, instead of the severity of the Logger.
+// If the provided severity is not valid, then the severity of the Logger is used. The Logger is not changed.
+func (l *Logger) PrintAt(severity string, v ...any) {
+	l.output(record{severity: severity}, v...)
+}
+
+// PrintfAt uses the same format as fmt.Printf to write a log message with the provided severity, instead of the severity of the Logger.
+// If the provided severity is not valid, then the severity of the Logger is used. The Logger is not changed.
+func (l *Logger) PrintfAt(severity, format string, v ...any) {
+	l.output(record{severity: severity, message: format, printf: true}, v...)
+}
+
+// Log is the same as PrintAt, for when the severity is worked out at run time, for example from an HTTP status code.
+// If the provided severity is not valid, then the severity of the Logger is used. The Logger is not changed.
+func (l *Logger) Log(severity string, v ...any) {
+	l.output(record{severity: severity}, v...)
+}
+
+// Logf is the same as PrintfAt, for when the severity is worked out at run time.
+// If the provided severity is not valid, then the severity of the Logger is used. The Logger is not changed.
+func (l *Logger) Logf(severity, format string, v ...any) {
+	l.output(record{severity: severity, message: format, printf: true}, v...)
 }
 
 // Fatal uses the same format as fmt.Fatal to write a log message with the severity of the Logger and then exit, with exit code 1.
+// Buffered entries are flushed before exiting.
 func (l *Logger) Fatal(v ...any) {
-	l.output(fmt.Sprint(v...))
+	l.output(record{}, v...)
+	_ = l.Close()
 	os.Exit(1)
 }
 
 // Fatalf uses the same format as fmt.Fatalf to write a log message with the severity of the Logger and then exit, with exit code 1.
+// Buffered entries are flushed before exiting.
 func (l *Logger) Fatalf(format string, v ...any) {
-	l.output(fmt.Sprintf(format, v...))
+	l.output(record{message: format, printf: true}, v...)
+	_ = l.Close()
 	os.Exit(1)
 }
 
 // PrefixPrint prefixes the provided message element with severity level of the logger.
 // It then uses the same format as fmt.Print to write a log message with the severity of the Logger.
 func (l *Logger) PrefixPrint(v ...any) {
-	l.output(fmt.Sprint(l.prefix(v...)...))
+	l.output(record{message: l.prefix(fmt.Sprint(v...))})
 }
 
 // PrefixPrintf prefixes the provided message element with severity level of the logger.
 // It then uses the same format as fmt.Printf to write a log message with the severity of the Logger.
 func (l *Logger) PrefixPrintf(format string, v ...any) {
-	l.output(fmt.Sprintf("%s%s"+format, l.prefix(v...)...))
+	l.output(record{message: l.prefix(fmt.Sprintf(format, v...))})
 }
 
 // PrefixFatal prefixes the provided message element with severity level of the logger.
 // It then uses the same format as fmt.Fatal to write a log message with the severity of the Logger and then exit, with exit code 1.
+// Buffered entries are flushed before exiting.
 func (l *Logger) PrefixFatal(v ...any) {
-	l.output(fmt.Sprint(l.prefix(v...)...))
+	l.output(record{message: l.prefix(fmt.Sprint(v...))})
+	_ = l.Close()
 	os.Exit(1)
 }
 
 // PrefixFatalf prefixes the provided message element with severity level of the logger.
 // It then uses the same format as fmt.Fatalf to write a log message with the severity of the Logger and then exit, with exit code 1.
+// Buffered entries are flushed before exiting.
 func (l *Logger) PrefixFatalf(format string, v ...any) {
-	l.output(fmt.Sprintf("%s%s"+format, l.prefix(v...)...))
+	l.output(record{message: l.prefix(fmt.Sprintf(format, v...))})
+	_ = l.Close()
 	os.Exit(1)
 }
 
 // Severity returns the current severity of the Logger object, as a string.
 func (l *Logger) Severity() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	return l.severity
 }
 
 // SetSeverity will set the severity of the Logger object to the provided string, if that string is a valid severity level.
 // If the provided string is not valid, then the severity level will remain unchanged.
 func (l *Logger) SetSeverity(s string) {
-	if isValidSeverity(strings.ToUpper(s)) {
-		l.severity = strings.ToUpper(s)
+	if isValidSeverity(s) {
+		l.mu.Lock()
+		l.severity = canonicalSeverity(s)
+		l.mu.Unlock()
 	}
 }
 
+// SetSeverityInt sets the severity of the Logger from the numeric code GCP uses for it, like 400 for WARNING, which is the inverse
+// of SeverityLevel. Only the exact codes are matched, from 0 for DEFAULT up to 800 for EMERGENCY, and 50 for TRACE.
+// If the code is not one of them, then the severity level will remain unchanged.
+func (l *Logger) SetSeverityInt(code int) {
+	for _, sev := range severityAll {
+		if SeverityLevel(sev) == code {
+			l.mu.Lock()
+			l.severity = sev
+			l.mu.Unlock()
+			return
+		}
+	}
+}
+
+// TrySetSeverity is the same as SetSeverity, but returns an error if the provided string is not a valid severity level.
+// The error wraps ErrInvalidSeverity, and includes the invalid value and the list of valid severity levels.
+func (l *Logger) TrySetSeverity(s string) error {
+	if !isValidSeverity(s) {
+		return fmt.Errorf("%w %q, must be one of %s", ErrInvalidSeverity, s, strings.Join(Severities(), ", "))
+	}
+	l.SetSeverity(s)
+	return nil
+}
+
+// MustSetSeverity is the same as TrySetSeverity, but panics if the provided string is not a valid severity level.
+// It's intended for use during initialisation, where an invalid severity is a programming error.
+func (l *Logger) MustSetSeverity(s string) {
+	if err := l.TrySetSeverity(s); err != nil {
+		panic(err)
+	}
+}
+
+// SetTrimSpace sets whether leading and trailing white space is trimmed from log messages.
+// Trimming is on by default, but it can be turned off where the white space is meaningful, like indented stack traces.
+func (l *Logger) SetTrimSpace(trim bool) {
+	l.mu.Lock()
+	l.keepSpace = !trim
+	l.mu.Unlock()
+}
+
+// SetSanitize sets whether control characters in log messages are escaped, which is on by default.
+// Escaping replaces each control character other than newline and tab with its Go escape sequence, like `\r` or `\x1b`,
+// so untrusted input can't hide text with carriage returns, or send terminal escape codes to whoever reads the logs.
+//
+// Every string in an entry is always JSON-escaped, with or without this, so a newline in a message is written as `\n`
+// and can never start a separate, forged, log entry.
+func (l *Logger) SetSanitize(sanitize bool) {
+	l.mu.Lock()
+	l.keepControl = !sanitize
+	l.mu.Unlock()
+}
+
+// truncatedMarker is added to the end of messages which SetMaxMessageBytes shortens.
+const truncatedMarker = "…[truncated]"
+
+// SetMaxMessageBytes sets the maximum length of a log message in bytes, so a runaway message can't make an entry larger than
+// Cloud Logging accepts, which is about 256KB. Longer messages are cut at a UTF-8 character boundary, at or before n bytes,
+// and "…[truncated]" is added after them. It applies to the final message, after transforms added by SetMessageTransform.
+// A limit of zero or less, which is the default, means there's no limit.
+func (l *Logger) SetMaxMessageBytes(n int) {
+	l.mu.Lock()
+	l.maxMessage = max(n, 0)
+	l.mu.Unlock()
+}
+
+// truncateMessage returns msg cut to at most n bytes with truncatedMarker added, as described by SetMaxMessageBytes,
+// or msg unchanged if it's no longer than n or n is zero.
+func truncateMessage(msg string, n int) string {
+	if n == 0 || len(msg) <= n {
+		return msg
+	}
+	return truncateUTF8(msg, n) + truncatedMarker
+}
+
+// sanitizeMessage returns s with each control character other than newline and tab replaced by its Go escape sequence,
+// as described by SetSanitize. s is returned unchanged, without allocating, if it has no such characters.
+func sanitizeMessage(s string) string {
+	i := strings.IndexFunc(s, escapedControl)
+	if i < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	b.WriteString(s[:i])
+	for _, r := range s[i:] {
+		if escapedControl(r) {
+			q := strconv.QuoteRune(r)
+			b.WriteString(q[1 : len(q)-1])
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// escapedControl reports whether r is a control character which sanitizeMessage escapes.
+func escapedControl(r rune) bool {
+	return unicode.IsControl(r) && r != '\n' && r != '\t'
+}
+
+// AddHook registers a function which is called with the severity and message of every log entry, just before it is written.
+// Hooks are called synchronously, in the order they were added. A hook which panics is recovered, so it can't stop the entry being written.
+func (l *Logger) AddHook(fn func(severity, message string)) {
+	if fn == nil {
+		return
+	}
+	l.mu.Lock()
+	l.hooks = append(l.hooks, fn)
+	l.mu.Unlock()
+}
+
+// SetMessageTransform adds a function which is passed the message of every log entry and returns the message to write instead,
+// for example to add a request ID to the text, or to shorten very long messages. It's called once the message is otherwise final,
+// after it's formatted, trimmed, masked and sanitized, and before hooks are called and the entry is encoded.
+// Each call adds another transform, and they're applied in the order they were added, each passed the result of the last.
+// A transform which panics is recovered, and the message is left as it was. Calling SetMessageTransform with nil removes all the transforms.
+// Loggers created from this one after SetMessageTransform is called use the same transforms.
+func (l *Logger) SetMessageTransform(fn func(string) string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if fn == nil {
+		l.transforms = nil
+		return
+	}
+	l.transforms = append(l.transforms, fn)
+}
+
+// AppendEntry appends the JSON encoding of a log entry with the provided severity and message to dst, without a trailing newline,
+// and returns the extended buffer, for callers which batch and write entries themselves. The entry has the fields, labels,
+// trace, timestamp and other settings of the Logger, the same as the entry Print would write, and is built by the same steps.
+// An invalid severity is replaced by the severity of the Logger, and severity remapping applies.
+//
+// Nothing is written, so nothing is filtered, sampled, counted or passed to hooks, and the entry has no insertId,
+// sequence number or source location. Fields using reserved keys are reported to the error handler, as they are by Print.
+// Like Print, the first call merges fields added by WithField into the fields of the Logger, which doesn't change its entries.
+// With simple field values, it doesn't allocate once dst is large enough.
+func (l *Logger) AppendEntry(dst []byte, severity, message string) []byte {
+	var e entry
+	var c entryConfig
+	l.snapshot(severity, &e, &c)
+	r := record{message: message}
+	l.buildEntry(&e, &c, &r, nil, -1)
+	b := e.appendJSON(dst)
+	return b[:len(b)-1]
+}
+
+// record holds the parts of a log entry which come from a single call, rather than from the Logger.
+type record struct {
+	severity string            // used instead of the severity of the Logger, if it's valid
+	message  string            // the log message, or the format for the arguments of output when printf is true
+	printf   bool              // whether the arguments are formatted with fmt.Sprintf, rather than fmt.Sprint
+	insertID string            // the insertId for this entry, replacing one from the Logger's generator
+	fields   map[string]any    // structured fields for this entry only, which replace any Logger fields with the same key
+	typed    []Field           // typed fields for this entry only, see PrintFields, which replace any fields with the same key
+	labels   map[string]string // labels for this entry only, which replace any Logger labels with the same key
+	skip     int               // extra stack frames to skip when finding the source location, see Output
+	raw      []byte            // the log message, for PrintBytes, used instead of message when it's not nil
+	trace    *traceContext     // the trace for this entry only, replacing the Logger's trace, or nil
+	report   bool              // whether the entry is an error event for Error Reporting, see ReportError
+	fn       func() string     // returns the log message, for PrintFunc, used instead of message when it's not nil
+}
+
+// text returns the log message of the record, formatting the provided arguments if there are any.
+// Formatting is left until the entry is known to be written, so entries which are filtered out or discarded cost less.
+func (r *record) text(args []any) string {
+	switch {
+	case r.printf:
+		return fmt.Sprintf(r.message, args...)
+	case args != nil:
+		return fmt.Sprint(args...)
+	case r.raw != nil:
+		return string(r.raw)
+	case r.fn != nil:
+		return r.fn()
+	}
+	return r.message
+}
+
 // output is a method to write to resulting log message to GCP logging.
-func (l *Logger) output(s string) {
-	jsonBytes, _ := json.Marshal(gcpLogMessage{
-		Severity: l.severity,
-		Message:  strings.TrimSpace(s),
-	})
-	fmt.Println(string(jsonBytes))
+// It must be called directly by the exported method the user called, so the source location can be found.
+// The arguments are formatted into the message, as described by record. They're passed separately, rather than in the record,
+// so they don't escape to the heap when the entry is discarded. It returns any error from the underlying io.Writer.
+func (l *Logger) output(r record, args ...any) error {
+	if l.discarding() {
+		return nil
+	}
+	var e entry
+	var c entryConfig
+	l.snapshot(r.severity, &e, &c)
+	if r.trace != nil {
+		e.trace = *r.trace
+	}
+	if e.name != "" && !SeverityAtLeast(e.severity, levels.resolve(e.name)) {
+		return nil
+	}
+	if c.sampler != nil {
+		for _, summary := range c.sampler.summaries(e.name, now(c.clock)) {
+			summary.severityKey, summary.messageKey, summary.nameKey, summary.logEntry = e.severityKey, e.messageKey, e.nameKey, e.logEntry
+			_ = l.write(summary)
+		}
+		if !c.sampler.keep(c.severity) {
+			return nil
+		}
+	}
+	l.buildEntry(&e, &c, &r, args, outputCallDepth+1+c.callerSkip+r.skip)
+	if c.seq != nil {
+		e.seq = c.seq.Add(1)
+	}
+	e.insertID = r.insertID
+	if e.insertID == "" && c.insertID != nil {
+		e.insertID = c.insertID()
+	}
+	for _, hook := range c.hooks {
+		runHook(hook, e.severity, e.message)
+	}
+	return l.write(e)
+}
+
+// entryConfig holds the settings of a Logger which buildEntry uses, copied by snapshot so the lock isn't held while an entry is built.
+type entryConfig struct {
+	severity                   string // the severity of the entry before remapping, which sampling is decided on
+	hooks                      []func(severity, message string)
+	sampler                    *sampler
+	keepSpace, keepControl     bool
+	sourceMin, stackMin        string
+	callerSkip, stackFrames    int
+	callerPrefix               CallerFormat
+	reportErrors, strictLabels bool
+	labelLimit                 int
+	onError                    func(error)
+	groups                     []string
+	encoders                   []FieldEncoder
+	insertID                   func() string
+	seq                        *atomic.Uint64
+	timestamps                 bool
+	clock                      Clock
+	pending                    []fieldPair
+	transforms                 []func(string) string
+	maxMessage                 int
+	jsonDetect                 JSONDetection
+	int64Strings               Int64Strings
+	bytesFormat                bytesFormat
+	textFields                 TextFields
+	sc                         scrubber
+}
+
+// discarding reports whether the Logger drops its entries before they're built, see NewDiscard.
+func (l *Logger) discarding() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.discard && l.errOut == nil && l.sevOut == nil
+}
+
+// snapshot sets e to an entry holding the severity, after remapping, and the other settings of the Logger which are written with every entry,
+// and c to the settings used to build it. An invalid severity is replaced by the severity of the Logger.
+func (l *Logger) snapshot(severity string, e *entry, c *entryConfig) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	*e = entry{severity: l.severity, name: l.name, component: l.component, trace: l.trace, timeFormat: l.timeFormat, fields: l.fields, labels: l.labels, severityKey: l.severityKey, messageKey: l.messageKey, nameKey: l.nameKey, logEntry: l.logEntry, service: l.service}
+	if isValidSeverity(severity) {
+		e.severity = canonicalSeverity(severity)
+	}
+	original := e.severity
+	if remapped, ok := l.remap[canonicalSeverity(e.severity)]; ok {
+		e.severity = remapped
+	}
+	*c = entryConfig{
+		severity: original, hooks: l.hooks, sampler: l.sampler, keepSpace: l.keepSpace, keepControl: l.keepControl,
+		sourceMin: l.sourceMin, stackMin: l.stackMin, callerSkip: l.callerSkip, stackFrames: l.stackFrames, callerPrefix: l.callerPrefix,
+		reportErrors: l.reportErrors, strictLabels: l.strictLabels, labelLimit: l.labelLimit, onError: l.onError,
+		groups: l.groups, encoders: l.encoders, insertID: l.insertID, seq: l.seq, timestamps: l.timestamps, clock: l.clock,
+		pending: l.pending, transforms: l.transforms, maxMessage: l.maxMessage, jsonDetect: l.jsonDetect,
+		int64Strings: l.int64Strings, bytesFormat: l.bytesFormat, textFields: l.textFields,
+		sc: scrubber{masks: l.masks, pii: l.pii},
+	}
+}
+
+// buildEntry completes the entry returned by snapshot with the timestamp, message, fields and labels of the record,
+// in the same way for output and AppendEntry. The source location and stack trace are found depth frames above buildEntry,
+// and are left out when depth is negative. It doesn't filter, sample, number or write the entry.
+func (l *Logger) buildEntry(e *entry, c *entryConfig, r *record, args []any, depth int) {
+	if c.timestamps {
+		e.time = now(c.clock)
+	}
+	if r.raw != nil && len(c.hooks) == 0 && len(c.transforms) == 0 {
+		e.message = unsafe.String(unsafe.SliceData(r.raw), len(r.raw)) // only used until the entry is encoded, before output returns
+	} else {
+		e.message = r.text(args)
+	}
+	if !c.keepSpace {
+		e.message = strings.TrimSpace(e.message)
+	}
+	if fields, ok := c.jsonDetect.detect(e.message); ok {
+		r.fields = mergeFields(fields, r.fields)
+		e.message = ""
+	}
+	if c.sc.active() {
+		e.message = c.sc.string(e.message)
+	}
+	if depth >= 0 {
+		withSource := c.sourceMin != "" && SeverityAtLeast(e.severity, c.sourceMin)
+		if withSource || c.callerPrefix != CallerOff {
+			source := callerSource(depth)
+			e.message = c.callerPrefix.prefix(source, e.message)
+			if withSource {
+				e.source = source
+			}
+		}
+		if r.report {
+			e.stack = e.message + "\n\n" + callerStack(depth-1, c.stackFrames)
+		} else if c.stackMin != "" && SeverityAtLeast(e.severity, c.stackMin) {
+			e.stack = callerStack(depth-1, c.stackFrames)
+		}
+	}
+	e.reported = r.report || (c.reportErrors && SeverityAtLeast(e.severity, ERROR))
+	if !c.keepControl {
+		e.message = sanitizeMessage(e.message)
+	}
+	if len(c.pending) > 0 {
+		e.fields = l.flushPending()
+	}
+	if len(r.typed) > 0 {
+		if len(c.groups) > 0 || len(c.encoders) > 0 || c.bytesFormat.enc != 0 || c.sc.active() || c.int64Strings != Int64StringsOff || c.textFields != TextFieldsOff {
+			r.fields = mergeFields(r.fields, typedFields(r.typed)) // the settings change field values, so they're handled like any other fields
+		} else {
+			e.typed = r.typed
+		}
+	}
+	if len(e.fields) == 0 && len(c.groups) == 0 {
+		e.fields = r.fields // nothing to merge with, and the fields aren't kept after the entry is written
+	} else if len(r.fields) > 0 {
+		e.fields = mergeGroup(e.fields, c.groups, r.fields)
+	}
+	if len(c.encoders) > 0 && len(e.fields) > 0 {
+		e.fields = encodeFields(e.fields, c.encoders)
+	}
+	e.fields, _ = c.bytesFormat.fields(e.fields)
+	if c.sc.active() {
+		e.fields, _ = c.sc.fields(e.fields)
+	}
+	e.fields, _ = c.int64Strings.fields(e.fields)
+	if len(r.labels) > 0 {
+		e.labels = mergeLabels(e.labels, r.labels)
+	}
+	if len(e.labels) > 0 {
+		e.labels = l.sanitizeLabels(e.labels, c.labelLimit, c.strictLabels, c.onError)
+	}
+	if c.onError != nil {
+		for k := range e.fields {
+			if e.isReserved(k) {
+				l.reportReserved(k, c.onError)
+			}
+		}
+		for _, f := range e.typed {
+			if e.isReserved(f.Key) {
+				l.reportReserved(f.Key, c.onError)
+			}
+		}
+	}
+	c.textFields.apply(e)
+	for _, fn := range c.transforms {
+		e.message = runTransform(fn, e.message)
+	}
+	e.message = truncateMessage(e.message, c.maxMessage)
+}
+
+// encodeBuffers holds the byte slices that entries are encoded into, so they can be reused rather than allocated for every entry.
+var encodeBuffers = sync.Pool{New: func() any { b := make([]byte, 0, 512); return &b }}
+
+// maxPooledBuffer is the largest encoding buffer returned to encodeBuffers, so one huge entry doesn't hold on to its memory.
+const maxPooledBuffer = 64 * 1024
+
+// write encodes the entry and writes it to the Logger's io.Writer, counting it if the write succeeds.
+func (l *Logger) write(e entry) error {
+	var err error
+	l.mu.RLock()
+	buf, errOut, errAbove, sevOut := l.buf, l.errOut, l.errAbove, l.sevOut[e.severity]
+	prefix, indent := l.indentPrefix, l.indent
+	l.mu.RUnlock()
+	p := encodeBuffers.Get().(*[]byte)
+	b := e.appendJSON((*p)[:0])
+	if prefix != "" || indent != "" {
+		b = indentJSON(b, prefix, indent)
+	}
+	if sevOut != nil {
+		_, err = l.writers.write(sevOut, b)
+	} else if errOut != nil && SeverityAtLeast(e.severity, errAbove) {
+		_, err = l.writers.write(errOut, b)
+	} else if buf != nil {
+		err = buf.write(b, e.severity)
+	} else {
+		_, err = l.writers.write(l.Writer(), b)
+	}
+	if cap(b) <= maxPooledBuffer {
+		*p = b
+		encodeBuffers.Put(p)
+	}
+	if err == nil {
+		l.count(e.severity)
+	} else if isClosed(err) {
+		err = fmt.Errorf("%w: %w", ErrClosedOutput, err)
+	}
+	return err
+}
+
+// writerLocks holds a mutex for each io.Writer that a Logger, and the Loggers created from it, write to without a buffer,
+// so entries written at the same time by different goroutines are never interleaved, even when the io.Writer isn't safe for concurrent use.
+type writerLocks struct {
+	mu    sync.Mutex
+	locks map[io.Writer]*sync.Mutex
+}
+
+// write writes p to w, holding the mutex for w while it does.
+func (wl *writerLocks) write(w io.Writer, p []byte) (int, error) {
+	mu := wl.lock(w)
+	mu.Lock()
+	defer mu.Unlock()
+	return w.Write(p)
+}
+
+// lock returns the mutex for w, creating it if it's the first write to w.
+// Writers which aren't pointers share a single mutex, as they might not be comparable, so can't be map keys.
+func (wl *writerLocks) lock(w io.Writer) *sync.Mutex {
+	key := w
+	if reflect.TypeOf(w).Kind() != reflect.Pointer {
+		key = nil
+	}
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	mu := wl.locks[key]
+	if mu == nil {
+		if wl.locks == nil {
+			wl.locks = make(map[io.Writer]*sync.Mutex)
+		}
+		mu = new(sync.Mutex)
+		wl.locks[key] = mu
+	}
+	return mu
+}
+
+// isClosed reports whether err is from writing to an output which has been closed, so nothing more can be written to it.
+func isClosed(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, os.ErrClosed)
 }
 
-// prefix returns the provided any slice, but with the severity of the logger object as the first element
-func (l *Logger) prefix(v ...any) []any {
-	p := []any{l.severity, ": "}
-	return append(p, v...)
+// indentJSON returns the encoded entry b, which ends with a newline, indented as described by SetIndent.
+// The result is copied back into b, so the indented entry reuses its capacity when there's enough.
+func indentJSON(b []byte, prefix, indent string) []byte {
+	var dst bytes.Buffer
+	if err := json.Indent(&dst, b[:len(b)-1], prefix, indent); err != nil {
+		return b // the encoder always writes valid JSON, so this can't happen
+	}
+	dst.WriteByte('\n')
+	return append(b[:0], dst.Bytes()...)
+}
+
+// clone returns a copy of the Logger, which shares the counts of the original.
+func (l *Logger) clone() *Logger {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return &Logger{
+		severity:     l.severity,
+		hooks:        l.hooks[:len(l.hooks):len(l.hooks)],
+		transforms:   l.transforms[:len(l.transforms):len(l.transforms)],
+		name:         l.name,
+		component:    l.component,
+		fields:       l.fields,
+		groups:       l.groups,
+		fieldsCap:    l.fieldsCap,
+		pending:      l.pending,
+		pendingTo:    l.pendingTo,
+		labels:       l.labels,
+		out:          l.out,
+		discard:      l.discard,
+		insertID:     l.insertID,
+		seq:          l.seq,
+		trace:        l.trace,
+		projectID:    l.projectID,
+		timestamps:   l.timestamps,
+		clock:        l.clock,
+		timeFormat:   l.timeFormat,
+		counts:       l.counts,
+		sampler:      l.sampler,
+		remap:        l.remap,
+		buf:          l.buf,
+		durfmt:       l.durfmt,
+		encoders:     l.encoders,
+		keepSpace:    l.keepSpace,
+		keepControl:  l.keepControl,
+		maxMessage:   l.maxMessage,
+		masks:        l.masks,
+		pii:          l.pii,
+		jsonKey:      l.jsonKey,
+		jsonDetect:   l.jsonDetect,
+		int64Strings: l.int64Strings,
+		bytesFormat:  l.bytesFormat,
+		textFields:   l.textFields,
+		logEntry:     l.logEntry,
+		service:      l.service,
+		sourceMin:    l.sourceMin,
+		stackMin:     l.stackMin,
+		stackFrames:  l.stackFrames,
+		reportErrors: l.reportErrors,
+		callerSkip:   l.callerSkip,
+		callerPrefix: l.callerPrefix,
+		severityKey:  l.severityKey,
+		messageKey:   l.messageKey,
+		nameKey:      l.nameKey,
+		errOut:       l.errOut,
+		errAbove:     l.errAbove,
+		sevOut:       l.sevOut,
+		indentPrefix: l.indentPrefix,
+		indent:       l.indent,
+		labelLimit:   l.labelLimit,
+		strictLabels: l.strictLabels,
+		onError:      l.onError,
+		reported:     l.reported,
+		writers:      l.writers,
+	}
+}
+
+// SetOutput sets the io.Writer that log entries are written to. Passing nil restores the default, os.Stdout.
+// If buffered mode is on, then buffered entries are flushed to the old io.Writer first, and this Logger gets its own buffer,
+// with the same size and flushAbove severity, so Loggers which shared the buffer keep writing to the old io.Writer.
+// Loggers created from this one before SetOutput was called keep their own io.Writer.
+func (l *Logger) SetOutput(w io.Writer) {
+	l.mu.Lock()
+	l.out = w
+	l.discard = false
+	old := l.buf
+	if old != nil {
+		if w == nil {
+			w = os.Stdout
+		}
+		l.buf = old.detach(w)
+	}
+	l.mu.Unlock()
+	if old != nil {
+		_ = old.flush()
+	}
+}
+
+// Writer returns the io.Writer that log entries are written to, which is os.Stdout unless it's been changed with SetOutput.
+// Entries sent to other writers by SetErrorStream or SetSeverityWriters aren't included.
+func (l *Logger) Writer() io.Writer {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.out == nil {
+		return os.Stdout
+	}
+	return l.out
+}
+
+const (
+	verifyMessage = "gcplog: output check" // the message of the entry VerifyOutput writes
+	verifyKey     = "gcplog_probe"         // the field holding a random ID, so each entry VerifyOutputFrom reads back is different
+)
+
+// VerifyOutput checks that log entries make it through the io.Writer of the Logger, set by SetOutput, so a misconfigured writer
+// is found at startup rather than when entries go missing. It writes an entry with the severity, fields and settings of the Logger,
+// and a "gcplog_probe" field holding a random ID, in a single call to Write. Buffered entries are flushed first, so it's written in order.
+// It returns an error if the writer fails or doesn't accept every byte, and an error from a closed writer wraps ErrClosedOutput.
+// Nothing is read from the writer; use VerifyOutputFrom to read the entry back too.
+//
+// The entry isn't counted or passed to hooks. It does nothing for os.Stdout, which is the default, or when Enabled reports false,
+// for example when the level set by SetLevel filters out the severity of the Logger.
+// Writers set by SetErrorStream or SetSeverityWriters aren't checked.
+func (l *Logger) VerifyOutput() error {
+	return l.verifyOutput(nil)
+}
+
+// VerifyOutputFrom is the same as VerifyOutput, but it then reads the entry back from r, which must return what's written to the writer,
+// like the other end of a pipe or connection, and returns an error if it doesn't come back unchanged.
+// It reads exactly as many bytes as were written, so r must have nothing else waiting to be read, and it blocks until they arrive,
+// so a connection should have a read deadline. Nothing is read when VerifyOutput would do nothing.
+func (l *Logger) VerifyOutputFrom(r io.Reader) error {
+	return l.verifyOutput(r)
+}
+
+// verifyOutput writes the entry for VerifyOutput and, if r isn't nil, reads it back from r.
+func (l *Logger) verifyOutput(r io.Reader) error {
+	l.mu.RLock()
+	w, prefix, indent := l.out, l.indentPrefix, l.indent
+	l.mu.RUnlock()
+	if w == nil || w == os.Stdout || !l.Enabled() {
+		return nil
+	}
+	if err := l.Flush(); err != nil {
+		return fmt.Errorf("gcplog: output check: flushing buffered entries: %w", err)
+	}
+	b := l.With(verifyKey, randomID()).AppendEntry(nil, "", verifyMessage)
+	b = append(b, '\n')
+	if prefix != "" || indent != "" {
+		b = indentJSON(b, prefix, indent)
+	}
+	n, err := l.writers.write(w, b)
+	switch {
+	case err != nil && isClosed(err):
+		return fmt.Errorf("gcplog: output check: %w: %w", ErrClosedOutput, err)
+	case err != nil:
+		return fmt.Errorf("gcplog: output check: %w", err)
+	case n != len(b):
+		return fmt.Errorf("gcplog: output check wrote %d of %d bytes: %w", n, len(b), io.ErrShortWrite)
+	case r == nil:
+		return nil
+	}
+	got := make([]byte, len(b))
+	if _, err := io.ReadFull(r, got); err != nil {
+		return fmt.Errorf("gcplog: output check: reading the entry back: %w", err)
+	}
+	if !bytes.Equal(got, b) {
+		return fmt.Errorf("gcplog: output check: read back %q, want the entry written, %q", got, b)
+	}
+	return nil
+}
+
+// SetErrorStream sends log entries at or above the provided severity to a second io.Writer, typically os.Stderr,
+// while lower severities continue to go to the normal writer. Entries sent to the second writer aren't buffered.
+// Passing a nil io.Writer, or a severity that's not valid, goes back to writing everything to the normal writer.
+func (l *Logger) SetErrorStream(above string, w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w == nil || !isValidSeverity(above) {
+		l.errOut, l.errAbove = nil, ""
+		return
+	}
+	l.errOut, l.errAbove = w, canonicalSeverity(above)
+}
+
+// SetIndent sets the Logger to write each log entry as indented JSON over several lines, for reading nested fields
+// when debugging locally. Each line of an entry after the first starts with prefix, followed by one or more copies of indent,
+// as with json.MarshalIndent. Cloud Logging expects one entry per line, so this should be left off, which is the default,
+// in production. Calling SetIndent with an empty prefix and indent turns it off again, writing each entry as compact JSON on a single line.
+func (l *Logger) SetIndent(prefix, indent string) {
+	l.mu.Lock()
+	l.indentPrefix, l.indent = prefix, indent
+	l.mu.Unlock()
+}
+
+// SetSeverityWriters sends log entries of each severity in the map to its own io.Writer, for example:
+//
+//	logger.SetSeverityWriters(map[string]io.Writer{gcplog.DEBUG: debugFile, gcplog.ERROR: os.Stderr})
+//
+// Entries of severities which aren't in the map go to the writer set by SetErrorStream, if they're at or above its severity,
+// or otherwise to the normal writer. Entries sent to a severity's writer aren't buffered. Keys which aren't valid severities,
+// and nil writers, are ignored. Each call replaces the writers of the previous one, and passing an empty map removes them.
+// The provided map is copied, so it can be changed afterwards.
+func (l *Logger) SetSeverityWriters(m map[string]io.Writer) {
+	writers := make(map[string]io.Writer, len(m))
+	for s, w := range m {
+		if w != nil && isValidSeverity(s) {
+			writers[canonicalSeverity(s)] = w
+		}
+	}
+	if len(writers) == 0 {
+		writers = nil
+	}
+	l.mu.Lock()
+	l.sevOut = writers
+	l.mu.Unlock()
+}
+
+// SetErrorHandler sets a function which is called with any problems that don't stop a log entry from being written,
+// like a structured field using a reserved key. Each kind of problem is only reported once.
+// Passing nil, which is the default, ignores these problems.
+func (l *Logger) SetErrorHandler(fn func(error)) {
+	l.mu.Lock()
+	l.onError = fn
+	l.mu.Unlock()
+}
+
+// reportReserved reports a structured field which uses a reserved key to the error handler, unless it's already been reported.
+func (l *Logger) reportReserved(key string, onError func(error)) {
+	if _, loaded := l.reported.LoadOrStore(key, true); !loaded {
+		onError(fmt.Errorf("%w: %q is renamed to %q", ErrReservedKey, key, reservedPrefix+key))
+	}
+}
+
+// reportLabel reports a label which was dropped because of an invalid key to the error handler, unless it's already been reported.
+func (l *Logger) reportLabel(key string, onError func(error)) {
+	if _, loaded := l.reported.LoadOrStore("label:"+key, true); !loaded {
+		onError(fmt.Errorf("%w: %q is dropped", ErrInvalidLabel, key))
+	}
+}
+
+// Counts returns a snapshot of how many log entries the Logger has written at each severity level.
+// Every valid severity level is included in the map, even if nothing has been written at that level.
+func (l *Logger) Counts() map[string]uint64 {
+	c := make(map[string]uint64, len(severityAll))
+	for i, sev := range severityAll {
+		c[sev] = l.counts[i].Load()
+	}
+	return c
+}
+
+// count increments the number of log entries written at the provided severity.
+func (l *Logger) count(severity string) {
+	severity = canonicalSeverity(severity)
+	for i, sev := range severityAll {
+		if severity == sev {
+			l.counts[i].Add(1)
+			return
+		}
+	}
+}
+
+// prefix returns the provided, already formatted, message prefixed with the severity of the logger object
+func (l *Logger) prefix(s string) string {
+	return l.Severity() + ": " + s
+}
+
+// runTransform returns the result of the provided message transform, or the message unchanged if the transform panics.
+func runTransform(fn func(string) string, message string) (s string) {
+	defer func() {
+		if recover() != nil {
+			s = message
+		}
+	}()
+	return fn(message)
+}
+
+// runHook calls the provided hook, recovering from any panic it causes.
+func runHook(hook func(severity, message string), severity, message string) {
+	defer func() {
+		_ = recover()
+	}()
+	hook(severity, message)
 }
 
 // defaultLogger returns a Logger object with all elements set to defaults.
 func defaultLogger() *Logger {
-	return &Logger{severity: DEFAULT}
+	return &Logger{severity: DEFAULT, counts: new(severityCounts), reported: new(sync.Map), writers: new(writerLocks)}
 }
 
-// isValidSeverity checks to see if the provided string is a valid severity level.
-func isValidSeverity(s string) bool {
+// Severities returns all of the valid severity levels, ordered from least to most severe.
+// The alias constants (WARN, ERR and CRIT) aren't repeated, as they share a value with the full names.
+// The returned slice is a copy, so it's safe for the caller to modify.
+func Severities() []string {
+	s := make([]string, len(severityAll))
+	copy(s, severityAll[:])
+	return s
+}
+
+// IsValidSeverity checks to see if the provided string is a valid severity level.
+// The check is case-insensitive, so "warning" and "WARNING" are both valid.
+// The short names "WARN", "ERR" and "CRIT" are also accepted, matching the alias constants.
+func IsValidSeverity(s string) bool {
+	return canonicalSeverity(s) != ""
+}
+
+// canonicalSeverity returns the severity level constant for the provided string, which is matched case-insensitively
+// and may be one of the short alias names. It returns an empty string if the provided string is not a valid severity level.
+func canonicalSeverity(s string) string {
 	s = strings.ToUpper(s)
+	if alias, ok := severityAliases[s]; ok {
+		return alias
+	}
 	for _, sev := range severityAll {
 		if s == sev {
-			return true
+			return sev
 		}
 	}
-	return false
+	return ""
+}
+
+// SeverityLevel returns the numeric code GCP uses for the provided severity level, from 0 for DEFAULT up to 800 for EMERGENCY.
+// TRACE doesn't have a GCP code, so it's given 50 to place it between DEFAULT and DEBUG.
+// The severity is matched case-insensitively. An invalid severity is treated as DEFAULT.
+func SeverityLevel(s string) int {
+	switch canonicalSeverity(s) {
+	case TRACE:
+		return 50
+	case DEBUG:
+		return 100
+	case INFO:
+		return 200
+	case NOTICE:
+		return 300
+	case WARNING:
+		return 400
+	case ERROR:
+		return 500
+	case CRITICAL:
+		return 600
+	case ALERT:
+		return 700
+	case EMERGENCY:
+		return 800
+	}
+	return 0
+}
+
+// CompareSeverity returns -1 if a is less severe than b, +1 if a is more severe than b, and 0 if they are equally severe.
+// Severities are ordered DEFAULT, TRACE, DEBUG, INFO, NOTICE, WARNING, ERROR, CRITICAL, ALERT, EMERGENCY, so DEFAULT is the lowest.
+// Invalid severities are treated as DEFAULT.
+func CompareSeverity(a, b string) int {
+	la, lb := SeverityLevel(a), SeverityLevel(b)
+	switch {
+	case la < lb:
+		return -1
+	case la > lb:
+		return 1
+	}
+	return 0
+}
+
+// SeverityAtLeast reports whether s is at least as severe as threshold, using the same ordering as CompareSeverity.
+func SeverityAtLeast(s, threshold string) bool {
+	return CompareSeverity(s, threshold) >= 0
+}
+
+// isValidSeverity checks to see if the provided string is a valid severity level.
+func isValidSeverity(s string) bool {
+	return IsValidSeverity(s)
 }
@@ -1,37 +1,1240 @@
 package gcplog
 
-func ExamplePrint() {
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"unicode/utf8"
+)
+
+func ExampleLogger_Print() {
 	logger := New()
 	logger.Print("Hello World")
 	// Output:
 	// {"severity":"DEFAULT","message":"Hello World"}
 }
 
-func ExamplePrintf() {
+func ExampleLogger_Printf() {
 	logger := New()
 	logger.Printf("%s %v", "Hello World", 12345)
 	// Output:
 	// {"severity":"DEFAULT","message":"Hello World 12345"}
 }
 
-func ExamplePrefixPrint() {
+func ExampleLogger_PrefixPrint() {
 	logger := New()
 	logger.PrefixPrint("Hello World")
 	// Output:
 	// {"severity":"DEFAULT","message":"DEFAULT: Hello World"}
 }
 
-func ExamplePrefixPrintf() {
+func ExampleLogger_PrefixPrintf() {
 	logger := New()
 	logger.PrefixPrintf("%s %v", "Hello World", 12345)
 	// Output:
 	// {"severity":"DEFAULT","message":"DEFAULT: Hello World 12345"}
 }
 
-func ExampleSetSeverity() {
+func ExampleLogger_SetSeverity() {
 	logger := New()
 	logger.SetSeverity(CRITICAL)
 	logger.Print("Hello World")
 	// Output:
 	// {"severity":"CRITICAL","message":"Hello World"}
 }
+
+func TestIsValidSeverity(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{DEFAULT, true},
+		{WARN, true},
+		{"warning", true},
+		{"Critical", true},
+		{"", false},
+		{"WARNINGS", false},
+		{"trace", true},
+		{"TRACES", false},
+		{"warn", true},
+		{"ERR", true},
+		{"crits", false},
+	}
+	for _, tt := range tests {
+		if got := IsValidSeverity(tt.s); got != tt.want {
+			t.Errorf("IsValidSeverity(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestCompareSeverity(t *testing.T) {
+	ordered := []string{DEFAULT, TRACE, DEBUG, INFO, NOTICE, WARNING, ERROR, CRITICAL, ALERT, EMERGENCY}
+	rank := make(map[string]int)
+	for i, sev := range ordered {
+		rank[sev] = i
+	}
+	for _, a := range severityAll {
+		for _, b := range severityAll {
+			want := 0
+			if rank[a] < rank[b] {
+				want = -1
+			} else if rank[a] > rank[b] {
+				want = 1
+			}
+			if got := CompareSeverity(a, b); got != want {
+				t.Errorf("CompareSeverity(%q, %q) = %d, want %d", a, b, got, want)
+			}
+			if got := SeverityAtLeast(a, b); got != (want >= 0) {
+				t.Errorf("SeverityAtLeast(%q, %q) = %v, want %v", a, b, got, want >= 0)
+			}
+		}
+	}
+}
+
+func TestCompareSeverityInvalid(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"BOGUS", DEFAULT, 0},
+		{"BOGUS", DEBUG, -1},
+		{ERROR, "", 1},
+		{"error", ERR, 0},
+		{"warn", WARNING, 0},
+		{"Crit", ALERT, -1},
+		{"trace", DEBUG, -1},
+		{TRACE, DEFAULT, 1},
+	}
+	for _, tt := range tests {
+		if got := CompareSeverity(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareSeverity(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestAddHook(t *testing.T) {
+	logger := New(WARNING)
+	logger.out = io.Discard
+	var calls []string
+	logger.AddHook(func(severity, message string) {
+		calls = append(calls, "first:"+severity+":"+message)
+	})
+	logger.AddHook(func(severity, message string) {
+		panic("hook failure")
+	})
+	logger.AddHook(func(severity, message string) {
+		calls = append(calls, "third:"+severity+":"+message)
+	})
+	logger.Print(" Hello World ")
+	want := []string{"first:WARNING:Hello World", "third:WARNING:Hello World"}
+	if len(calls) != len(want) {
+		t.Fatalf("hooks called %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("hook call %d = %q, want %q", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestSetMessageTransform(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	var hooked string
+	logger.AddHook(func(severity, message string) { hooked = message })
+	logger.SetMessageTransform(func(s string) string { return "[req-42] " + s })
+	logger.SetMessageTransform(func(s string) string { panic("transform failure") })
+	logger.SetMessageTransform(func(s string) string {
+		if len(s) > 20 {
+			return s[:20] + "..."
+		}
+		return s
+	})
+	child := logger.With("k", 1)
+	child.Printf("  %s\x01 ", "short")
+	logger.PrintBytes([]byte("a much longer message which is truncated"))
+	if want := "[req-42] a much long..."; hooked != want {
+		t.Errorf("hook called with %q, want %q", hooked, want)
+	}
+	logger.SetMessageTransform(nil)
+	logger.Print("plain")
+	child.Print("child")
+	want := `{"severity":"INFO","message":"[req-42] short\\x01","k":1}` + "\n" +
+		`{"severity":"INFO","message":"[req-42] a much long..."}` + "\n" +
+		`{"severity":"INFO","message":"plain"}` + "\n" +
+		`{"severity":"INFO","message":"[req-42] child","k":1}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := string(child.AppendEntry(nil, INFO, "entry")); got != `{"severity":"INFO","message":"[req-42] entry","k":1}` {
+		t.Errorf("AppendEntry() = %s", got)
+	}
+}
+
+func ExampleLogger_AddHook() {
+	logger := New(ERROR)
+	logger.AddHook(func(severity, message string) {
+		panic("a panicking hook doesn't stop the entry being written")
+	})
+	logger.Print("Hello World")
+	// Output:
+	// {"severity":"ERROR","message":"Hello World"}
+}
+
+func TestSeverities(t *testing.T) {
+	want := []string{DEFAULT, TRACE, DEBUG, INFO, NOTICE, WARNING, ERROR, CRITICAL, ALERT, EMERGENCY}
+	got := Severities()
+	if len(got) != len(want) {
+		t.Fatalf("Severities() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Severities()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	count := 0
+	for _, sev := range got {
+		if sev == DEFAULT {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("DEFAULT appears %d times in Severities(), want 1", count)
+	}
+	got[0] = "MUTATED"
+	if again := Severities(); again[0] != DEFAULT {
+		t.Errorf("modifying the result of Severities() changed a later call: %v", again)
+	}
+	if IsValidSeverity("MUTATED") {
+		t.Error("modifying the result of Severities() changed IsValidSeverity")
+	}
+}
+
+func TestCounts(t *testing.T) {
+	logger := New(INFO)
+	logger.out = io.Discard
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Print("Hello World")
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = logger.Counts()
+		}()
+	}
+	wg.Wait()
+	logger.SetSeverity(ERROR)
+	logger.Print("Hello World")
+	counts := logger.Counts()
+	if len(counts) != len(severityAll) {
+		t.Errorf("Counts() has %d entries, want %d", len(counts), len(severityAll))
+	}
+	for sev, n := range counts {
+		want := uint64(0)
+		switch sev {
+		case INFO:
+			want = 1000
+		case ERROR:
+			want = 1
+		}
+		if n != want {
+			t.Errorf("Counts()[%q] = %d, want %d", sev, n, want)
+		}
+	}
+}
+
+// errWriter is an io.Writer which always fails with err.
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestPrintBytes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	msg := []byte("  rendered <b>\"%d\"</b>\n\xff  ")
+	logger.PrintBytes(msg)
+	copy(msg, "changed")
+	logger.PrintBytes(nil)
+	var hooked []string
+	logger.AddHook(func(severity, message string) { hooked = append(hooked, message) })
+	msg = []byte("hooked")
+	logger.PrintBytes(msg)
+	copy(msg, "XXXXXX")
+	want := `{"severity":"INFO","message":"rendered \u003cb\u003e\"%d\"\u003c/b\u003e\n` + "\ufffd" + `"}` + "\n" +
+		`{"severity":"INFO","message":""}` + "\n" +
+		`{"severity":"INFO","message":"hooked"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if len(hooked) != 1 || hooked[0] != "hooked" {
+		t.Errorf("hook got %q, want the message as it was written", hooked)
+	}
+}
+
+func TestPrintBytesNoAllocs(t *testing.T) {
+	logger := New(INFO)
+	logger.out = io.Discard
+	msg := []byte("Hello World")
+	if n := testing.AllocsPerRun(100, func() { logger.PrintBytes(msg) }); n != 0 {
+		t.Errorf("PrintBytes allocated %v times, want 0", n)
+	}
+}
+
+func TestPrintErr(t *testing.T) {
+	logger := New(ERROR)
+	logger.out = errWriter{io.ErrClosedPipe}
+	if err := logger.PrintErr("Hello World"); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("PrintErr() = %v, want %v", err, io.ErrClosedPipe)
+	}
+	if err := logger.PrintfErr("%s", "Hello World"); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("PrintfErr() = %v, want %v", err, io.ErrClosedPipe)
+	}
+	if got := logger.Counts()[ERROR]; got != 0 {
+		t.Errorf("Counts()[ERROR] = %d after failed writes, want 0", got)
+	}
+	logger.out = io.Discard
+	if err := logger.PrintErr("Hello World"); err != nil {
+		t.Errorf("PrintErr() = %v, want nil", err)
+	}
+}
+
+// shortWriter is an io.Writer which accepts at most n bytes of each write, without an error.
+type shortWriter struct{ n int }
+
+func (w shortWriter) Write(p []byte) (int, error) {
+	return min(len(p), w.n), nil
+}
+
+// mangleWriter is an io.ReadWriter which changes what's written to it before it can be read back, like a broken proxy.
+type mangleWriter struct{ bytes.Buffer }
+
+func (w *mangleWriter) Write(p []byte) (int, error) {
+	w.Buffer.Write(bytes.ReplaceAll(p, []byte(`"`), []byte(`'`)))
+	return len(p), nil
+}
+
+// probeID matches the field holding the random ID of the entry VerifyOutput writes.
+var probeID = regexp.MustCompile(`"gcplog_probe":"[0-9a-f]{32}"`)
+
+func TestVerifyOutput(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(NOTICE).With("app", "orders").WithSampling(DEBUG, 0)
+	logger.SetOutput(&buf)
+	logger.SetBuffered(1<<20, ERROR)
+	logger.Print("buffered")
+	if err := logger.VerifyOutput(); err != nil {
+		t.Errorf("VerifyOutput() = %v", err)
+	}
+	want := `{"severity":"NOTICE","message":"buffered","app":"orders"}` + "\n" +
+		`{"severity":"NOTICE","message":"gcplog: output check","app":"orders","gcplog_probe":"ID"}` + "\n"
+	if got := probeID.ReplaceAllString(buf.String(), `"gcplog_probe":"ID"`); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := logger.Counts()[NOTICE]; got != 1 {
+		t.Errorf("Counts()[NOTICE] = %d, want the check not counted", got)
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+	readBack := New(INFO)
+	readBack.SetOutput(pw)
+	readBack.SetIndent("", "  ")
+	if err := readBack.VerifyOutputFrom(pr); err != nil {
+		t.Errorf("VerifyOutputFrom() = %v", err)
+	}
+	readBack.Print("after")
+	if got, _ := bufio.NewReader(pr).ReadString('}'); !strings.Contains(got, `"after"`) {
+		t.Errorf("read %q after VerifyOutputFrom, want the next entry", got)
+	}
+	mangled := New(INFO)
+	mangler := new(mangleWriter)
+	mangled.SetOutput(mangler)
+	if err := mangled.VerifyOutputFrom(mangler); err == nil || !strings.Contains(err.Error(), "read back") {
+		t.Errorf("VerifyOutputFrom() with a mangling writer = %v, want an error", err)
+	}
+	var empty bytes.Buffer
+	if err := mangled.VerifyOutputFrom(&empty); !errors.Is(err, io.EOF) {
+		t.Errorf("VerifyOutputFrom() with nothing to read = %v, want %v", err, io.EOF)
+	}
+
+	t.Cleanup(func() { ClearLevel("gcplog_test.verify") })
+	SetLevel("gcplog_test.verify", ERROR)
+	filtered := Named("gcplog_test.verify", INFO)
+	filtered.SetOutput(errWriter{syscall.ENOSPC})
+	for _, l := range []*Logger{New(INFO), NewDiscard(), filtered} {
+		if err := l.VerifyOutput(); err != nil {
+			t.Errorf("VerifyOutput() = %v, want nothing checked", err)
+		}
+	}
+	tests := []struct {
+		name   string
+		w      io.Writer
+		want   error
+		closed bool
+	}{
+		{"closed pipe", errWriter{io.ErrClosedPipe}, io.ErrClosedPipe, true},
+		{"no space", errWriter{syscall.ENOSPC}, syscall.ENOSPC, false},
+		{"short write", shortWriter{10}, io.ErrShortWrite, false},
+	}
+	for _, tt := range tests {
+		logger := New(INFO)
+		logger.SetOutput(tt.w)
+		err := logger.VerifyOutput()
+		if !errors.Is(err, tt.want) || errors.Is(err, ErrClosedOutput) != tt.closed {
+			t.Errorf("%s: VerifyOutput() = %v, want %v, closed %v", tt.name, err, tt.want, tt.closed)
+		}
+	}
+}
+
+func TestPrintErrClosedOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		closed bool
+	}{
+		{"EPIPE", syscall.EPIPE, true},
+		{"stdout EPIPE", &os.PathError{Op: "write", Path: "/dev/stdout", Err: syscall.EPIPE}, true},
+		{"closed pipe", io.ErrClosedPipe, true},
+		{"closed file", &os.PathError{Op: "write", Path: "/dev/stdout", Err: os.ErrClosed}, true},
+		{"short write", io.ErrShortWrite, false},
+		{"no space", syscall.ENOSPC, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := New(ERROR)
+			logger.out = errWriter{tt.err}
+			err := logger.PrintErr("Hello World")
+			if !errors.Is(err, tt.err) {
+				t.Errorf("PrintErr() = %v, want it to wrap %v", err, tt.err)
+			}
+			if got := errors.Is(err, ErrClosedOutput); got != tt.closed {
+				t.Errorf("errors.Is(%v, ErrClosedOutput) = %v, want %v", err, got, tt.closed)
+			}
+			logger.Print("dropped")
+			if got := logger.Counts()[ERROR]; got != 0 {
+				t.Errorf("Counts()[ERROR] = %d after failed writes, want 0", got)
+			}
+		})
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	var buf, errs bytes.Buffer // not safe for concurrent use
+	logger := New(INFO)
+	logger.SetOutput(&buf)
+	logger.SetErrorStream(ERROR, &errs)
+	logger.SetSeverityWriters(map[string]io.Writer{WARNING: &buf})
+	child := logger.With("child", true)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Print("info")
+				child.PrintAt(WARNING, "warning")
+				logger.PrintAt(ERROR, "error")
+			}
+		}()
+	}
+	wg.Wait()
+	for _, out := range []*bytes.Buffer{&buf, &errs} {
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			if !json.Valid([]byte(line)) {
+				t.Fatalf("invalid JSON %q", line)
+			}
+		}
+	}
+	if got, want := strings.Count(buf.String(), "\n"), 800; got != want {
+		t.Errorf("wrote %d entries to the output, want %d", got, want)
+	}
+	if got, want := strings.Count(errs.String(), "\n"), 400; got != want {
+		t.Errorf("wrote %d entries to the error stream, want %d", got, want)
+	}
+}
+
+func TestPrintAt(t *testing.T) {
+	var buf syncBuffer
+	logger := New(INFO)
+	logger.out = &buf
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				logger.PrintAt(WARNING, WARNING)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				logger.PrintfAt("error", "%s", ERROR)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				logger.Print(INFO)
+			}
+		}()
+	}
+	wg.Wait()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1500 {
+		t.Fatalf("wrote %d lines, want 1500", len(lines))
+	}
+	for _, line := range lines {
+		var e struct{ Severity, Message string }
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		if e.Severity != e.Message {
+			t.Errorf("entry %q has severity %q", e.Message, e.Severity)
+		}
+	}
+	if got := logger.Severity(); got != INFO {
+		t.Errorf("Severity() = %q after PrintAt, want %q", got, INFO)
+	}
+}
+
+func TestPrintAtFiltering(t *testing.T) {
+	t.Cleanup(func() { ClearLevel("printat") })
+	SetLevel("printat", WARNING)
+	var buf bytes.Buffer
+	logger := Named("printat", INFO)
+	logger.out = &buf
+	logger.PrintAt(ERROR, "written")
+	logger.Print("suppressed")
+	logger.PrintAt(DEBUG, "suppressed")
+	logger.PrintAt("BOGUS", "suppressed")
+	want := `{"severity":"ERROR","message":"written","logger":"printat"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func ExampleLogger_PrintAt() {
+	logger := New(INFO)
+	logger.PrintAt(WARNING, "Hello World")
+	logger.PrintAt("BOGUS", "Hello World")
+	// Output:
+	// {"severity":"WARNING","message":"Hello World"}
+	// {"severity":"INFO","message":"Hello World"}
+}
+
+func TestTrace(t *testing.T) {
+	t.Cleanup(func() { ClearLevel("trace") })
+	var buf bytes.Buffer
+	logger := Named("trace", TRACE)
+	logger.out = &buf
+	logger.Print("Hello World")
+	logger.PrintAt(DEBUG, "Hello World")
+	want := `{"severity":"DEBUG","message":"Hello World","logger":"trace","logging.googleapis.com/labels":{"gcplog_level":"TRACE"}}` + "\n" +
+		`{"severity":"DEBUG","message":"Hello World","logger":"trace"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	SetLevel("trace", DEBUG)
+	logger.Print("suppressed")
+	logger.PrintAt(DEBUG, "Hello World")
+	want = `{"severity":"DEBUG","message":"Hello World","logger":"trace"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("at DEBUG level got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := logger.Counts()[TRACE]; got != 1 {
+		t.Errorf("Counts()[TRACE] = %d, want 1", got)
+	}
+}
+
+func ExampleLogger_Print_trace() {
+	logger := New(TRACE)
+	logger.Print("Hello World")
+	// Output:
+	// {"severity":"DEBUG","message":"Hello World","logging.googleapis.com/labels":{"gcplog_level":"TRACE"}}
+}
+
+func TestSetTrimSpace(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.Print("  spaced  ")
+	logger.SetTrimSpace(false)
+	logger.Print("  spaced  ")
+	logger.With("a", 1).Print("\tchild\n")
+	logger.SetTrimSpace(true)
+	logger.Print("  spaced  ")
+	want := `{"severity":"INFO","message":"spaced"}` + "\n" +
+		`{"severity":"INFO","message":"  spaced  "}` + "\n" +
+		`{"severity":"INFO","message":"\tchild\n","a":1}` + "\n" +
+		`{"severity":"INFO","message":"spaced"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSetSanitize(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	forged := "login failed\n{\"severity\":\"EMERGENCY\",\"message\":\"forged\"}"
+	logger.Print(forged)
+	logger.Print("progress\r100%\x1b[2K\x00\u0085\tdone")
+	logger.PrintFields("typed", String("user", forged))
+	logger.SetSanitize(false)
+	logger.Print("raw\r\x1b")
+	logger.Print(forged)
+	want := `{"severity":"INFO","message":"login failed\n{\"severity\":\"EMERGENCY\",\"message\":\"forged\"}"}` + "\n" +
+		`{"severity":"INFO","message":"progress\\r100%\\x1b[2K\\x00\\u0085\tdone"}` + "\n" +
+		`{"severity":"INFO","message":"typed","user":"login failed\n{\"severity\":\"EMERGENCY\",\"message\":\"forged\"}"}` + "\n" +
+		`{"severity":"INFO","message":"raw\r\u001b"}` + "\n" +
+		`{"severity":"INFO","message":"login failed\n{\"severity\":\"EMERGENCY\",\"message\":\"forged\"}"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Errorf("invalid JSON %q: %v", line, err)
+		} else if entry["severity"] != INFO {
+			t.Errorf("forged an entry with severity %v", entry["severity"])
+		}
+	}
+}
+
+func TestSetMaxMessageBytes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.Print(strings.Repeat("x", 1000))
+	logger.SetMaxMessageBytes(10)
+	child := logger.With("k", 1)
+	child.Print("exactly 10")
+	child.Print("123456789ö") // "ö" is bytes 10 and 11, so it's left out rather than split
+	child.Print("日本語のテキスト")   // each character is 3 bytes, so 3 fit
+	logger.SetMaxMessageBytes(-5)
+	logger.Print("unlimited again")
+	want := `{"severity":"INFO","message":"` + strings.Repeat("x", 1000) + `"}` + "\n" +
+		`{"severity":"INFO","message":"exactly 10","k":1}` + "\n" +
+		`{"severity":"INFO","message":"123456789…[truncated]","k":1}` + "\n" +
+		`{"severity":"INFO","message":"日本語…[truncated]","k":1}` + "\n" +
+		`{"severity":"INFO","message":"unlimited again"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	for n := 1; n <= len("aé日𝄞"); n++ {
+		if got := truncateMessage("aé日𝄞", n); !utf8.ValidString(got) {
+			t.Errorf("truncateMessage(%d) = %q, which splits a character", n, got)
+		}
+	}
+}
+
+func TestSanitizeMessageNoAllocs(t *testing.T) {
+	if n := testing.AllocsPerRun(100, func() { sanitizeMessage("nothing to escape\n\there") }); n != 0 {
+		t.Errorf("sanitizeMessage allocated %v times for a clean message, want 0", n)
+	}
+}
+
+func TestSetSeverityInt(t *testing.T) {
+	tests := []struct {
+		code int
+		want string
+	}{
+		{0, DEFAULT},
+		{50, TRACE},
+		{100, DEBUG},
+		{200, INFO},
+		{300, NOTICE},
+		{400, WARNING},
+		{500, ERROR},
+		{600, CRITICAL},
+		{700, ALERT},
+		{800, EMERGENCY},
+		{-1, NOTICE},
+		{1, NOTICE},
+		{99, NOTICE},
+		{101, NOTICE},
+		{450, NOTICE},
+		{799, NOTICE},
+		{801, NOTICE},
+		{900, NOTICE},
+	}
+	for _, tt := range tests {
+		logger := New(NOTICE)
+		logger.SetSeverityInt(tt.code)
+		if got := logger.Severity(); got != tt.want {
+			t.Errorf("SetSeverityInt(%d) gave severity %q, want %q", tt.code, got, tt.want)
+		}
+	}
+	for _, sev := range Severities() {
+		logger := New()
+		logger.SetSeverityInt(SeverityLevel(sev))
+		if got := logger.Severity(); got != sev {
+			t.Errorf("SetSeverityInt(SeverityLevel(%q)) gave severity %q", sev, got)
+		}
+	}
+}
+
+func TestSetSeverityVariants(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		want  string
+		valid bool
+	}{
+		{"valid", ERROR, ERROR, true},
+		{"alias", CRIT, CRITICAL, true},
+		{"lowercase", "notice", NOTICE, true},
+		{"short name", "warn", WARNING, true},
+		{"invalid", "WARNINGS", INFO, false},
+		{"empty", "", INFO, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lenient := New(INFO)
+			lenient.SetSeverity(tt.s)
+			if got := lenient.Severity(); got != tt.want {
+				t.Errorf("SetSeverity(%q) gave severity %q, want %q", tt.s, got, tt.want)
+			}
+
+			try := New(INFO)
+			err := try.TrySetSeverity(tt.s)
+			if got := try.Severity(); got != tt.want {
+				t.Errorf("TrySetSeverity(%q) gave severity %q, want %q", tt.s, got, tt.want)
+			}
+			if tt.valid && err != nil {
+				t.Errorf("TrySetSeverity(%q) = %v, want nil", tt.s, err)
+			}
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidSeverity) {
+					t.Errorf("TrySetSeverity(%q) = %v, want ErrInvalidSeverity", tt.s, err)
+				} else if msg := err.Error(); !strings.Contains(msg, fmt.Sprintf("%q", tt.s)) || !strings.Contains(msg, "DEFAULT, TRACE, DEBUG, INFO") {
+					t.Errorf("TrySetSeverity(%q) error %q doesn't include the value and the valid list", tt.s, msg)
+				}
+			}
+
+			must := New(INFO)
+			func() {
+				defer func() {
+					if r := recover(); (r != nil) == tt.valid {
+						t.Errorf("MustSetSeverity(%q) panic = %v, want panic %v", tt.s, r, !tt.valid)
+					}
+				}()
+				must.MustSetSeverity(tt.s)
+			}()
+			if got := must.Severity(); got != tt.want {
+				t.Errorf("MustSetSeverity(%q) gave severity %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixPrintf(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		v      []any
+		want   string
+	}{
+		{"percent", "100%% done", nil, "WARNING: 100% done"},
+		{"width", "[%5d|%-4s]", []any{42, "ab"}, "WARNING: [   42|ab  ]"},
+		{"missing args", "%s and %d", []any{"one"}, "WARNING: one and %!d(MISSING)"},
+		{"extra args", "%s", []any{"one", 2}, "WARNING: one%!(EXTRA int=2)"},
+		{"verbs in args", "%s", []any{"%s%d"}, "WARNING: %s%d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(WARNING)
+			logger.out = &buf
+			logger.PrefixPrintf(tt.format, tt.v...)
+			var e struct{ Message string }
+			if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+				t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+			}
+			if e.Message != tt.want {
+				t.Errorf("PrefixPrintf(%q) message = %q, want %q", tt.format, e.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetErrorStream(t *testing.T) {
+	var out, errs bytes.Buffer
+	logger := New(INFO)
+	logger.out = &out
+	logger.SetErrorStream(ERROR, &errs)
+	logger.Print("info")
+	logger.PrintAt(ERROR, "error")
+	logger.PrintAt(ALERT, "alert")
+	logger.WithSeverityRemap(map[string]string{INFO: CRITICAL}).Print("remapped")
+	logger.SetErrorStream(ERROR, nil)
+	logger.PrintAt(ERROR, "unset")
+	wantOut := `{"severity":"INFO","message":"info"}` + "\n" +
+		`{"severity":"ERROR","message":"unset"}` + "\n"
+	wantErrs := `{"severity":"ERROR","message":"error"}` + "\n" +
+		`{"severity":"ALERT","message":"alert"}` + "\n" +
+		`{"severity":"CRITICAL","message":"remapped"}` + "\n"
+	if got := out.String(); got != wantOut {
+		t.Errorf("normal writer got:\n%s\nwant:\n%s", got, wantOut)
+	}
+	if got := errs.String(); got != wantErrs {
+		t.Errorf("error writer got:\n%s\nwant:\n%s", got, wantErrs)
+	}
+}
+
+func TestSetIndent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).With("db", map[string]any{"rows": 3, "tables": []string{"a", "b"}}).WithLabel("env", "prod")
+	logger.out = &buf
+	logger.SetIndent("", "  ")
+	logger.Print("indented <html>")
+	logger.SetIndent("", "")
+	logger.Print("compact")
+	logger.Print("compact again")
+	want := `{
+  "severity": "INFO",
+  "message": "indented \u003chtml\u003e",
+  "db": {
+    "rows": 3,
+    "tables": [
+      "a",
+      "b"
+    ]
+  },
+  "logging.googleapis.com/labels": {
+    "env": "prod"
+  }
+}
+{"severity":"INFO","message":"compact","db":{"rows":3,"tables":["a","b"]},"logging.googleapis.com/labels":{"env":"prod"}}
+{"severity":"INFO","message":"compact again","db":{"rows":3,"tables":["a","b"]},"logging.googleapis.com/labels":{"env":"prod"}}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	dec := json.NewDecoder(&buf)
+	for n := 0; dec.More(); n++ {
+		var e map[string]any
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("entry %d isn't valid JSON: %v", n, err)
+		}
+	}
+}
+
+func ExampleLogger_SetIndent() {
+	logger := New(INFO)
+	logger.SetIndent("", "\t")
+	logger.Print("Hello World")
+	// Output:
+	// {
+	// 	"severity": "INFO",
+	// 	"message": "Hello World"
+	// }
+}
+
+func TestSetSeverityWriters(t *testing.T) {
+	var out, debug, errs, alerts bytes.Buffer
+	logger := New(INFO)
+	logger.out = &out
+	logger.SetErrorStream(ERROR, &errs)
+	writers := map[string]io.Writer{"debug": &debug, ALERT: &alerts, WARNING: nil, "LOUD": &alerts}
+	logger.SetSeverityWriters(writers)
+	writers[INFO] = &debug
+	child := logger.WithField("child", true)
+	logger.Print("info")
+	logger.PrintAt(DEBUG, "debug")
+	logger.PrintAt(WARNING, "warning")
+	logger.PrintAt(ERROR, "error")
+	child.PrintAt(ALERT, "alert")
+	logger.SetSeverityWriters(nil)
+	logger.PrintAt(DEBUG, "unset")
+	tests := []struct {
+		name string
+		buf  *bytes.Buffer
+		want string
+	}{
+		{"default", &out, `{"severity":"INFO","message":"info"}` + "\n" +
+			`{"severity":"WARNING","message":"warning"}` + "\n" +
+			`{"severity":"DEBUG","message":"unset"}` + "\n"},
+		{"debug", &debug, `{"severity":"DEBUG","message":"debug"}` + "\n"},
+		{"error stream", &errs, `{"severity":"ERROR","message":"error"}` + "\n"},
+		{"alert", &alerts, `{"severity":"ALERT","message":"alert","child":true}` + "\n"},
+	}
+	for _, tt := range tests {
+		if got := tt.buf.String(); got != tt.want {
+			t.Errorf("%s writer got:\n%s\nwant:\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewDiscardSeverityWriters(t *testing.T) {
+	var errs bytes.Buffer
+	logger := NewDiscard()
+	logger.SetSeverityWriters(map[string]io.Writer{ERROR: &errs})
+	logger.Print("dropped")
+	logger.PrintAt(ERROR, "kept")
+	if got, want := errs.String(), `{"severity":"ERROR","message":"kept"}`+"\n"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestSeverityNormalized(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"warning", WARNING},
+		{"Notice", NOTICE},
+		{"warn", WARNING},
+		{"err", ERROR},
+		{"CRIT", CRITICAL},
+		{"trace", TRACE},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		logger := New(tt.in)
+		logger.out = &buf
+		if got := logger.Severity(); got != tt.want {
+			t.Errorf("New(%q).Severity() = %q, want %q", tt.in, got, tt.want)
+		}
+		logger = New(INFO)
+		logger.out = &buf
+		logger.SetSeverity(tt.in)
+		if got := logger.Severity(); got != tt.want {
+			t.Errorf("SetSeverity(%q) gave severity %q, want %q", tt.in, got, tt.want)
+		}
+		logger.Print("x")
+		logger.SetSeverity(INFO)
+		logger.PrintAt(tt.in, "x")
+		severity := tt.want
+		if severity == TRACE {
+			severity = DEBUG
+		}
+		if got := buf.String(); !strings.HasPrefix(got, `{"severity":"`+severity+`","message":"x"`) ||
+			strings.Count(got, `{"severity":"`+severity+`"`) != 2 {
+			t.Errorf("severity %q wrote:\n%s", tt.in, got)
+		}
+	}
+}
+
+func TestAt(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).With("a", 1)
+	logger.out = &buf
+	logger.At(WARNING).Print("warned")
+	logger.At("crit").Printf("%d", 2)
+	logger.At("BOGUS").Print("kept")
+	logger.Print("parent")
+	want := `{"severity":"WARNING","message":"warned","a":1}` + "\n" +
+		`{"severity":"CRITICAL","message":"2","a":1}` + "\n" +
+		`{"severity":"INFO","message":"kept","a":1}` + "\n" +
+		`{"severity":"INFO","message":"parent","a":1}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := logger.Counts()[WARNING]; got != 1 {
+		t.Errorf("Counts()[WARNING] = %d, want the child to share the parent's counts", got)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	logger := New(INFO)
+	if logger.Writer() != os.Stdout {
+		t.Errorf("Writer() = %v, want os.Stdout by default", logger.Writer())
+	}
+	var first, second bytes.Buffer
+	logger.SetOutput(&first)
+	if logger.Writer() != &first {
+		t.Errorf("Writer() = %v, want the writer passed to SetOutput", logger.Writer())
+	}
+	child := logger.With("a", 1)
+	logger.SetBuffered(1<<20, ERROR)
+	logger.Print("buffered")
+	logger.SetOutput(&second)
+	logger.Print("moved")
+	if err := logger.Flush(); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	child.Print("child")
+	if got, want := first.String(), `{"severity":"INFO","message":"buffered"}`+"\n"+`{"severity":"INFO","message":"child","a":1}`+"\n"; got != want {
+		t.Errorf("first writer got:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := second.String(), `{"severity":"INFO","message":"moved"}`+"\n"; got != want {
+		t.Errorf("second writer got:\n%s\nwant:\n%s", got, want)
+	}
+	logger.SetOutput(nil)
+	if logger.Writer() != os.Stdout {
+		t.Errorf("Writer() after SetOutput(nil) = %v, want os.Stdout", logger.Writer())
+	}
+}
+
+func TestSetOutputSharedBuffer(t *testing.T) {
+	var first, second bytes.Buffer
+	parent := New(INFO)
+	parent.SetOutput(&first)
+	parent.SetBuffered(1<<20, ERROR)
+	child := parent.With("child", true)
+	parent.Print("parent before")
+	child.Print("child before")
+	child.SetOutput(&second)
+	flushed := first.String()
+	parent.Print("parent after")
+	child.Print("child after")
+	if first.String() != flushed || second.Len() != 0 {
+		t.Fatalf("entries written before a flush:\n%s%s", first.String(), second.String())
+	}
+	for _, l := range []*Logger{parent, child} {
+		if err := l.Flush(); err != nil {
+			t.Fatalf("Flush() = %v", err)
+		}
+	}
+	want := `{"severity":"INFO","message":"parent before"}` + "\n" +
+		`{"severity":"INFO","message":"child before","child":true}` + "\n" +
+		`{"severity":"INFO","message":"parent after"}` + "\n"
+	if got := first.String(); got != want {
+		t.Errorf("first writer got:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := second.String(), `{"severity":"INFO","message":"child after","child":true}`+"\n"; got != want {
+		t.Errorf("second writer got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLog(t *testing.T) {
+	severityFor := func(status int) string {
+		switch {
+		case status >= 500:
+			return ERROR
+		case status >= 400:
+			return "warn"
+		}
+		return "bogus"
+	}
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	for _, status := range []int{503, 404, 200} {
+		logger.Logf(severityFor(status), "status %d", status)
+	}
+	logger.Log(NOTICE, "done ", 3)
+	want := `{"severity":"ERROR","message":"status 503"}` + "\n" +
+		`{"severity":"WARNING","message":"status 404"}` + "\n" +
+		`{"severity":"INFO","message":"status 200"}` + "\n" +
+		`{"severity":"NOTICE","message":"done 3"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if logger.Severity() != INFO {
+		t.Errorf("Log changed the severity of the Logger to %q", logger.Severity())
+	}
+}
+
+func TestNewDiscard(t *testing.T) {
+	logger := NewDiscard(INFO)
+	called := false
+	logger.AddHook(func(string, string) { called = true })
+	logger.Print("Hello World")
+	logger.With("a", 1).Printf("%d", 2)
+	if called {
+		t.Error("a discarded entry called a hook")
+	}
+	if logger.Writer() != io.Discard {
+		t.Errorf("Writer() = %v, want io.Discard", logger.Writer())
+	}
+	if got := logger.Counts()[INFO]; got != 0 {
+		t.Errorf("Counts()[INFO] = %d, want discarded entries not to be counted", got)
+	}
+
+	var buf bytes.Buffer
+	logger.SetErrorStream(ERROR, &buf)
+	logger.Print("discarded")
+	logger.PrintAt(ERROR, "kept")
+	if got, want := buf.String(), `{"severity":"ERROR","message":"kept"}`+"\n"; got != want {
+		t.Errorf("error stream got %s, want %s", got, want)
+	}
+	logger.SetOutput(&buf)
+	logger.Print("written")
+	if !strings.HasSuffix(buf.String(), `{"severity":"INFO","message":"written"}`+"\n") {
+		t.Errorf("SetOutput didn't replace io.Discard: %s", buf.String())
+	}
+}
+
+func BenchmarkNewDiscard(b *testing.B) {
+	logger := NewDiscard(INFO)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Print("Hello World")
+		logger.Printf("Hello %s", "World")
+		logger.PrintAt(ERROR, "Hello World")
+	}
+	if allocs := testing.AllocsPerRun(100, func() { logger.Printf("Hello %s", "World") }); allocs != 0 {
+		b.Errorf("Printf allocated %v times per run, want 0", allocs)
+	}
+}
+
+func TestAppendEntry(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithComponent("orders").With("user", "ann", "n", 3).WithLabel("env", "prod").WithTrace("p", "t")
+	logger.out = &buf
+	logger.AddHook(func(severity, message string) { t.Errorf("AppendEntry called a hook with %q", message) })
+	got := logger.AppendEntry([]byte("prefix "), "warn", "  Hello World  ")
+	want := `prefix {"severity":"WARNING","message":"Hello World","component":"orders","n":3,"user":"ann",` +
+		`"logging.googleapis.com/labels":{"env":"prod"},"logging.googleapis.com/trace":"projects/p/traces/t","logging.googleapis.com/trace_sampled":true}`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := string(logger.AppendEntry(nil, "BOGUS", "default")); got != `{"severity":"INFO","message":"default","component":"orders","n":3,"user":"ann",`+
+		`"logging.googleapis.com/labels":{"env":"prod"},"logging.googleapis.com/trace":"projects/p/traces/t","logging.googleapis.com/trace_sampled":true}` {
+		t.Errorf("AppendEntry with an invalid severity = %s", got)
+	}
+	if buf.Len() != 0 || logger.Counts()[WARNING] != 0 {
+		t.Errorf("AppendEntry wrote %q", buf.String())
+	}
+}
+
+func TestAppendEntryMatchesPrint(t *testing.T) {
+	// newLogger returns a Logger with most of the settings which change entries, and the errors reported by it.
+	newLogger := func(w io.Writer) (*Logger, *[]error) {
+		var reported []error
+		logger := New(INFO).With("card", "4111 1111 1111 1111", "id", int64(1)<<60, "raw", []byte("hi")).
+			WithMasking(regexp.MustCompile(`\d{4} \d{4} \d{4} \d{4}`)).WithInt64AsString().WithBytesEncoding(BytesHex).
+			WithTextFields(TextFieldsAppend).WithJSONDetection(JSONDetectKeepRaw).WithLabel("env", "prod")
+		logger.out = w
+		logger.SetErrorHandler(func(err error) { reported = append(reported, err) })
+		logger.SetMessageTransform(strings.ToUpper)
+		return logger, &reported
+	}
+	for _, msg := range []string{"  card 4111 1111 1111 1111  ", `{"message":"reserved","k":1}`} {
+		var buf bytes.Buffer
+		printer, printed := newLogger(&buf)
+		appender, appended := newLogger(nil)
+		printer.PrintAt(WARNING, msg)
+		if got, want := string(appender.AppendEntry(nil, WARNING, msg))+"\n", buf.String(); got != want {
+			t.Errorf("AppendEntry(%q):\n%s\nPrint:\n%s", msg, got, want)
+		}
+		if fmt.Sprint(*appended) != fmt.Sprint(*printed) {
+			t.Errorf("%q: AppendEntry reported %v, Print reported %v", msg, *appended, *printed)
+		}
+	}
+	if got := string(NewDiscard().AppendEntry(nil, INFO, "built")); got != `{"severity":"INFO","message":"built"}` {
+		t.Errorf("AppendEntry on a discarding Logger = %s", got)
+	}
+}
+
+func TestAppendEntryNoAllocs(t *testing.T) {
+	logger := New(INFO).With("user", "ann", "n", 3, "ok", true).WithLabel("env", "prod").WithTrace("p", "t").WithTimestamps()
+	dst := make([]byte, 0, 1024)
+	if n := testing.AllocsPerRun(100, func() { dst = logger.AppendEntry(dst[:0], ERROR, "Hello World") }); n != 0 {
+		t.Errorf("AppendEntry allocated %v times, want 0", n)
+	}
+}
+
+func BenchmarkAppendEntry(b *testing.B) {
+	logger := New(INFO).With("user", "ann", "n", 3, "ok", true)
+	dst := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dst = logger.AppendEntry(dst[:0], INFO, "Hello World")
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	t.Cleanup(func() { ClearLevel("gcplog_test.enabled") })
+	SetLevel("gcplog_test.enabled", WARNING)
+	named := Named("gcplog_test.enabled", INFO)
+	tests := []struct {
+		name   string
+		logger *Logger
+		want   bool
+	}{
+		{"default", New(DEBUG), true},
+		{"below level", named, false},
+		{"at level", named.At(WARNING), true},
+		{"child below level", named.Named("db"), false},
+		{"remapped above level", named.WithSeverityRemap(map[string]string{INFO: ERROR}), true},
+		{"remapped below level", named.At(ERROR).WithSeverityRemap(map[string]string{ERROR: DEBUG}), false},
+		{"all sampled out", New(DEBUG).WithSampling(DEBUG, 0), false},
+		{"some sampled out", New(DEBUG).WithSampling(DEBUG, 0.5), true},
+		{"other severity sampled out", New(INFO).WithSampling(DEBUG, 0), true},
+		{"discard", NewDiscard(ERROR), false},
+	}
+	for _, tt := range tests {
+		if got := tt.logger.Enabled(); got != tt.want {
+			t.Errorf("%s: Enabled() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	discard := NewDiscard(ERROR)
+	discard.SetErrorStream(ERROR, io.Discard)
+	if !discard.Enabled() {
+		t.Error("Enabled() = false for a discard Logger with an error stream, want true")
+	}
+}
+
+func TestPrintLines(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).With("cmd", "make")
+	logger.out = &buf
+	logger.At(WARNING).PrintLines("first\n\n  \nsecond\r\n  indented\nlast\n\n")
+	logger.PrintLines("")
+	logger.PrintLines("\n\r\n")
+	logger.PrintLines("no newline")
+	want := `{"severity":"WARNING","message":"first","cmd":"make"}` + "\n" +
+		`{"severity":"WARNING","message":"second","cmd":"make"}` + "\n" +
+		`{"severity":"WARNING","message":"indented","cmd":"make"}` + "\n" +
+		`{"severity":"WARNING","message":"last","cmd":"make"}` + "\n" +
+		`{"severity":"INFO","message":"no newline","cmd":"make"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrintFunc(t *testing.T) {
+	t.Cleanup(func() { ClearLevel("gcplog_test.printfunc") })
+	SetLevel("gcplog_test.printfunc", WARNING)
+	var buf bytes.Buffer
+	logger := Named("gcplog_test.printfunc", INFO)
+	logger.out = &buf
+	calls := 0
+	fn := func() string { calls++; return "expensive" }
+	logger.PrintFunc(fn)
+	sampled := New(DEBUG).WithSampling(DEBUG, 0)
+	sampled.out = &buf
+	sampled.PrintFunc(fn)
+	logger.At(WARNING).PrintFunc(fn)
+	logger.At(ERROR).PrintFunc(nil)
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+	want := `{"severity":"WARNING","message":"expensive","logger":"gcplog_test.printfunc"}` + "\n" +
+		`{"severity":"ERROR","message":"","logger":"gcplog_test.printfunc"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package gcplogtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/tinyinput/gcplog"
+)
+
+// labelsKey is the key Cloud Logging uses for the labels of a log entry.
+const labelsKey = "logging.googleapis.com/labels"
+
+// Entry is a log entry captured by a Capture.
+type Entry struct {
+	Severity string            // the severity as it was written, so TRACE entries have DEBUG, with a "gcplog_level" label
+	Message  string            // the message
+	Fields   map[string]any    // every other member of the entry, or of its jsonPayload in the LogEntry format, decoded by encoding/json, so numbers are float64
+	Labels   map[string]string // the Cloud Logging labels, or nil if there are none
+}
+
+// Capture is an io.Writer which parses the log entries written to it, keeping them in order. It's safe for concurrent use.
+type Capture struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewCapture returns a pointer to a new Logger with the provided severity, as gcplog.New takes, which writes to a new Capture,
+// and the Capture, for example:
+//
+//	logger, capture := gcplogtest.NewCapture(gcplog.INFO)
+//	placeOrder(logger)
+//	if e := capture.Entries(); len(e) != 1 || e[0].Severity != gcplog.ERROR {
+//		t.Errorf("got entries %v", e)
+//	}
+func NewCapture(s ...string) (*gcplog.Logger, *Capture) {
+	c := new(Capture)
+	l := gcplog.New(s...)
+	l.SetOutput(c)
+	return l, c
+}
+
+// Write parses the log entries in p and keeps them. Entries in the LogEntry format, see gcplog.Logger.SetLogEntryFormat, are
+// understood too. Entries must be written with the default severity and message keys, and each call must hold whole entries,
+// as a Logger's writes do. An error is returned if p holds anything else, and then none of the entries in p are kept.
+func (c *Capture) Write(p []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	var entries []Entry
+	for {
+		var members map[string]any
+		if err := dec.Decode(&members); err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("gcplogtest: can't parse the log entry: %w", err)
+		}
+		entries = append(entries, parseEntry(members))
+	}
+	c.mu.Lock()
+	c.entries = append(c.entries, entries...)
+	c.mu.Unlock()
+	return len(p), nil
+}
+
+// Entries returns the entries captured so far, in the order they were written. The returned slice is a copy.
+func (c *Capture) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := make([]Entry, len(c.entries))
+	copy(entries, c.entries)
+	return entries
+}
+
+// Reset removes all of the entries captured so far.
+func (c *Capture) Reset() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
+
+// parseEntry returns the Entry for the members of a log entry, which it takes ownership of.
+func parseEntry(members map[string]any) Entry {
+	var e Entry
+	e.Severity, _ = members["severity"].(string)
+	delete(members, "severity")
+	labels := members[labelsKey]
+	delete(members, labelsKey)
+	if payload, ok := members["jsonPayload"].(map[string]any); ok {
+		labels = members["labels"]
+		members = payload
+	}
+	e.Message, _ = members["message"].(string)
+	delete(members, "message")
+	if l, ok := labels.(map[string]any); ok {
+		e.Labels = make(map[string]string, len(l))
+		for k, v := range l {
+			e.Labels[k], _ = v.(string)
+		}
+	}
+	e.Fields = members
+	return e
+}
@@ -0,0 +1,65 @@
+package gcplogtest
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/tinyinput/gcplog"
+)
+
+func TestCapture(t *testing.T) {
+	logger, capture := NewCapture(gcplog.INFO)
+	logger.WithLabel("env", "test").With("orderId", 1234).Print("saved")
+	logger.At(gcplog.ERROR).Printw("failed", "retry", true)
+	logger.SetIndent("", "  ")
+	logger.At(gcplog.TRACE).Print("indented")
+	logger.SetIndent("", "")
+	logger.SetLogEntryFormat(true)
+	logger.WithLabel("env", "test").Printw("api", "items", 3)
+	want := []Entry{
+		{Severity: gcplog.INFO, Message: "saved", Fields: map[string]any{"orderId": float64(1234)}, Labels: map[string]string{"env": "test"}},
+		{Severity: gcplog.ERROR, Message: "failed", Fields: map[string]any{"retry": true}},
+		{Severity: gcplog.DEBUG, Message: "indented", Fields: map[string]any{}, Labels: map[string]string{"gcplog_level": gcplog.TRACE}},
+		{Severity: gcplog.INFO, Message: "api", Fields: map[string]any{"items": float64(3)}, Labels: map[string]string{"env": "test"}},
+	}
+	if got := capture.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() = %#v, want %#v", got, want)
+	}
+	capture.Entries()[0].Message = "changed"
+	if got := capture.Entries()[0].Message; got != "saved" {
+		t.Errorf("changing the result of Entries() changed the Capture: %q", got)
+	}
+	capture.Reset()
+	if got := capture.Entries(); len(got) != 0 {
+		t.Errorf("Entries() after Reset = %v, want none", got)
+	}
+}
+
+func TestCaptureInvalid(t *testing.T) {
+	var c Capture
+	if n, err := c.Write([]byte(`{"severity":"INFO","message":"ok"}` + "\n" + `not json`)); err == nil || n != 0 {
+		t.Errorf("Write() of invalid JSON = %d, %v, want 0 and an error", n, err)
+	}
+	if got := c.Entries(); len(got) != 0 {
+		t.Errorf("Entries() = %v, want none from the failed write", got)
+	}
+}
+
+func TestCaptureConcurrent(t *testing.T) {
+	logger, capture := NewCapture()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				logger.Print("entry")
+			}
+		}()
+	}
+	wg.Wait()
+	if got := len(capture.Entries()); got != 100 {
+		t.Errorf("captured %d entries, want 100", got)
+	}
+}
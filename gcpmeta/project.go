@@ -0,0 +1,113 @@
+// Package gcpmeta finds details of the Google Cloud environment a program is running in, such as the project ID
+// to pass to gcplog's SetProjectID. It's separate from gcplog so programs which don't need it don't depend on net/http.
+package gcpmeta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	projectEnv      = "GOOGLE_CLOUD_PROJECT"                   // the environment variable with the project ID, set by some Google Cloud runtimes
+	metadataHostEnv = "GCE_METADATA_HOST"                      // the environment variable which overrides the metadata server host, as used by Google's client libraries
+	metadataHost    = "metadata.google.internal"               // the metadata server host on Google Cloud
+	projectIDPath   = "/computeMetadata/v1/project/project-id" // the path of the project ID on the metadata server
+	timeout         = 2 * time.Second                          // how long to wait for the metadata server, which answers quickly on Google Cloud
+)
+
+// ErrProjectIDNotFound is returned, wrapped with more detail, when DetectProjectID can't find the project ID.
+var ErrProjectIDNotFound = errors.New("gcpmeta: project ID not found")
+
+var (
+	client = &http.Client{Transport: directTransport()} // the client used to query the metadata server
+
+	mu     sync.Mutex // guards result
+	result *lookup    // the query to the metadata server, or nil before DetectProjectID first needs it
+)
+
+// lookup is a query to the metadata server for the project ID, which is made once and shared by every call to DetectProjectID.
+type lookup struct {
+	done chan struct{} // closed once id and err are set
+	id   string
+	err  error
+}
+
+// directTransport returns a copy of http.DefaultTransport which never uses a proxy, as the metadata server is a link-local
+// address which can only be reached directly, even when HTTP_PROXY or HTTPS_PROXY are set for other requests.
+func directTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	return t
+}
+
+// DetectProjectID returns the ID of the Google Cloud project the program is running in. It uses the GOOGLE_CLOUD_PROJECT
+// environment variable if it's set, and otherwise asks the metadata server, which is given at most two seconds to answer.
+// The metadata server host can be changed with the GCE_METADATA_HOST environment variable.
+//
+// The metadata server is only asked once, and its answer, or the failure, is kept for later calls. Calls made while it's being asked
+// wait for the same answer, or until their ctx is done, so a call with a cancelled ctx returns straight away.
+// When the project ID can't be found, for example when the program isn't running on Google Cloud, the error wraps ErrProjectIDNotFound.
+func DetectProjectID(ctx context.Context) (string, error) {
+	if id := strings.TrimSpace(os.Getenv(projectEnv)); id != "" {
+		return id, nil
+	}
+	mu.Lock()
+	l := result
+	if l == nil {
+		l = &lookup{done: make(chan struct{})}
+		result = l
+		go func() {
+			l.id, l.err = queryProjectID(context.Background())
+			close(l.done)
+		}()
+	}
+	mu.Unlock()
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return "", fmt.Errorf("%w: %w", ErrProjectIDNotFound, ctx.Err())
+	}
+	if l.err != nil {
+		return "", fmt.Errorf("%w: %w", ErrProjectIDNotFound, l.err)
+	}
+	return l.id, nil
+}
+
+// queryProjectID asks the metadata server for the project ID.
+func queryProjectID(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	host := metadataHost
+	if h := os.Getenv(metadataHostEnv); h != "" {
+		host = h
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+projectIDPath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server returned %s", resp.Status)
+	}
+	id := strings.TrimSpace(string(body))
+	if id == "" {
+		return "", errors.New("metadata server returned an empty project ID")
+	}
+	return id, nil
+}
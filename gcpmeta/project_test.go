@@ -0,0 +1,117 @@
+package gcpmeta
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveMetadata starts a fake metadata server with the provided handler, and points DetectProjectID at it,
+// with no environment variable and nothing cached.
+func serveMetadata(t *testing.T, h http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	t.Setenv(projectEnv, "")
+	t.Setenv(metadataHostEnv, strings.TrimPrefix(srv.URL, "http://"))
+	mu.Lock()
+	result = nil
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		result = nil
+		mu.Unlock()
+	})
+}
+
+func TestDetectProjectID(t *testing.T) {
+	var calls int
+	serveMetadata(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != projectIDPath || r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Metadata-Flavor", "Google")
+		_, _ = w.Write([]byte("my-project\n"))
+	})
+	for i := 0; i < 2; i++ {
+		id, err := DetectProjectID(context.Background())
+		if id != "my-project" || err != nil {
+			t.Errorf("DetectProjectID() = %q, %v, want %q", id, err, "my-project")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("metadata server called %d times, want 1", calls)
+	}
+}
+
+func TestDetectProjectIDEnv(t *testing.T) {
+	serveMetadata(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("metadata server called when GOOGLE_CLOUD_PROJECT is set")
+	})
+	t.Setenv(projectEnv, "env-project")
+	if id, err := DetectProjectID(context.Background()); id != "env-project" || err != nil {
+		t.Errorf("DetectProjectID() = %q, %v, want %q", id, err, "env-project")
+	}
+}
+
+func TestDetectProjectIDErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		h    http.HandlerFunc
+	}{
+		{"status", func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) }},
+		{"empty", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte(" \n")) }},
+	}
+	for _, tt := range tests {
+		var calls atomic.Int32
+		serveMetadata(t, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			tt.h(w, r)
+		})
+		for i := 0; i < 2; i++ {
+			if id, err := DetectProjectID(context.Background()); id != "" || !errors.Is(err, ErrProjectIDNotFound) {
+				t.Errorf("%s: DetectProjectID() = %q, %v, want %v", tt.name, id, err, ErrProjectIDNotFound)
+			}
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("%s: metadata server called %d times, want the failure kept after 1", tt.name, n)
+		}
+	}
+}
+
+func TestDetectProjectIDContext(t *testing.T) {
+	release := make(chan struct{})
+	serveMetadata(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := DetectProjectID(ctx)
+	if !errors.Is(err, ErrProjectIDNotFound) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DetectProjectID() error = %v, want %v and %v", err, ErrProjectIDNotFound, context.DeadlineExceeded)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	_, err = DetectProjectID(cancelled)
+	if !errors.Is(err, context.Canceled) || time.Since(start) > time.Second {
+		t.Errorf("DetectProjectID() with a cancelled context = %v after %v, want %v straight away", err, time.Since(start), context.Canceled)
+	}
+}
+
+func TestDirectTransport(t *testing.T) {
+	if tr, ok := client.Transport.(*http.Transport); !ok || tr.Proxy != nil {
+		t.Errorf("client.Transport = %#v, want an *http.Transport without a proxy", client.Transport)
+	}
+}
@@ -0,0 +1,24 @@
+module github.com/tinyinput/gcplog/grpcinterceptor
+
+go 1.21
+
+// To build against a local copy of gcplog, run this in the repository root, creating a go.work file, which isn't committed:
+//
+//	go work init . ./grpcinterceptor
+//
+// If the gcplog version required below hasn't been published yet, replace it with the local copy too:
+//
+//	go work edit -replace github.com/tinyinput/gcplog@v0.0.0-20261015082654-22f065373a31=./
+
+require (
+	github.com/tinyinput/gcplog v0.0.0-20261015082654-22f065373a31
+	google.golang.org/grpc v1.64.0
+)
+
+require (
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
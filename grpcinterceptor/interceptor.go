@@ -0,0 +1,128 @@
+// Package grpcinterceptor provides gRPC server interceptors which log every RPC with a gcplog.Logger.
+//
+// It's a separate module, so programs which use gcplog without gRPC don't depend on it.
+package grpcinterceptor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tinyinput/gcplog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a grpc.UnaryServerInterceptor which writes a log entry for every unary RPC once it's finished,
+// with the method, the status code and the duration as structured fields in a "grpc" group, at the severity given by SeverityForCode.
+//
+// If the incoming metadata has an "x-cloud-trace-context" or "traceparent" header, then the entry is linked to the trace,
+// in the project named by the GOOGLE_CLOUD_PROJECT environment variable, or the project set on the Logger by SetProjectID
+// if the variable isn't set. Without a project the trace isn't added, as Cloud Logging can't link it.
+// The duration is measured with the Clock of the Logger, set by WithClock.
+func UnaryServerInterceptor(l *gcplog.Logger) grpc.UnaryServerInterceptor {
+	project := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := l.Now()
+		resp, err := handler(ctx, req)
+		logRPC(ctx, l, project, info.FullMethod, "unary", start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a grpc.StreamServerInterceptor which writes a log entry for every streaming RPC once it's finished,
+// in the same way as UnaryServerInterceptor.
+func StreamServerInterceptor(l *gcplog.Logger) grpc.StreamServerInterceptor {
+	project := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := l.Now()
+		err := handler(srv, ss)
+		logRPC(ss.Context(), l, project, info.FullMethod, "stream", start, err)
+		return err
+	}
+}
+
+// SeverityForCode returns the severity that an RPC which finished with the provided status code is logged at.
+// Codes which are usually caused by the client, like NotFound, are INFO, codes which may need attention, like Unavailable, are WARNING,
+// and codes which mean the server is broken, like Internal, are ERROR.
+func SeverityForCode(code codes.Code) string {
+	switch code {
+	case codes.OK, codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.Unauthenticated:
+		return gcplog.INFO
+	case codes.DeadlineExceeded, codes.PermissionDenied, codes.ResourceExhausted, codes.FailedPrecondition,
+		codes.Aborted, codes.OutOfRange, codes.Unavailable:
+		return gcplog.WARNING
+	}
+	return gcplog.ERROR
+}
+
+// logRPC writes the log entry for a finished RPC, with its fields in a "grpc" group.
+func logRPC(ctx context.Context, l *gcplog.Logger, project, method, kind string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := []any{
+		gcplog.String("method", method),
+		gcplog.String("kind", kind),
+		gcplog.String("code", code.String()),
+		gcplog.Duration("duration", l.Now().Sub(start)),
+	}
+	if err != nil {
+		fields = append(fields, gcplog.Err(err))
+	}
+	if project == "" {
+		project = l.ProjectID()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && project != "" {
+		if traceID, spanID, sampled, ok := traceFromMetadata(md); ok {
+			l = l.WithTrace(project, traceID).WithSpanID(spanID)
+			if sampled != nil {
+				l = l.WithTraceSampled(*sampled)
+			}
+		}
+	}
+	l.WithGroup("grpc").With(fields...).PrintAt(SeverityForCode(code), method+" "+code.String())
+}
+
+// traceFromMetadata returns the trace ID, span ID and sampling decision from the "x-cloud-trace-context" header,
+// or the W3C "traceparent" header if there isn't one. The sampling decision is nil if the header doesn't include one.
+// The span ID is returned as 16 hexadecimal digits, as Cloud Logging expects, or "" if it isn't valid.
+func traceFromMetadata(md metadata.MD) (traceID, spanID string, sampled *bool, ok bool) {
+	if v := md.Get("x-cloud-trace-context"); len(v) > 0 {
+		// TRACE_ID/SPAN_ID;o=OPTIONS, where the span ID and options are optional, and the span ID is decimal.
+		trace, opts, _ := strings.Cut(v[0], ";")
+		traceID, spanID, _ = strings.Cut(trace, "/")
+		spanID = hexSpanID(spanID)
+		if o, found := strings.CutPrefix(opts, "o="); found {
+			s := o == "1"
+			sampled = &s
+		}
+		return traceID, spanID, sampled, traceID != ""
+	}
+	if v := md.Get("traceparent"); len(v) > 0 {
+		// VERSION-TRACE_ID-SPAN_ID-FLAGS, where bit 0 of the flags is the sampling decision.
+		parts := strings.Split(v[0], "-")
+		if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+			return "", "", nil, false
+		}
+		flags, err := strconv.ParseUint(parts[3], 16, 8)
+		if err != nil {
+			return "", "", nil, false
+		}
+		s := flags&1 == 1
+		return parts[1], parts[2], &s, true
+	}
+	return "", "", nil, false
+}
+
+// hexSpanID returns the decimal span ID of an "x-cloud-trace-context" header as 16 hexadecimal digits, or "" if it isn't valid.
+func hexSpanID(decimal string) string {
+	id, err := strconv.ParseUint(decimal, 10, 64)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%016x", id)
+}
@@ -0,0 +1,143 @@
+package grpcinterceptor
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tinyinput/gcplog"
+	"github.com/tinyinput/gcplog/gcplogtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newClock returns a Clock for tests, and a function which advances it by 1.5 seconds, for handlers to call.
+func newClock() (*gcplogtest.Clock, func()) {
+	clock := gcplogtest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	return clock, func() { clock.Advance(1500 * time.Millisecond) }
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "my-project")
+	var buf bytes.Buffer
+	clock, work := newClock()
+	logger := gcplog.New(gcplog.DEBUG).WithClock(clock)
+	logger.SetOutput(&buf)
+	intercept := UnaryServerInterceptor(logger)
+	info := &grpc.UnaryServerInfo{FullMethod: "/orders.Orders/Get"}
+
+	resp, err := intercept(context.Background(), "req", info, func(ctx context.Context, req any) (any, error) {
+		work()
+		return "resp", nil
+	})
+	if resp != "resp" || err != nil {
+		t.Errorf("interceptor returned %v, %v, want the handler's response", resp, err)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-cloud-trace-context", "abc123/42;o=0"))
+	_, err = intercept(ctx, "req", info, func(ctx context.Context, req any) (any, error) {
+		work()
+		return nil, status.Error(codes.Internal, "database is down")
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("interceptor returned %v, want the handler's error", err)
+	}
+	want := `{"severity":"INFO","message":"/orders.Orders/Get OK","grpc":{"code":"OK","duration":"1.5s","kind":"unary","method":"/orders.Orders/Get"}}` + "\n" +
+		`{"severity":"ERROR","message":"/orders.Orders/Get Internal","grpc":{"code":"Internal","duration":"1.5s",` +
+		`"error":"rpc error: code = Internal desc = database is down","kind":"unary","method":"/orders.Orders/Get"},` +
+		`"logging.googleapis.com/trace":"projects/my-project/traces/abc123","logging.googleapis.com/spanId":"000000000000002a","logging.googleapis.com/trace_sampled":false}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// serverStream is a grpc.ServerStream with a context, for testing.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context { return s.ctx }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "")
+	var buf bytes.Buffer
+	clock, work := newClock()
+	logger := gcplog.New(gcplog.DEBUG).WithClock(clock)
+	logger.SetOutput(&buf)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+	info := &grpc.StreamServerInfo{FullMethod: "/orders.Orders/Watch"}
+	handler := func(srv any, ss grpc.ServerStream) error {
+		work()
+		return status.Error(codes.Unavailable, "draining")
+	}
+	err := StreamServerInterceptor(logger)(nil, serverStream{ctx: ctx}, info, handler)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("interceptor returned %v, want the handler's error", err)
+	}
+	logger.SetProjectID("logger-project")
+	_ = StreamServerInterceptor(logger)(nil, serverStream{ctx: ctx}, info, handler)
+	entry := `{"severity":"WARNING","message":"/orders.Orders/Watch Unavailable","grpc":{"code":"Unavailable","duration":"1.5s",` +
+		`"error":"rpc error: code = Unavailable desc = draining","kind":"stream","method":"/orders.Orders/Watch"}`
+	want := entry + "}\n" + entry + `,"logging.googleapis.com/trace":"projects/logger-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",` +
+		`"logging.googleapis.com/spanId":"00f067aa0ba902b7","logging.googleapis.com/trace_sampled":true}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSeverityForCode(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want string
+	}{
+		{codes.OK, gcplog.INFO},
+		{codes.NotFound, gcplog.INFO},
+		{codes.Unauthenticated, gcplog.INFO},
+		{codes.DeadlineExceeded, gcplog.WARNING},
+		{codes.Unavailable, gcplog.WARNING},
+		{codes.Unknown, gcplog.ERROR},
+		{codes.Internal, gcplog.ERROR},
+		{codes.DataLoss, gcplog.ERROR},
+		{codes.Code(99), gcplog.ERROR},
+	}
+	for _, tt := range tests {
+		if got := SeverityForCode(tt.code); got != tt.want {
+			t.Errorf("SeverityForCode(%v) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestTraceFromMetadata(t *testing.T) {
+	tests := []struct {
+		name            string
+		md              metadata.MD
+		trace, span     string
+		sampled, parsed bool
+		ok              bool
+	}{
+		{"none", metadata.Pairs(), "", "", false, false, false},
+		{"cloud trace", metadata.Pairs("x-cloud-trace-context", "abc/1;o=1"), "abc", "0000000000000001", true, true, true},
+		{"cloud trace large span", metadata.Pairs("x-cloud-trace-context", "abc/18446744073709551615"), "abc", "ffffffffffffffff", false, false, true},
+		{"cloud trace invalid span", metadata.Pairs("x-cloud-trace-context", "abc/0x2a;o=1"), "abc", "", true, true, true},
+		{"cloud trace only", metadata.Pairs("x-cloud-trace-context", "abc"), "abc", "", false, false, true},
+		{"cloud trace empty", metadata.Pairs("x-cloud-trace-context", ""), "", "", false, false, false},
+		{"traceparent", metadata.Pairs("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"),
+			"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", false, true, true},
+		{"traceparent odd flags", metadata.Pairs("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0b"),
+			"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true, true, true},
+		{"traceparent invalid", metadata.Pairs("traceparent", "00-short-span-01"), "", "", false, false, false},
+		{"both", metadata.Pairs("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "x-cloud-trace-context", "abc/2"),
+			"abc", "0000000000000002", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace, span, sampled, ok := traceFromMetadata(tt.md)
+			if trace != tt.trace || span != tt.span || ok != tt.ok || (sampled != nil) != tt.parsed || (sampled != nil && *sampled != tt.sampled) {
+				t.Errorf("traceFromMetadata() = %q, %q, %v, %v", trace, span, sampled, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package gcplog
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// maxValueDepth is how deeply objects and arrays can be nested inside a field value before the rest is replaced by maxDepthValue.
+const maxValueDepth = 32
+
+// cycleValue is used in place of a value which contains itself.
+const cycleValue = "(CYCLE)"
+
+// guardTypes holds whether values of each reflect.Type might not be encodable by encoding/json as they are, by type.
+var guardTypes sync.Map
+
+// needsGuard reports whether the structured field value v can't be encoded by encoding/json as it is, because it contains itself,
+// is nested more than maxValueDepth deep, or holds something encoding/json doesn't support, like a channel or a function.
+// Types which can't hold any of those aren't looked inside, so most values are checked without walking them.
+func needsGuard(v any) bool {
+	if v == nil || !mayNeedGuard(reflect.TypeOf(v)) {
+		return false
+	}
+	var stack [maxValueDepth]uintptr
+	return !safeToMarshal(reflect.ValueOf(v), 0, stack[:0])
+}
+
+// mayNeedGuard reports whether values of type t might need guarding, caching the answer for each type.
+func mayNeedGuard(t reflect.Type) bool {
+	if r, ok := guardTypes.Load(t); ok {
+		return r.(bool)
+	}
+	r := typeMayNeedGuard(t, make(map[reflect.Type]bool), 0)
+	guardTypes.Store(t, r)
+	return r
+}
+
+// typeMayNeedGuard reports whether values of type t, nested depth deep, might need guarding: if they can hold interfaces,
+// whose values are only known when they're encoded, kinds encoding/json doesn't support, or themselves, through types already in visiting.
+func typeMayNeedGuard(t reflect.Type, visiting map[reflect.Type]bool, depth int) bool {
+	if t.Implements(redactorType) || t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return false
+	}
+	if visiting[t] || depth > maxValueDepth {
+		return true
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	switch t.Kind() {
+	case reflect.Interface, reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Pointer:
+		return typeMayNeedGuard(t.Elem(), visiting, depth)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return typeMayNeedGuard(t.Elem(), visiting, depth+1)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if _, _, ok := jsonField(t.Field(i)); ok && typeMayNeedGuard(t.Field(i).Type, visiting, depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// safeToMarshal reports whether v, nested depth deep inside the pointers, maps and slices in path, can be encoded by encoding/json.
+func safeToMarshal(v reflect.Value, depth int, path []uintptr) bool {
+	if !v.IsValid() || isNil(v) || !mayNeedGuard(v.Type()) {
+		return true
+	}
+	if depth > maxValueDepth {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return false
+	case reflect.Interface:
+		return safeToMarshal(v.Elem(), depth, path)
+	case reflect.Pointer:
+		if onPath(path, v.Pointer()) {
+			return false
+		}
+		return safeToMarshal(v.Elem(), depth, append(path, v.Pointer()))
+	case reflect.Map:
+		if onPath(path, v.Pointer()) {
+			return false
+		}
+		path = append(path, v.Pointer())
+		if m, ok := mapOfAny(v); ok { // the most common case, which can be checked without allocating
+			for _, mv := range m {
+				if !safeToMarshal(reflect.ValueOf(mv), depth+1, path) {
+					return false
+				}
+			}
+			return true
+		}
+		for iter := v.MapRange(); iter.Next(); {
+			if !safeToMarshal(iter.Value(), depth+1, path) {
+				return false
+			}
+		}
+	case reflect.Slice:
+		if onPath(path, v.Pointer()) {
+			return false
+		}
+		path = append(path, v.Pointer())
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !safeToMarshal(v.Index(i), depth+1, path) {
+				return false
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if _, _, ok := jsonField(v.Type().Field(i)); ok && !safeToMarshal(v.Field(i), depth+1, path) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// onPath reports whether p is one of the pointers in path.
+func onPath(path []uintptr, p uintptr) bool {
+	for _, q := range path {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// guard returns v, nested depth deep inside the pointers, maps and slices in path, converted so encoding/json can always encode it.
+// Structs and maps are returned as a map[string]any, and slices and arrays as a []any, with their contents converted in the same way.
+// Values which contain themselves are replaced by cycleValue, and anything nested more than maxValueDepth deep by maxDepthValue.
+// Channels, functions and unsafe pointers are replaced by their type in brackets, like "(func())", complex numbers are written
+// as strings, like "(1+2i)", and so are floats which aren't numbers in JSON, like "NaN". A value whose MarshalJSON or MarshalText method
+// fails is replaced by its type in brackets too. Redactors are left as they are, to be replaced by redact.
+func guard(v reflect.Value, depth int, path []uintptr) any {
+	if !v.IsValid() || isNil(v) {
+		return nil
+	}
+	if depth > maxValueDepth {
+		return maxDepthValue
+	}
+	t := v.Type()
+	if t.Implements(redactorType) {
+		if !v.CanInterface() {
+			return nil
+		}
+		return v.Interface() // replaced by redact afterwards
+	}
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		if !v.CanInterface() {
+			return nil
+		}
+		j, err := json.Marshal(v.Interface())
+		if err != nil {
+			return "(" + t.String() + ")"
+		}
+		return json.RawMessage(j)
+	}
+	switch v.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return "(" + t.String() + ")"
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	case reflect.Interface:
+		return guard(v.Elem(), depth, path)
+	case reflect.Pointer:
+		if onPath(path, v.Pointer()) {
+			return cycleValue
+		}
+		return guard(v.Elem(), depth, append(path, v.Pointer()))
+	case reflect.Map:
+		if onPath(path, v.Pointer()) {
+			return cycleValue
+		}
+		path = append(path, v.Pointer())
+		m := make(map[string]any, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			m[mapKey(iter.Key())] = guard(iter.Value(), depth+1, path)
+		}
+		return m
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && !mayNeedGuard(t.Elem()) {
+			break // encoded as base64
+		}
+		if onPath(path, v.Pointer()) {
+			return cycleValue
+		}
+		path = append(path, v.Pointer())
+		fallthrough
+	case reflect.Array:
+		s := make([]any, v.Len())
+		for i := range s {
+			s[i] = guard(v.Index(i), depth+1, path)
+		}
+		return s
+	case reflect.Struct:
+		m := make(map[string]any, v.NumField())
+		jsonStructFields(m, v, func(fv reflect.Value) any { return guard(fv, depth+1, path) })
+		return m
+	}
+	if !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// prepareValue returns the structured field value v ready to be encoded by encoding/json: guarded if it needs it,
+// and then with any Redactors it holds replaced.
+func prepareValue(v any) any {
+	if needsGuard(v) {
+		v = guard(reflect.ValueOf(v), 0, nil)
+	}
+	if needsRedaction(v) {
+		v = redact(reflect.ValueOf(v), 0)
+	}
+	return v
+}
+
+// marshalGuarded returns the JSON encoding of the structured field value v, prepared by prepareValue,
+// guarding it again if encoding it fails, for example because it holds a float which isn't a number.
+func marshalGuarded(v any) ([]byte, error) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		j, err = json.Marshal(guard(reflect.ValueOf(v), 0, nil))
+	}
+	return j, err
+}
@@ -0,0 +1,177 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// node is a linked list node, which can point back to itself.
+type node struct {
+	Name string `json:"name"`
+	Next *node  `json:"next,omitempty"`
+}
+
+// callbacks has fields encoding/json doesn't support.
+type callbacks struct {
+	Name    string
+	Done    chan struct{}
+	OnClose func() error
+	Ratio   float64
+	Phase   complex128
+}
+
+// failingMarshaler fails to marshal itself.
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalJSON() ([]byte, error) { return nil, io.ErrUnexpectedEOF }
+
+func TestGuard(t *testing.T) {
+	self := &node{Name: "a"}
+	self.Next = self
+	pair := &node{Name: "a", Next: &node{Name: "b"}}
+	pair.Next.Next = pair
+	loop := map[string]any{"k": 1}
+	loop["self"] = loop
+	var deep any = "bottom"
+	for i := 0; i < 1000; i++ {
+		deep = map[string]any{"d": deep}
+	}
+	var list *node
+	for i := 0; i < 1000; i++ {
+		list = &node{Name: "n", Next: list}
+	}
+	var iface any
+	iface = &iface
+	shared := &node{Name: "s"}
+	secret := map[string]any{"card": card{PAN: testPAN}}
+	secret["self"] = secret
+	var twenty any = 1
+	for i := 0; i < 20; i++ {
+		twenty = map[string]any{"d": twenty}
+	}
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"self-referential struct", self, `{"name":"a","next":"(CYCLE)"}`},
+		{"longer cycle", pair, `{"name":"a","next":{"name":"b","next":"(CYCLE)"}}`},
+		{"map containing itself", loop, `{"k":1,"self":"(CYCLE)"}`},
+		{"pointer to itself", iface, `"(CYCLE)"`},
+		{"unsupported fields", callbacks{Name: "c", Done: make(chan struct{}), OnClose: func() error { return nil }, Ratio: math.NaN(), Phase: 1 + 2i},
+			`{"Done":"(chan struct {})","Name":"c","OnClose":"(func() error)","Phase":"(1+2i)","Ratio":"NaN"}`},
+		{"nil func", callbacks{Ratio: math.Inf(1)}, `{"Done":"(chan struct {})","Name":"","OnClose":"(func() error)","Phase":"(0+0i)","Ratio":"+Inf"}`},
+		{"failing marshaler", []any{failingMarshaler{}, 1}, `["(gcplog.failingMarshaler)",1]`},
+		{"shared, not a cycle", []*node{shared, shared}, `[{"name":"s"},{"name":"s"}]`},
+		{"redactor in a cycle", secret, `{"card":{"expiry":"","last4":"1111"},"self":"(CYCLE)"}`},
+		{"below the depth cap", twenty, strings.Repeat(`{"d":`, 20) + "1" + strings.Repeat("}", 20)},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		logger := New(INFO)
+		logger.out = &buf
+		logger.Printw("m", "v", tt.v)
+		want := `{"severity":"INFO","message":"m","v":` + tt.want + "}\n"
+		if got := buf.String(); got != want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", tt.name, got, want)
+		}
+	}
+	for _, v := range []any{deep, list} {
+		var buf bytes.Buffer
+		logger := New(INFO)
+		logger.out = &buf
+		logger.Printw("m", "v", v)
+		if !json.Valid(buf.Bytes()) || !strings.Contains(buf.String(), `"(MAX DEPTH)"`) || strings.Count(buf.String(), "{") > maxValueDepth+3 {
+			t.Errorf("%T nested 1000 deep: got %.200s..., want it cut at %d levels", v, buf.String(), maxValueDepth)
+		}
+	}
+}
+
+func TestGuardPrintJSON(t *testing.T) {
+	self := &node{Name: "a"}
+	self.Next = self
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.PrintJSON("m", self)
+	logger.PrintJSON("m", callbacks{Name: "c"})
+	want := `{"severity":"INFO","message":"m","name":"a","next":"(CYCLE)"}` + "\n" +
+		`{"severity":"INFO","message":"m","Done":"(chan struct {})","Name":"c","OnClose":"(func() error)","Phase":"(0+0i)","Ratio":0}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// reading holds a float, to check non-finite values nested inside a struct.
+type reading struct {
+	Value float64 `json:"value"`
+}
+
+func TestNonFiniteFloats(t *testing.T) {
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		t.Run(s, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO)
+			logger.out = &buf
+			logger.Printw("m", "f", f, "f32", float32(f), "nested", reading{f})
+			logger.Printm("m", map[string]any{"f": f, "nested": &reading{f}})
+			logger.PrintJSON("m", reading{f})
+			logger.PrintJSON("m", map[string]any{"nested": []reading{{f}}})
+			logger.Printw("m", Float64("f", f))
+			want := `{"severity":"INFO","message":"m","f":"` + s + `","f32":"` + s + `","nested":{"value":"` + s + `"}}` + "\n" +
+				`{"severity":"INFO","message":"m","f":"` + s + `","nested":{"value":"` + s + `"}}` + "\n" +
+				`{"severity":"INFO","message":"m","value":"` + s + `"}` + "\n" +
+				`{"severity":"INFO","message":"m","nested":[{"value":"` + s + `"}]}` + "\n" +
+				`{"severity":"INFO","message":"m","f":"` + s + `"}` + "\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestNeedsGuard(t *testing.T) {
+	tests := []struct {
+		v    any
+		want bool
+	}{
+		{order{ID: 1}, false},
+		{map[string]int{"a": 1}, false},
+		{map[string]any{"a": 1, "b": []any{"x"}}, false},
+		{&node{Name: "a", Next: &node{}}, false},
+		{map[string]any{"f": func() {}}, true},
+		{[]any{make(chan int)}, true},
+		{math.NaN(), false}, // found when it fails to marshal
+	}
+	for _, tt := range tests {
+		if got := needsGuard(tt.v); got != tt.want {
+			t.Errorf("needsGuard(%#v) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkGuard(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		v    any
+	}{
+		{"struct", order{ID: 7, Items: []string{"a", "b"}}},
+		{"map", map[string]any{"a": 1, "b": []any{"x", 2.5}, "c": map[string]any{"d": true}}},
+		{"cycle", func() any { n := &node{Name: "a"}; n.Next = n; return n }()},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			logger := New(INFO).With("v", bb.v)
+			logger.out = io.Discard
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				logger.Print("Hello World")
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package gcplog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// WithInsertID returns a new Logger which adds a "logging.googleapis.com/insertId" to every log entry, using the provided function
+// to generate a unique ID for each one. Cloud Logging uses the insertId to remove duplicate entries, for example when a write is retried
+// or a log file is read twice. If the function is nil, then a random 16 byte ID, written as hex, is used.
+// The original Logger is not changed.
+func (l *Logger) WithInsertID(gen func() string) *Logger {
+	if gen == nil {
+		gen = randomID
+	}
+	c := l.clone()
+	c.insertID = gen
+	return c
+}
+
+// PrintWithInsertID uses the same format as fmt.Print to write a log message with the severity of the Logger,
+// and the provided insertId in place of a generated one. Writing an entry again with the same insertId
+// lets Cloud Logging remove the duplicate. An empty insertId is the same as Print. The Logger is not changed.
+func (l *Logger) PrintWithInsertID(id string, v ...any) {
+	l.output(record{insertID: id}, v...)
+}
+
+// PrintfWithInsertID is the same as PrintWithInsertID, but uses the same format as fmt.Printf.
+func (l *Logger) PrintfWithInsertID(id, format string, v ...any) {
+	l.output(record{message: format, printf: true, insertID: id}, v...)
+}
+
+// randomID returns 16 random bytes from crypto/rand, written as hex.
+func randomID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:]) // this only fails if the system has no source of randomness at all
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,57 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWithInsertID(t *testing.T) {
+	var buf bytes.Buffer
+	n := 0
+	logger := New(INFO)
+	logger.out = &buf
+	ids := logger.WithInsertID(func() string { n++; return "id-" + strconv.Itoa(n) })
+	ids.Print("one")
+	ids.WithLabel("a", "b").Printf("%s", "two")
+	ids.PrintWithInsertID("retry-7", "three")
+	ids.PrintfWithInsertID("", "%s", "four")
+	logger.Print("five")
+	logger.PrintWithInsertID("explicit", "six")
+	want := `{"severity":"INFO","message":"one","logging.googleapis.com/insertId":"id-1"}` + "\n" +
+		`{"severity":"INFO","message":"two","logging.googleapis.com/labels":{"a":"b"},"logging.googleapis.com/insertId":"id-2"}` + "\n" +
+		`{"severity":"INFO","message":"three","logging.googleapis.com/insertId":"retry-7"}` + "\n" +
+		`{"severity":"INFO","message":"four","logging.googleapis.com/insertId":"id-3"}` + "\n" +
+		`{"severity":"INFO","message":"five"}` + "\n" +
+		`{"severity":"INFO","message":"six","logging.googleapis.com/insertId":"explicit"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithInsertIDDefault(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithInsertID(nil)
+	logger.out = &buf
+	logger.Print("one")
+	logger.Print("two")
+	hexID := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		id, _ := e["logging.googleapis.com/insertId"].(string)
+		if !hexID.MatchString(id) {
+			t.Errorf("insertId = %q, want 32 hex characters", id)
+		}
+		if seen[id] {
+			t.Errorf("insertId %q was used twice", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,118 @@
+package gcplog
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Int64Strings controls whether 64-bit integer field values are written as JSON strings, see WithInt64AsString.
+type Int64Strings int
+
+const (
+	Int64StringsOff    Int64Strings = iota // Integers are always written as JSON numbers, which is the default
+	Int64StringsLarge                      // Integers beyond ±2^53, which a float64 can't hold exactly, are written as strings
+	Int64StringsAlways                     // Every 64-bit integer is written as a string, so a field always has the same type
+)
+
+// maxExactInteger is the largest magnitude up to which a float64 can hold every integer exactly.
+const maxExactInteger = 1 << 53
+
+// WithInt64AsString returns a new Logger which writes 64-bit integer field values as decimal strings, like "9007199254740993",
+// rather than as JSON numbers. Cloud Logging stores jsonPayload as a protobuf Struct, in which every number is a float64,
+// so larger integers, like IDs, would otherwise lose precision, including in BigQuery exports.
+//
+// With no mode, or Int64StringsLarge, only integers beyond ±2^53 are written as strings, and smaller ones stay numbers.
+// With Int64StringsAlways, every one is, and Int64StringsOff restores the default. If several modes are provided, the last is used.
+// It applies to int, int64, uint and uint64 field values, Fields created by Int and Int64, integers added by PrintJSON or
+// WithJSONDetection, and values inside groups. Integers nested inside other maps, slices and structs aren't changed.
+// As JSON doesn't tell integers and floats apart, a float added by PrintJSON which is written as a whole number, like 1e20, counts as an integer.
+// The original Logger is not changed.
+func (l *Logger) WithInt64AsString(mode ...Int64Strings) *Logger {
+	c := l.clone()
+	c.int64Strings = Int64StringsLarge
+	if len(mode) > 0 {
+		c.int64Strings = mode[len(mode)-1]
+	}
+	return c
+}
+
+// fields returns fields with every integer which should be a string, including those of Fields and those inside groups, converted,
+// and whether any were.
+func (m Int64Strings) fields(fields map[string]any) (map[string]any, bool) {
+	if m == Int64StringsOff {
+		return fields, false
+	}
+	return rewriteFields(fields, m.value)
+}
+
+// value returns the field value v as a string if it's an integer which should be one, and whether it changed.
+func (m Int64Strings) value(v any) (any, bool) {
+	switch t := v.(type) {
+	case int:
+		return m.signed(int64(t))
+	case int64:
+		return m.signed(t)
+	case uint:
+		return m.unsigned(uint64(t))
+	case uint64:
+		return m.unsigned(t)
+	case Field:
+		switch t.kind {
+		case intKind:
+			if s, ok := m.signed(t.num); ok {
+				return String(t.Key, s.(string)), true
+			}
+		case anyKind:
+			if cv, ok := m.value(t.val); ok {
+				return Any(t.Key, cv), true
+			}
+		}
+	case group:
+		if g, ok := m.fields(t); ok {
+			return group(g), true
+		}
+	case json.RawMessage:
+		if isJSONInteger(t) && (m == Int64StringsAlways || !isExactInteger(string(t))) {
+			return string(t), true
+		}
+	}
+	return v, false
+}
+
+// signed returns i as a string, if it should be one.
+func (m Int64Strings) signed(i int64) (any, bool) {
+	if m == Int64StringsAlways || i > maxExactInteger || i < -maxExactInteger {
+		return strconv.FormatInt(i, 10), true
+	}
+	return i, false
+}
+
+// unsigned returns u as a string, if it should be one.
+func (m Int64Strings) unsigned(u uint64) (any, bool) {
+	if m == Int64StringsAlways || u > maxExactInteger {
+		return strconv.FormatUint(u, 10), true
+	}
+	return u, false
+}
+
+// isJSONInteger reports whether raw is a JSON number without a fraction or exponent.
+func isJSONInteger(raw json.RawMessage) bool {
+	if len(raw) > 0 && raw[0] == '-' {
+		raw = raw[1:]
+	}
+	if len(raw) == 0 {
+		return false
+	}
+	for _, c := range raw {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isExactInteger reports whether the decimal integer s is within ±2^53, so a float64 holds it exactly.
+func isExactInteger(s string) bool {
+	i, err := strconv.ParseInt(s, 10, 64)
+	return err == nil && i <= maxExactInteger && i >= -maxExactInteger
+}
@@ -0,0 +1,83 @@
+package gcplog
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestWithInt64AsString(t *testing.T) {
+	tests := []struct {
+		name  string
+		modes []Int64Strings
+		v     any
+		want  string
+	}{
+		{"small", nil, int64(42), `"v":42`},
+		{"2^53-1", nil, int64(1<<53 - 1), `"v":9007199254740991`},
+		{"2^53", nil, int64(1 << 53), `"v":9007199254740992`},
+		{"2^53+1", nil, int64(1<<53 + 1), `"v":"9007199254740993"`},
+		{"-2^53", nil, int64(-1 << 53), `"v":-9007199254740992`},
+		{"-2^53-1", nil, int64(-1<<53 - 1), `"v":"-9007199254740993"`},
+		{"MaxInt64", nil, int64(math.MaxInt64), `"v":"9223372036854775807"`},
+		{"MinInt64", nil, int64(math.MinInt64), `"v":"-9223372036854775808"`},
+		{"int", nil, int(math.MaxInt64), `"v":"9223372036854775807"`},
+		{"uint64", nil, uint64(math.MaxUint64), `"v":"18446744073709551615"`},
+		{"uint64 small", nil, uint64(7), `"v":7`},
+		{"Int64 field", nil, Int64("v", math.MaxInt64), `"v":"9223372036854775807"`},
+		{"Int64 field small", nil, Int64("v", -3), `"v":-3`},
+		{"Any field", nil, Any("v", uint64(1<<53+1)), `"v":"9007199254740993"`},
+		{"group", nil, group{"id": int64(1<<53 + 1), "n": 1}, `"v":{"id":"9007199254740993","n":1}`},
+		{"int32", nil, int32(math.MaxInt32), `"v":2147483647`},
+		{"float", nil, float64(1 << 60), `"v":1152921504606847000`},
+		{"nested map", nil, map[string]any{"id": int64(math.MaxInt64)}, `"v":{"id":9223372036854775807}`},
+		{"large mode", []Int64Strings{Int64StringsLarge}, int64(1<<53 + 1), `"v":"9007199254740993"`},
+		{"always", []Int64Strings{Int64StringsAlways}, int64(42), `"v":"42"`},
+		{"always negative", []Int64Strings{Int64StringsAlways}, Int64("v", -42), `"v":"-42"`},
+		{"always uint64", []Int64Strings{Int64StringsAlways}, uint64(0), `"v":"0"`},
+		{"off", []Int64Strings{Int64StringsOff}, int64(math.MaxInt64), `"v":9223372036854775807`},
+		{"last mode", []Int64Strings{Int64StringsAlways, Int64StringsLarge}, int64(42), `"v":42`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO).WithInt64AsString(tt.modes...)
+			logger.out = &buf
+			logger.Printw("m", "v", tt.v)
+			want := `{"severity":"INFO","message":"m",` + tt.want + "}\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestWithInt64AsStringJSON(t *testing.T) {
+	type ids struct {
+		Small int64  `json:"small"`
+		Large int64  `json:"large"`
+		Neg   int64  `json:"neg"`
+		Huge  uint64 `json:"huge"`
+		Ratio float64
+	}
+	var buf bytes.Buffer
+	logger := New(INFO).With("base", int64(math.MaxInt64))
+	logger.out = &buf
+	logger.Print("unchanged")
+	logger = logger.WithInt64AsString().WithJSONDetection(JSONDetectDropRaw)
+	logger.out = &buf
+	logger.PrintJSON("m", ids{Small: 1 << 53, Large: 1<<53 + 1, Neg: math.MinInt64, Huge: math.MaxUint64, Ratio: 1e20})
+	logger.Print(`{"id":123456789012345678901234567890,"n":-5,"f":9007199254740993.5}`)
+	logger.Printf("%s", "plain")
+	if got, want := string(New(INFO).With("id", uint64(math.MaxUint64)).WithInt64AsString().AppendEntry(nil, INFO, "m")),
+		`{"severity":"INFO","message":"m","id":"18446744073709551615"}`; got != want {
+		t.Errorf("AppendEntry got %s, want %s", got, want)
+	}
+	want := `{"severity":"INFO","message":"unchanged","base":9223372036854775807}` + "\n" +
+		`{"severity":"INFO","message":"m","Ratio":"100000000000000000000","base":"9223372036854775807","huge":"18446744073709551615","large":"9007199254740993","neg":"-9223372036854775808","small":9007199254740992}` + "\n" +
+		`{"severity":"INFO","message":"","base":"9223372036854775807","f":9007199254740993.5,"id":"123456789012345678901234567890","n":-5}` + "\n" +
+		`{"severity":"INFO","message":"plain","base":"9223372036854775807"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+const (
+	jsonValueKey = "value"        // the field PrintJSON nests values which aren't JSON objects under
+	jsonErrorKey = "gcplog_error" // the field PrintJSON describes a marshalling error with, in place of the value
+	jsonRawKey   = "raw"          // the field WithJSONDetection keeps the original message in
+)
+
+// JSONDetection controls whether log messages which are JSON objects are turned into structured fields, see WithJSONDetection.
+type JSONDetection int
+
+const (
+	JSONDetectOff     JSONDetection = iota // Messages are always written as text, which is the default
+	JSONDetectDropRaw                      // JSON object messages are turned into fields, and the original text is dropped
+	JSONDetectKeepRaw                      // JSON object messages are turned into fields, and the original text is kept in a "raw" field
+)
+
+// WithJSONDetection returns a new Logger which turns log messages that are JSON objects, like those written by
+// logger.Print(string(jsonBytes)), into structured fields, so they can be filtered on rather than being escaped inside the message.
+// A message is detected if, once leading and trailing white space is trimmed, it's a single valid JSON object.
+// Arrays, numbers, strings and invalid JSON are written as normal.
+//
+// The top-level keys of a detected object are added as structured fields to that entry only, in the same way as PrintJSON,
+// so keys which collide with reserved keys, like "severity" or "message", are renamed with a "field_" prefix. The message is left empty.
+// With JSONDetectKeepRaw, the original message is kept in a "raw" field, replacing any "raw" key in the object.
+// Detection happens as soon as the message is formatted, so the fields are masked and scrubbed like any others.
+// The original Logger is not changed.
+func (l *Logger) WithJSONDetection(d JSONDetection) *Logger {
+	c := l.clone()
+	c.jsonDetect = d
+	return c
+}
+
+// detect returns the structured fields for msg if it's a JSON object, as described by WithJSONDetection, or false if it isn't.
+// The fields don't refer to the memory of msg, so it can be reused.
+func (d JSONDetection) detect(msg string) (map[string]any, bool) {
+	if d == JSONDetectOff {
+		return nil, false
+	}
+	trimmed := strings.TrimSpace(msg)
+	if len(trimmed) < 2 || trimmed[0] != '{' {
+		return nil, false
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(trimmed), &members); err != nil {
+		return nil, false
+	}
+	fields := make(map[string]any, len(members)+1)
+	for k, m := range members {
+		fields[k] = m
+	}
+	if d == JSONDetectKeepRaw {
+		fields[jsonRawKey] = strings.Clone(msg)
+	}
+	return fields, true
+}
+
+// PrintJSON writes a log message with the severity of the Logger, adding the provided value to the entry as real JSON,
+// rather than as formatted text. The value is marshalled with json.Marshal, so struct tags are respected.
+//
+// If the value marshals to a JSON object, like a struct or a map, then its top-level keys are added as structured fields
+// to this entry only, replacing any fields of the Logger with the same key. Anything else, like a slice or a number,
+// is added under a "value" field. A nil value adds nothing. Use WithJSONKey to always nest the value under a single field instead.
+//
+// If the value implements LogFielder, then the fields it returns are used instead of marshalling it. Redactors are replaced first, as described by Redactor.
+// Parts of the value which can't be marshalled, like channels, functions, NaN and values which contain themselves, are replaced
+// by a description, like "(chan int)", in the same way as for structured fields. If the value still can't be marshalled,
+// then the message is still written, with the error in a "gcplog_error" field.
+func (l *Logger) PrintJSON(msg string, v any) {
+	l.mu.RLock()
+	key := l.jsonKey
+	l.mu.RUnlock()
+	l.output(record{message: msg, fields: jsonFields(key, v)})
+}
+
+// WithJSONKey returns a new Logger which nests the values passed to PrintJSON under the provided key, rather than
+// merging JSON objects into the entry. An empty key restores the default behaviour. The original Logger is not changed.
+func (l *Logger) WithJSONKey(key string) *Logger {
+	c := l.clone()
+	c.jsonKey = key
+	return c
+}
+
+// jsonFields returns the structured fields that PrintJSON adds for the provided value, as described by PrintJSON.
+func jsonFields(key string, v any) map[string]any {
+	if r, ok := v.(Redactor); ok {
+		v = redact(reflect.ValueOf(r), 0)
+	}
+	if lf, ok := v.(LogFielder); ok {
+		g := logFielderGroup(lf, 0)
+		if key != "" {
+			return map[string]any{key: g}
+		}
+		return g
+	}
+	v = prepareValue(v)
+	j, err := marshalGuarded(v)
+	if err != nil {
+		return map[string]any{jsonErrorKey: err.Error()}
+	}
+	if bytes.Equal(j, []byte("null")) {
+		return nil
+	}
+	if key != "" {
+		return map[string]any{key: json.RawMessage(j)}
+	}
+	if j[0] != '{' {
+		return map[string]any{jsonValueKey: json.RawMessage(j)}
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(j, &members); err != nil {
+		return map[string]any{jsonErrorKey: err.Error()}
+	}
+	fields := make(map[string]any, len(members))
+	for k, m := range members {
+		fields[k] = m
+	}
+	return fields
+}
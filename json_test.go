@@ -0,0 +1,78 @@
+package gcplog
+
+import (
+	"bytes"
+	"testing"
+)
+
+type order struct {
+	ID     int      `json:"id"`
+	Items  []string `json:"items,omitempty"`
+	Secret string   `json:"-"`
+	Note   string
+}
+
+func TestPrintJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		v    any
+		want string
+	}{
+		{"struct", "", order{ID: 7, Items: []string{"a"}, Secret: "hide", Note: "n"}, `"Note":"n","id":7,"items":["a"],"user":"ann"`},
+		{"struct pointer", "", &order{ID: 7}, `"Note":"","id":7,"user":"ann"`},
+		{"map", "", map[string]any{"user": "bob", "big": uint64(18446744073709551615)}, `"big":18446744073709551615,"user":"bob"`},
+		{"reserved key", "", map[string]string{"severity": "EMERGENCY"}, `"field_severity":"EMERGENCY","user":"ann"`},
+		{"slice", "", []int{1, 2, 3}, `"user":"ann","value":[1,2,3]`},
+		{"scalar", "", "text", `"user":"ann","value":"text"`},
+		{"nil", "", nil, `"user":"ann"`},
+		{"nil pointer", "", (*order)(nil), `"user":"ann"`},
+		{"unsupported", "", map[string]any{"ch": make(chan int)}, `"ch":"(chan int)","user":"ann"`},
+		{"nested struct", "order", order{ID: 7}, `"order":{"id":7,"Note":""},"user":"ann"`},
+		{"nested slice", "order", []int{1}, `"order":[1],"user":"ann"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO).With("user", "ann").WithJSONKey(tt.key)
+			logger.out = &buf
+			logger.PrintJSON("Hello World", tt.v)
+			want := `{"severity":"INFO","message":"Hello World",` + tt.want + "}\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestWithJSONDetection(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).With("k", 1)
+	logger.out = &buf
+	msg := ` {"order": {"id": 7}, "ok": true, "severity": "DEBUG", "raw": "mine"} `
+	logger.Print(msg)
+	detect := logger.WithJSONDetection(JSONDetectDropRaw)
+	detect.Print(msg)
+	detect.Print(`{"a":1} trailing`)
+	detect.Print(`[1, 2]`)
+	detect.Print(`"text"`)
+	detect.Print(`{}`)
+	detect.WithGroup("g").Printw(`{"a": 1, "b": 2}`, "b", 3)
+	logger.WithJSONDetection(JSONDetectKeepRaw).PrintBytes([]byte(`{"a":"x"}`))
+	detect.WithJSONDetection(JSONDetectOff).Print(`{"a":1}`)
+	want := `{"severity":"INFO","message":"{\"order\": {\"id\": 7}, \"ok\": true, \"severity\": \"DEBUG\", \"raw\": \"mine\"}","k":1}` + "\n" +
+		`{"severity":"INFO","message":"","field_severity":"DEBUG","k":1,"ok":true,"order":{"id":7},"raw":"mine"}` + "\n" +
+		`{"severity":"INFO","message":"{\"a\":1} trailing","k":1}` + "\n" +
+		`{"severity":"INFO","message":"[1, 2]","k":1}` + "\n" +
+		`{"severity":"INFO","message":"\"text\"","k":1}` + "\n" +
+		`{"severity":"INFO","message":"","k":1}` + "\n" +
+		`{"severity":"INFO","message":"","g":{"a":1,"b":3},"k":1}` + "\n" +
+		`{"severity":"INFO","message":"","a":"x","k":1,"raw":"{\"a\":\"x\"}"}` + "\n" +
+		`{"severity":"INFO","message":"{\"a\":1}","k":1}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := string(detect.AppendEntry(nil, INFO, `{"a":1}`)), `{"severity":"INFO","message":"","a":1,"k":1}`; got != want {
+		t.Errorf("AppendEntry() = %s, want %s", got, want)
+	}
+}
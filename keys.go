@@ -0,0 +1,28 @@
+package gcplog
+
+// WithSeverityKey returns a new Logger which writes the severity of each entry with the provided JSON key, rather than "severity".
+// Cloud Logging only recognises "severity", so this is for other systems which read the same output, like Logstash.
+// An empty key restores the default. The original Logger is not changed.
+func (l *Logger) WithSeverityKey(key string) *Logger {
+	c := l.clone()
+	c.severityKey = key
+	return c
+}
+
+// WithNameKey returns a new Logger which writes the name of a named Logger with the provided JSON key, rather than "logger",
+// for people who prefer a key like "module". While the Logger has a name, a structured field with that key is renamed
+// with a "field_" prefix, like other reserved keys. An empty key restores the default. The original Logger is not changed.
+func (l *Logger) WithNameKey(key string) *Logger {
+	c := l.clone()
+	c.nameKey = key
+	return c
+}
+
+// WithMessageKey returns a new Logger which writes the message of each entry with the provided JSON key, rather than "message".
+// Cloud Logging only recognises "message", so this is for other systems which read the same output, like Logstash.
+// An empty key restores the default. The original Logger is not changed.
+func (l *Logger) WithMessageKey(key string) *Logger {
+	c := l.clone()
+	c.messageKey = key
+	return c
+}
@@ -0,0 +1,22 @@
+package gcplog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWithKeys(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(WARNING)
+	logger.out = &buf
+	custom := logger.WithSeverityKey("level").WithMessageKey("msg")
+	custom.With("msg", "field", "severity", "field").Print("custom")
+	custom.WithSeverityKey("").WithMessageKey("").Print("restored")
+	logger.Print("default")
+	want := `{"level":"WARNING","msg":"custom","field_msg":"field","field_severity":"field"}` + "\n" +
+		`{"severity":"WARNING","message":"restored"}` + "\n" +
+		`{"severity":"WARNING","message":"default"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
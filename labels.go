@@ -0,0 +1,285 @@
+package gcplog
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultLabelLimit = 1024      // the default maximum length of a label value in bytes
+	maxLabelLimit     = 64 * 1024 // the longest label value Cloud Logging accepts, in bytes
+	maxLabelKey       = 512       // the longest label key Cloud Logging accepts, in bytes
+)
+
+// WithLabel returns a new Logger which adds the provided Cloud Logging label to every log entry.
+// Labels are indexed by Cloud Logging, so they're quicker and easier to filter on than structured fields,
+// but their values can only be strings. The original Logger is not changed.
+func (l *Logger) WithLabel(key, value string) *Logger {
+	return l.withLabels(map[string]string{key: value})
+}
+
+// WithLabels returns a new Logger which adds the provided Cloud Logging labels to every log entry.
+// They're merged with the labels of the original Logger, replacing any with the same key. Labels are written
+// under the "logging.googleapis.com/labels" key, sorted by key. Keys and values are sanitized when entries are written,
+// see SetStrictLabels and SetLabelLimit. The original Logger is not changed.
+func (l *Logger) WithLabels(labels map[string]string) *Logger {
+	return l.withLabels(labels)
+}
+
+// WithStringLabels returns a new Logger which adds Cloud Logging labels to every log entry, from alternating keys and values,
+// like With does for structured fields, for example:
+//
+//	logger.WithStringLabels("tenant", t, "region", r)
+//
+// Unlike With, the pairs always become labels, never payload fields. If there's an odd number of arguments, then the trailing key
+// is dropped, and a WARNING entry saying so is written with the original Logger. The original Logger is not changed.
+func (l *Logger) WithStringLabels(args ...string) *Logger {
+	labels := make(map[string]string, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		labels[args[i]] = args[i+1]
+	}
+	if len(args)%2 == 1 {
+		l.output(record{severity: WARNING, message: "gcplog: WithStringLabels dropped the label key " + strconv.Quote(args[len(args)-1]) + ", which has no value"})
+	}
+	return l.withLabels(labels)
+}
+
+// WithEnvLabels returns a new Logger which adds a label to every log entry for each of the named environment variables,
+// using the lowercased name of the variable as the key, for example:
+//
+//	logger.WithEnvLabels("K_SERVICE", "K_REVISION") // adds "k_service" and "k_revision" labels
+//
+// The variables are read once, when WithEnvLabels is called. Variables which are missing or empty are skipped.
+// The original Logger is not changed.
+func (l *Logger) WithEnvLabels(keys ...string) *Logger {
+	labels := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			labels[strings.ToLower(k)] = v
+		}
+	}
+	return l.withLabels(labels)
+}
+
+// cloudRunLabels are the labels WithCloudRunLabels adds, by the environment variable Cloud Run sets for each of them.
+// The keys match the resource labels Cloud Logging uses for Cloud Run revisions.
+var cloudRunLabels = map[string]string{
+	"K_SERVICE":       "service_name",
+	"K_REVISION":      "revision_name",
+	"K_CONFIGURATION": "configuration_name",
+}
+
+// WithCloudRunLabels returns a new Logger which adds the Cloud Run service, revision and configuration, from the K_SERVICE,
+// K_REVISION and K_CONFIGURATION environment variables, as "service_name", "revision_name" and "configuration_name" labels
+// to every log entry. The variables are read once, when WithCloudRunLabels is called, and any which are missing or empty are skipped,
+// so outside Cloud Run nothing is added. Like all labels, the values are sanitized when entries are written, see SetLabelLimit.
+// The original Logger is not changed.
+func (l *Logger) WithCloudRunLabels() *Logger {
+	labels := make(map[string]string, len(cloudRunLabels))
+	for env, key := range cloudRunLabels {
+		if v := os.Getenv(env); v != "" {
+			labels[key] = v
+		}
+	}
+	return l.withLabels(labels)
+}
+
+// cloudRunJobLabels are the labels WithCloudRunJobLabels adds, by the environment variable Cloud Run Jobs sets for each of them.
+// The keys match the resource labels Cloud Logging uses for Cloud Run jobs, so they don't conflict with cloudRunLabels.
+var cloudRunJobLabels = map[string]string{
+	"CLOUD_RUN_JOB":          "job_name",
+	"CLOUD_RUN_EXECUTION":    "execution_name",
+	"CLOUD_RUN_TASK_INDEX":   "task_index",
+	"CLOUD_RUN_TASK_ATTEMPT": "task_attempt",
+}
+
+// WithCloudRunJobLabels returns a new Logger which adds the Cloud Run job, execution, task index and task attempt, from the
+// CLOUD_RUN_JOB, CLOUD_RUN_EXECUTION, CLOUD_RUN_TASK_INDEX and CLOUD_RUN_TASK_ATTEMPT environment variables, as "job_name",
+// "execution_name", "task_index" and "task_attempt" labels to every log entry. The variables are read once, when
+// WithCloudRunJobLabels is called, and any which are missing or empty are skipped. The task index and attempt are written
+// as decimal numbers, and skipped if they aren't whole numbers. The labels can be used together with WithCloudRunLabels.
+// The original Logger is not changed.
+func (l *Logger) WithCloudRunJobLabels() *Logger {
+	labels := make(map[string]string, len(cloudRunJobLabels))
+	for env, key := range cloudRunJobLabels {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		if key == "task_index" || key == "task_attempt" {
+			n, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				continue
+			}
+			v = strconv.FormatUint(n, 10)
+		}
+		labels[key] = v
+	}
+	return l.withLabels(labels)
+}
+
+// hostname is os.Hostname, replaced by tests.
+var hostname = os.Hostname
+
+// WithProcessLabels returns a new Logger which adds "hostname" and "pid" labels to every log entry, to tell apart entries
+// from replicas which share a log sink. They're looked up once, when WithProcessLabels is called. If the hostname can't be found,
+// then the "hostname" label is left out. The original Logger is not changed.
+func (l *Logger) WithProcessLabels() *Logger {
+	labels := map[string]string{"pid": strconv.Itoa(os.Getpid())}
+	if h, err := hostname(); err == nil && h != "" {
+		labels["hostname"] = h
+	}
+	return l.withLabels(labels)
+}
+
+// PrintWithLabels uses the same format as fmt.Print to write a log message with the severity of the Logger,
+// adding the provided Cloud Logging labels to this entry only. They're merged with the labels of the Logger,
+// replacing any with the same key. Neither the Logger nor the provided map is changed.
+func (l *Logger) PrintWithLabels(labels map[string]string, v ...any) {
+	l.output(record{labels: labels}, v...)
+}
+
+// PrintfWithLabels is the same as PrintWithLabels, but uses the same format as fmt.Printf.
+func (l *Logger) PrintfWithLabels(labels map[string]string, format string, v ...any) {
+	l.output(record{message: format, printf: true, labels: labels}, v...)
+}
+
+// SetLabelLimit sets the maximum length of a label value in bytes. Longer values are truncated, at a UTF-8 character boundary,
+// when the entry is written. A limit of zero or less restores the default of 1KB, and limits above 64KB,
+// the most Cloud Logging accepts, are reduced to 64KB.
+func (l *Logger) SetLabelLimit(n int) {
+	if n > maxLabelLimit {
+		n = maxLabelLimit
+	}
+	if n < 0 {
+		n = 0
+	}
+	l.mu.Lock()
+	l.labelLimit = n
+	l.mu.Unlock()
+}
+
+// SetStrictLabels sets whether labels with invalid keys are dropped, instead of being sanitized.
+// Dropped labels are reported to the error handler set by SetErrorHandler, wrapping ErrInvalidLabel.
+//
+// Label keys are checked when each entry is written. A valid key is no longer than 512 bytes and only contains
+// lowercase ASCII letters, digits, and the characters '_', '-', '.' and '/'. When strict labels are off, which is the default,
+// an invalid key is sanitized: leading and trailing white space is trimmed, it's lowercased, every other character
+// is replaced with '_', and it's truncated to 512 bytes. If a sanitized key is the same as another label's key,
+// then a label whose key was already valid is kept, otherwise the one whose original key sorts first is kept.
+// Labels whose keys are empty, or only white space, are always dropped.
+func (l *Logger) SetStrictLabels(strict bool) {
+	l.mu.Lock()
+	l.strictLabels = strict
+	l.mu.Unlock()
+}
+
+// sanitizeLabels returns the labels with any invalid keys sanitized or dropped, and any long values truncated, as described by SetStrictLabels.
+// The provided map is returned unchanged if nothing needs to be done, otherwise a new map is returned.
+func (l *Logger) sanitizeLabels(labels map[string]string, limit int, strict bool, onError func(error)) map[string]string {
+	if limit == 0 {
+		limit = defaultLabelLimit
+	}
+	clean := true
+	for k, v := range labels {
+		if !validLabelKey(k) || len(v) > limit {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return labels
+	}
+	out := make(map[string]string, len(labels))
+	var invalid []string
+	for k, v := range labels {
+		if validLabelKey(k) {
+			out[k] = truncateUTF8(v, limit)
+		} else {
+			invalid = append(invalid, k)
+		}
+	}
+	sort.Strings(invalid)
+	for _, k := range invalid {
+		s := sanitizeLabelKey(k)
+		if s == "" || strict {
+			if onError != nil {
+				l.reportLabel(k, onError)
+			}
+			continue
+		}
+		if _, ok := out[s]; !ok {
+			out[s] = truncateUTF8(labels[k], limit)
+		}
+	}
+	return out
+}
+
+// validLabelKey reports whether k is a valid label key, as described by SetStrictLabels.
+func validLabelKey(k string) bool {
+	if k == "" || len(k) > maxLabelKey {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		if !labelKeyChar(k[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// labelKeyChar reports whether c is allowed in a label key.
+func labelKeyChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '.' || c == '/'
+}
+
+// sanitizeLabelKey returns k trimmed, lowercased, with every character which isn't allowed replaced with '_', and truncated to maxLabelKey bytes.
+func sanitizeLabelKey(k string) string {
+	k = strings.ToLower(strings.TrimSpace(k))
+	var b strings.Builder
+	for _, r := range k {
+		if r < utf8.RuneSelf && labelKeyChar(byte(r)) {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+		if b.Len() == maxLabelKey {
+			break
+		}
+	}
+	return b.String()
+}
+
+// truncateUTF8 returns s shortened to at most n bytes, without splitting a UTF-8 encoded character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// withLabels returns a new Logger which adds the provided labels to every log entry, replacing any existing labels with the same key.
+func (l *Logger) withLabels(labels map[string]string) *Logger {
+	c := l.clone()
+	c.labels = mergeLabels(c.labels, labels)
+	return c
+}
+
+// mergeLabels returns a new map holding the labels from both maps, with those in b replacing any in a with the same key.
+// Neither of the provided maps is modified.
+func mergeLabels(a, b map[string]string) map[string]string {
+	merged := make(map[string]string, len(a)+len(b))
+	for k, v := range a {
+		merged[k] = v
+	}
+	for k, v := range b {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,265 @@
+package gcplog
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWithEnvLabels(t *testing.T) {
+	t.Setenv("GCPLOG_TEST_SERVICE", "orders")
+	t.Setenv("GCPLOG_TEST_REVISION", "orders-00042")
+	t.Setenv("GCPLOG_TEST_EMPTY", "")
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	env := logger.WithEnvLabels("GCPLOG_TEST_SERVICE", "GCPLOG_TEST_REVISION", "GCPLOG_TEST_EMPTY", "GCPLOG_TEST_MISSING")
+	t.Setenv("GCPLOG_TEST_SERVICE", "changed")
+	env.Print("Hello World")
+	logger.WithEnvLabels("GCPLOG_TEST_MISSING").Print("none")
+	want := `{"severity":"INFO","message":"Hello World","logging.googleapis.com/labels":{"gcplog_test_revision":"orders-00042","gcplog_test_service":"orders"}}` + "\n" +
+		`{"severity":"INFO","message":"none"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithCloudRunLabels(t *testing.T) {
+	long := strings.Repeat("r", 2000)
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"present", map[string]string{"K_SERVICE": "orders", "K_REVISION": "orders-00042-abc", "K_CONFIGURATION": "orders"},
+			`,"logging.googleapis.com/labels":{"configuration_name":"orders","revision_name":"orders-00042-abc","service_name":"orders"}`},
+		{"partial", map[string]string{"K_SERVICE": "orders", "K_REVISION": "", "K_CONFIGURATION": ""},
+			`,"logging.googleapis.com/labels":{"service_name":"orders"}`},
+		{"absent", map[string]string{"K_SERVICE": "", "K_REVISION": "", "K_CONFIGURATION": ""}, ""},
+		{"untrusted", map[string]string{"K_SERVICE": "a\"b\n", "K_REVISION": long, "K_CONFIGURATION": ""},
+			`,"logging.googleapis.com/labels":{"revision_name":"` + long[:defaultLabelLimit] + `","service_name":"a\"b\n"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			var buf bytes.Buffer
+			logger := New(INFO).WithCloudRunLabels()
+			logger.out = &buf
+			logger.Print("started")
+			if got, want := buf.String(), `{"severity":"INFO","message":"started"`+tt.want+"}\n"; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestWithCloudRunJobLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"full", map[string]string{"CLOUD_RUN_JOB": "reindex", "CLOUD_RUN_EXECUTION": "reindex-x7k2p", "CLOUD_RUN_TASK_INDEX": "0042", "CLOUD_RUN_TASK_ATTEMPT": "1"},
+			`,"logging.googleapis.com/labels":{"execution_name":"reindex-x7k2p","job_name":"reindex","service_name":"orders","task_attempt":"1","task_index":"42"}`},
+		{"missing attempt", map[string]string{"CLOUD_RUN_JOB": "reindex", "CLOUD_RUN_EXECUTION": "reindex-x7k2p", "CLOUD_RUN_TASK_INDEX": "3", "CLOUD_RUN_TASK_ATTEMPT": ""},
+			`,"logging.googleapis.com/labels":{"execution_name":"reindex-x7k2p","job_name":"reindex","service_name":"orders","task_index":"3"}`},
+		{"garbage index", map[string]string{"CLOUD_RUN_JOB": "reindex", "CLOUD_RUN_EXECUTION": "", "CLOUD_RUN_TASK_INDEX": "3; rm -rf", "CLOUD_RUN_TASK_ATTEMPT": "-1"},
+			`,"logging.googleapis.com/labels":{"job_name":"reindex","service_name":"orders"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("K_SERVICE", "orders")
+			t.Setenv("K_REVISION", "")
+			t.Setenv("K_CONFIGURATION", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			var buf bytes.Buffer
+			logger := New(INFO).WithCloudRunLabels().WithCloudRunJobLabels()
+			logger.out = &buf
+			logger.Print("started")
+			if got, want := buf.String(), `{"severity":"INFO","message":"started"`+tt.want+"}\n"; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// fakeHostname makes WithProcessLabels use the provided hostname and error, until the test finishes.
+func fakeHostname(t *testing.T, name string, err error) {
+	t.Helper()
+	orig := hostname
+	hostname = func() (string, error) { return name, err }
+	t.Cleanup(func() { hostname = orig })
+}
+
+func TestWithProcessLabels(t *testing.T) {
+	fakeHostname(t, "orders-7d9f", nil)
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	process := logger.WithProcessLabels()
+	fakeHostname(t, "changed", nil)
+	process.Print("one")
+	process.WithLabel("env", "prod").Print("two")
+	fakeHostname(t, "", errors.New("no hostname"))
+	logger.WithProcessLabels().Print("no hostname")
+	pid := strconv.Itoa(os.Getpid())
+	want := `{"severity":"INFO","message":"one","logging.googleapis.com/labels":{"hostname":"orders-7d9f","pid":"` + pid + `"}}` + "\n" +
+		`{"severity":"INFO","message":"two","logging.googleapis.com/labels":{"env":"prod","hostname":"orders-7d9f","pid":"` + pid + `"}}` + "\n" +
+		`{"severity":"INFO","message":"no hostname","logging.googleapis.com/labels":{"pid":"` + pid + `"}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithLabels(t *testing.T) {
+	var buf bytes.Buffer
+	root := New(NOTICE)
+	root.out = &buf
+	first := root.WithLabels(map[string]string{"env": "prod", "team": "core"})
+	second := first.WithLabel("team", "payments").WithLabel("region", "eu")
+	third := second.WithLabels(map[string]string{"env": "canary", "shard": "7"})
+	third.Print("third")
+	second.Print("second")
+	first.Print("first")
+	root.WithLabels(nil).Print("root")
+	want := `{"severity":"NOTICE","message":"third","logging.googleapis.com/labels":{"env":"canary","region":"eu","shard":"7","team":"payments"}}` + "\n" +
+		`{"severity":"NOTICE","message":"second","logging.googleapis.com/labels":{"env":"prod","region":"eu","team":"payments"}}` + "\n" +
+		`{"severity":"NOTICE","message":"first","logging.googleapis.com/labels":{"env":"prod","team":"core"}}` + "\n" +
+		`{"severity":"NOTICE","message":"root"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func ExampleLogger_WithLabel() {
+	logger := New(INFO)
+	logger.WithLabel("env", "prod").Print("Hello World")
+	// Output:
+	// {"severity":"INFO","message":"Hello World","logging.googleapis.com/labels":{"env":"prod"}}
+}
+
+func TestPrintWithLabels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithLabels(map[string]string{"env": "prod", "retry": "0"})
+	logger.out = &buf
+	labels := map[string]string{"retry": "3", "attempt": "a1"}
+	logger.PrintWithLabels(labels, "retrying")
+	logger.Print("plain")
+	logger.PrintfWithLabels(map[string]string{"op": "get"}, "done in %dms", 12)
+	want := `{"severity":"INFO","message":"retrying","logging.googleapis.com/labels":{"attempt":"a1","env":"prod","retry":"3"}}` + "\n" +
+		`{"severity":"INFO","message":"plain","logging.googleapis.com/labels":{"env":"prod","retry":"0"}}` + "\n" +
+		`{"severity":"INFO","message":"done in 12ms","logging.googleapis.com/labels":{"env":"prod","op":"get","retry":"0"}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if len(labels) != 2 || labels["retry"] != "3" {
+		t.Errorf("PrintWithLabels changed the provided map: %v", labels)
+	}
+	if len(logger.labels) != 2 || logger.labels["retry"] != "0" {
+		t.Errorf("PrintWithLabels changed the Logger labels: %v", logger.labels)
+	}
+}
+
+func TestPrintWithLabelsNone(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.PrintWithLabels(nil, "no labels")
+	if got, want := buf.String(), `{"severity":"INFO","message":"no labels"}`+"\n"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestSanitizeLabels(t *testing.T) {
+	long := strings.Repeat("x", 100*1024)
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   map[string]string
+	}{
+		{"valid", map[string]string{"k8s-pod/app.name": "v", "a_1": ""}, map[string]string{"k8s-pod/app.name": "v", "a_1": ""}},
+		{"uppercase", map[string]string{"Env": "prod"}, map[string]string{"env": "prod"}},
+		{"spaces", map[string]string{"  my key  ": "v"}, map[string]string{"my_key": "v"}},
+		{"slashes", map[string]string{"team/Owner Name": "v"}, map[string]string{"team/owner_name": "v"}},
+		{"unicode", map[string]string{"Größe": "v"}, map[string]string{"gr__e": "v"}},
+		{"empty key", map[string]string{"": "v", "   ": "w", "ok": "x"}, map[string]string{"ok": "x"}},
+		{"long key", map[string]string{strings.Repeat("K", 600): "v"}, map[string]string{strings.Repeat("k", maxLabelKey): "v"}},
+		{"long value", map[string]string{"big": long}, map[string]string{"big": long[:defaultLabelLimit]}},
+		{"collision keeps valid", map[string]string{"env": "a", "ENV": "b", " env": "c"}, map[string]string{"env": "a"}},
+		{"collision keeps first", map[string]string{"ENV": "b", " env": "c"}, map[string]string{"env": "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := New(INFO)
+			if got := logger.sanitizeLabels(tt.labels, 0, false, nil); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sanitizeLabels(%v) = %v, want %v", tt.labels, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetLabelLimit(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.SetLabelLimit(5)
+	logger.PrintWithLabels(map[string]string{"a": "abcdefgh", "b": "héllo"}, "x")
+	want := `{"severity":"INFO","message":"x","logging.googleapis.com/labels":{"a":"abcde","b":"héll"}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	logger.SetLabelLimit(1 << 30)
+	if logger.labelLimit != maxLabelLimit {
+		t.Errorf("SetLabelLimit(1<<30) gave a limit of %d, want %d", logger.labelLimit, maxLabelLimit)
+	}
+	logger.SetLabelLimit(-1)
+	if logger.labelLimit != 0 {
+		t.Errorf("SetLabelLimit(-1) gave a limit of %d, want the default", logger.labelLimit)
+	}
+}
+
+func TestSetStrictLabels(t *testing.T) {
+	var buf bytes.Buffer
+	var errs []error
+	logger := New(INFO).WithLabels(map[string]string{"Bad Key": "x", "good": "y"})
+	logger.out = &buf
+	logger.SetErrorHandler(func(err error) { errs = append(errs, err) })
+	logger.SetStrictLabels(true)
+	logger.Print("one")
+	logger.Print("two")
+	want := `{"severity":"INFO","message":"one","logging.googleapis.com/labels":{"good":"y"}}` + "\n" +
+		`{"severity":"INFO","message":"two","logging.googleapis.com/labels":{"good":"y"}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrInvalidLabel) {
+		t.Errorf("error handler got %v, want a single ErrInvalidLabel", errs)
+	}
+	if logger.labels["Bad Key"] != "x" {
+		t.Error("sanitizing changed the Logger labels")
+	}
+}
+
+func TestWithStringLabels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithLabel("env", "prod")
+	logger.out = &buf
+	logger.WithStringLabels("tenant", "acme", "env", "dev").Print("paired")
+	logger.WithStringLabels("tenant", "acme", "region").Print("trailing")
+	logger.WithStringLabels().Print("none")
+	want := `{"severity":"INFO","message":"paired","logging.googleapis.com/labels":{"env":"dev","tenant":"acme"}}` + "\n" +
+		`{"severity":"WARNING","message":"gcplog: WithStringLabels dropped the label key \"region\", which has no value","logging.googleapis.com/labels":{"env":"prod"}}` + "\n" +
+		`{"severity":"INFO","message":"trailing","logging.googleapis.com/labels":{"env":"prod","tenant":"acme"}}` + "\n" +
+		`{"severity":"INFO","message":"none","logging.googleapis.com/labels":{"env":"prod"}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
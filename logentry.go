@@ -0,0 +1,50 @@
+package gcplog
+
+import "time"
+
+// SetLogEntryFormat sets whether entries are written in the JSON form of the LogEntry message of the Cloud Logging API,
+// for programs which send entries to the API themselves, for example through Pub/Sub, rather than having the logging agent read them.
+// The default, false, is the simpler structured logging format the agent reads from stdout.
+//
+// In the LogEntry format, the message, logger name, component, sequence number, fields, stack trace and Error Reporting type
+// are nested in a "jsonPayload" object, and the rest use the names of the LogEntry fields, rather than the special keys the agent uses:
+//
+//	{"severity":"ERROR","timestamp":"2024-05-01T12:00:00Z","insertId":"...","labels":{...},"trace":"projects/p/traces/t",
+//	"spanId":"...","traceSampled":true,"sourceLocation":{...},"jsonPayload":{"message":"...","logger":"...","orderId":1234}}
+//
+// The severity key is always "severity", and the timestamp, when timestamps are on, is always an RFC 3339 string.
+// The message key set by WithMessageKey still applies, inside the payload.
+// Loggers created from this one after SetLogEntryFormat is called use the same format.
+func (l *Logger) SetLogEntryFormat(on bool) {
+	l.mu.Lock()
+	l.logEntry = on
+	l.mu.Unlock()
+}
+
+// appendLogEntryJSON appends the JSON encoding of the entry to b in the LogEntry format, as described by SetLogEntryFormat,
+// followed by a newline, and returns the extended buffer. Like appendJSON, the order never depends on map iteration.
+func (e *entry) appendLogEntryJSON(b []byte) []byte {
+	b = append(b, `{"severity":`...)
+	b = appendJSONString(b, e.gcpSeverity())
+	if !e.time.IsZero() {
+		b = append(b, `,"timestamp":"`...)
+		b = e.time.UTC().AppendFormat(b, time.RFC3339Nano)
+		b = append(b, '"')
+	}
+	if e.insertID != "" {
+		b = append(b, `,"insertId":`...)
+		b = appendJSONString(b, e.insertID)
+	}
+	b = appendLabels(b, "labels", e.allLabels())
+	b = e.trace.appendJSON(b, "trace", "spanId", "traceSampled")
+	if e.source != nil {
+		b = append(b, `,"sourceLocation":`...)
+		b = appendJSONValue(b, e.source)
+	}
+	b = append(b, `,"jsonPayload":{`...)
+	b = appendJSONString(b, orDefault(e.messageKey, "message"))
+	b = append(b, ':')
+	b = appendJSONString(b, e.message)
+	b = e.appendPayload(b)
+	return append(b, '}', '}', '\n')
+}
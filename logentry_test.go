@@ -0,0 +1,34 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSetLogEntryFormatMinimal(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(WARNING).WithSourceLocation(WARNING)
+	logger.out = &buf
+	logger.SetLogEntryFormat(true)
+	child := logger.With("k", "v")
+	child.Print("with source")
+	appender := New(INFO)
+	appender.SetLogEntryFormat(true)
+	if got := string(appender.AppendEntry(nil, INFO, "appended")); got != `{"severity":"INFO","jsonPayload":{"message":"appended"}}` {
+		t.Errorf("AppendEntry() = %s", got)
+	}
+	var e struct {
+		Severity       string         `json:"severity"`
+		SourceLocation sourceLocation `json:"sourceLocation"`
+		JSONPayload    map[string]any `json:"jsonPayload"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("entry %s isn't valid JSON: %v", buf.String(), err)
+	}
+	if e.Severity != WARNING || !strings.HasSuffix(e.SourceLocation.File, "logentry_test.go") || e.SourceLocation.Line == "" ||
+		e.JSONPayload["message"] != "with source" || e.JSONPayload["k"] != "v" || len(e.JSONPayload) != 2 {
+		t.Errorf("got %s", buf.String())
+	}
+}
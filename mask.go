@@ -0,0 +1,138 @@
+package gcplog
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maskValue replaces the parts of messages and field values matched by WithMasking.
+const maskValue = "***"
+
+// defaultMasks are the patterns DefaultMaskPatterns returns, never modified once set.
+var defaultMasks = []*regexp.Regexp{
+	regexp.MustCompile(`\bBearer ([A-Za-z0-9._~+/-]+=*)`),                               // OAuth bearer tokens, keeping the "Bearer " scheme
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),                                 // AWS access key IDs
+	regexp.MustCompile(`(?i)\baws_secret_access_key\s*[=:]\s*"?([A-Za-z0-9/+=]{40})\b`), // AWS secret access keys, keeping the name
+	regexp.MustCompile(`(?i)\b(?:password|passwd|pwd)=([^&\s]+)`),                       // passwords in query strings and form data, keeping the name
+}
+
+// DefaultMaskPatterns returns the patterns WithMasking uses when it's called without any: OAuth bearer tokens,
+// AWS access keys, and passwords in query strings like "password=hunter2". The returned slice can be changed freely.
+func DefaultMaskPatterns() []*regexp.Regexp {
+	return append([]*regexp.Regexp(nil), defaultMasks...)
+}
+
+// WithMasking returns a new Logger which replaces text matching any of the provided patterns with "***", in messages, after they're
+// formatted, and in string field values, including those inside groups, so secrets are masked wherever they're interpolated.
+// If a pattern has capturing groups, then only the text they match is replaced, so a pattern like `password=(\S+)` keeps the name.
+// Matches from different patterns which overlap are replaced together, by a single "***".
+//
+// The patterns are added to any the Logger already masks. Called with none, it adds the patterns returned by DefaultMaskPatterns.
+// Every pattern is run against every message and string field, so loggers on hot paths can use WithoutMasking to skip it.
+// The original Logger is not changed.
+func (l *Logger) WithMasking(patterns ...*regexp.Regexp) *Logger {
+	c := l.clone()
+	if len(patterns) == 0 {
+		patterns = defaultMasks
+	}
+	for _, p := range patterns {
+		if p != nil {
+			c.masks = append(c.masks[:len(c.masks):len(c.masks)], p)
+		}
+	}
+	return c
+}
+
+// WithoutMasking returns a new Logger which doesn't mask anything, removing the patterns added by WithMasking.
+// The original Logger is not changed.
+func (l *Logger) WithoutMasking() *Logger {
+	c := l.clone()
+	c.masks = nil
+	return c
+}
+
+// maskString returns s with the text matched by the masks replaced by maskValue, as described by WithMasking.
+func maskString(s string, masks []*regexp.Regexp) string {
+	var spans [][2]int // the start and end of each part of s to replace
+	for _, m := range masks {
+		for _, match := range m.FindAllStringSubmatchIndex(s, -1) {
+			if len(match) == 2 {
+				spans = append(spans, [2]int{match[0], match[1]})
+				continue
+			}
+			for i := 2; i < len(match); i += 2 {
+				if match[i] >= 0 && match[i] < match[i+1] {
+					spans = append(spans, [2]int{match[i], match[i+1]})
+				}
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return s
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var b strings.Builder
+	b.Grow(len(s))
+	last := 0 // the end of the text replaced so far
+	for _, span := range spans {
+		if span[1] <= last {
+			continue // inside a part already replaced
+		}
+		if span[0] >= last {
+			b.WriteString(s[last:span[0]])
+			b.WriteString(maskValue)
+		}
+		last = span[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// scrubber replaces sensitive text in messages and string field values, as set up by WithMasking and WithPIIScrubbing.
+type scrubber struct {
+	masks []*regexp.Regexp // patterns replaced by maskValue
+	pii   []PIIKind        // kinds of personal data replaced by a hash, sorted
+}
+
+// active reports whether the scrubber changes anything.
+func (sc scrubber) active() bool {
+	return len(sc.masks) > 0 || len(sc.pii) > 0
+}
+
+// string returns s with the masks, then the personal data, replaced.
+func (sc scrubber) string(s string) string {
+	if len(sc.masks) > 0 {
+		s = maskString(s, sc.masks)
+	}
+	if len(sc.pii) > 0 {
+		s = scrubPII(s, sc.pii)
+	}
+	return s
+}
+
+// fields returns fields with every string value, including those of Fields and those inside groups, scrubbed, and whether any changed.
+func (sc scrubber) fields(fields map[string]any) (map[string]any, bool) {
+	return rewriteFields(fields, sc.value)
+}
+
+// value returns the field value v scrubbed, and whether it changed.
+func (sc scrubber) value(v any) (any, bool) {
+	switch t := v.(type) {
+	case string:
+		if s := sc.string(t); s != t {
+			return s, true
+		}
+	case Field:
+		if t.kind == stringKind {
+			if s := sc.string(t.str); s != t.str {
+				return String(t.Key, s), true
+			}
+		}
+	case group:
+		if g, ok := sc.fields(t); ok {
+			return group(g), true
+		}
+	}
+	return v, false
+}
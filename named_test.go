@@ -0,0 +1,190 @@
+package gcplog
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a bytes.Buffer which is safe for concurrent writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLevelResolve(t *testing.T) {
+	t.Cleanup(func() {
+		for _, name := range []string{"resolve.db", "resolve.db.pool", "resolve.db.pool.conn"} {
+			ClearLevel(name)
+		}
+	})
+	SetLevel("resolve.db", ERROR)
+	SetLevel("resolve.db.pool", "debug")
+	SetLevel("resolve.db.pool.conn", "BOGUS")
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"resolve", DEFAULT},
+		{"resolve.db", ERROR},
+		{"resolve.db.query", ERROR},
+		{"resolve.db.pool", DEBUG},
+		{"resolve.db.pool.conn", DEBUG},
+		{"resolve.dbx", DEFAULT},
+	}
+	for _, tt := range tests {
+		if got := levels.resolve(tt.name); got != tt.want {
+			t.Errorf("resolve(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	ClearLevel("resolve.db.pool")
+	if got := levels.resolve("resolve.db.pool.conn"); got != ERROR {
+		t.Errorf("resolve after ClearLevel = %q, want %q", got, ERROR)
+	}
+}
+
+func TestNamedFiltering(t *testing.T) {
+	t.Cleanup(func() { ClearLevel("filter") })
+	var buf bytes.Buffer
+	logger := Named("filter.http", INFO)
+	logger.out = &buf
+	logger.Print("before")
+	SetLevel("filter", WARNING)
+	logger.Print("suppressed")
+	SetLevel("filter.http", DEBUG)
+	logger.Print("after")
+	want := `{"severity":"INFO","message":"before","logger":"filter.http"}` + "\n" +
+		`{"severity":"INFO","message":"after","logger":"filter.http"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := logger.Counts()[INFO]; got != 2 {
+		t.Errorf("Counts()[INFO] = %d, want 2", got)
+	}
+}
+
+func TestNamedConcurrent(t *testing.T) {
+	t.Cleanup(func() { ClearLevel("concurrent") })
+	var buf syncBuffer
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			logger := Named("concurrent.worker", ERROR)
+			logger.out = &buf
+			for j := 0; j < 100; j++ {
+				logger.Print("Hello World")
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if (i+j)%2 == 0 {
+					SetLevel("concurrent", CRITICAL)
+				} else {
+					ClearLevel("concurrent")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line != `{"severity":"ERROR","message":"Hello World","logger":"concurrent.worker"}` {
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+}
+
+func ExampleNamed() {
+	logger := Named("db.pool", DEBUG)
+	logger.Print("Hello World")
+	SetLevel("db", INFO)
+	logger.Print("This isn't written")
+	ClearLevel("db")
+	// Output:
+	// {"severity":"DEBUG","message":"Hello World","logger":"db.pool"}
+}
+
+func TestWithComponent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(ERROR)
+	logger.out = &buf
+	billing := logger.WithComponent("billing")
+	billing.Print("parent")
+	billing.WithComponent("billing.invoices").With("component", "field").Print("child")
+	logger.With("component", "field").Print("root")
+	billing.WithComponent("").Print("removed")
+	billing.SetSeverity(TRACE)
+	billing.WithLabel("component", "label").Print("trace")
+	want := `{"severity":"ERROR","message":"parent","component":"billing"}` + "\n" +
+		`{"severity":"ERROR","message":"child","component":"billing.invoices","field_component":"field"}` + "\n" +
+		`{"severity":"ERROR","message":"root","component":"field"}` + "\n" +
+		`{"severity":"ERROR","message":"removed"}` + "\n" +
+		`{"severity":"DEBUG","message":"trace","component":"billing","logging.googleapis.com/labels":{"component":"label","gcplog_level":"TRACE"}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithComponentNamed(t *testing.T) {
+	var buf syncBuffer
+	logger := Named("gcplog_test.component", INFO).WithComponent("billing")
+	logger.out = &buf
+	logger.Print("both")
+	SetLevel("gcplog_test.component", ERROR)
+	defer ClearLevel("gcplog_test.component")
+	logger.Print("filtered by name")
+	want := `{"severity":"INFO","message":"both","logger":"gcplog_test.component","component":"billing"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLoggerNamed(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).With("pool", 1)
+	logger.out = &buf
+	ingest := logger.Named("ingest")
+	ingest.Named("workers").WithField("logger", "field").Print("child")
+	ingest.Print("parent")
+	ingest.Named("").Named(".bad").Named("bad.").Print("rejected")
+	logger.Named("").Print("unnamed")
+	ingest.WithNameKey("module").With("module", "field").Print("custom key")
+	logger.WithNameKey("module").With("module", "field").Print("custom key unnamed")
+	want := `{"severity":"INFO","message":"child","logger":"ingest.workers","field_logger":"field","pool":1}` + "\n" +
+		`{"severity":"INFO","message":"parent","logger":"ingest","pool":1}` + "\n" +
+		`{"severity":"INFO","message":"rejected","logger":"ingest","pool":1}` + "\n" +
+		`{"severity":"INFO","message":"unnamed","pool":1}` + "\n" +
+		`{"severity":"INFO","message":"custom key","module":"ingest","field_module":"field","pool":1}` + "\n" +
+		`{"severity":"INFO","message":"custom key unnamed","module":"field","pool":1}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLoggerNamedLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := Named("gcplog_test.named", INFO)
+	logger.out = &buf
+	SetLevel("gcplog_test.named.pool", ERROR)
+	defer ClearLevel("gcplog_test.named.pool")
+	logger.Named("pool").Print("filtered")
+	logger.Named("other").Print("written")
+	if got, want := buf.String(), `{"severity":"INFO","message":"written","logger":"gcplog_test.named.other"}`+"\n"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,165 @@
+package gcplog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PIIKind is a kind of personal data which WithPIIScrubbing can find and replace.
+type PIIKind int
+
+const (
+	PIIEmail PIIKind = iota // Email addresses, like "ann@example.com", replaced by "email:<hash>"
+	PIIIPv4                 // IPv4 addresses, like "203.0.113.7", replaced by "ipv4:<hash>"
+	PIIIPv6                 // IPv6 addresses, like "2001:db8::1", replaced by "ipv6:<hash>"
+	PIIPhone                // International phone numbers starting with "+", like "+1 415-555-0100", replaced by "phone:<hash>"
+)
+
+// piiDetector finds one kind of personal data.
+type piiDetector struct {
+	prefix string         // starts the token which replaces each match
+	re     *regexp.Regexp // finds candidates, which check then confirms
+	// check returns the canonical form of the candidate s[start:end], which is hashed, or false if it isn't personal data.
+	check func(s string, start, end int) (string, bool)
+}
+
+// piiDetectors are the detectors for each PIIKind, in the order they're run, so addresses are found before the numbers inside them.
+var piiDetectors = [...]piiDetector{
+	PIIEmail: {"email:", regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`), checkEmail},
+	PIIIPv4:  {"ipv4:", regexp.MustCompile(`\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}`), checkIPv4},
+	PIIIPv6:  {"ipv6:", regexp.MustCompile(`[0-9A-Fa-f:.]*:[0-9A-Fa-f:.]*[0-9A-Fa-f:]`), checkIPv6},
+	PIIPhone: {"phone:", regexp.MustCompile(`\+[1-9](?:[ .-]?\(?\d\)?){6,14}`), checkPhone},
+}
+
+// piiOrder is the order the detectors are run in, so IPv4 addresses inside IPv6 addresses, like "::ffff:203.0.113.7", are replaced as part of them.
+var piiOrder = [...]PIIKind{PIIEmail, PIIIPv6, PIIIPv4, PIIPhone}
+
+// WithPIIScrubbing returns a new Logger which replaces the provided kinds of personal data in messages and string field values,
+// including those inside groups, with a token made of the kind and a short hash of the value, like "email:3c1a9f", so entries about
+// the same person can still be matched up without the value being logged. Called with no kinds, it scrubs all of them.
+// The kinds are added to any the Logger already scrubs. It runs after WithMasking, and has a similar cost.
+//
+// The hash is the start of a SHA-256 hash of the value, so it's the same in every process, but it's not keyed, so it hides
+// the value from a casual reader rather than from someone who can guess it. Detection favours scrubbing over missing something:
+//
+//   - Email addresses are matched by their shape, so "git@github.com" is scrubbed too. Case doesn't change the hash.
+//   - IPv4 addresses must have four parts of at most 255, and not touch letters, digits or other dotted numbers, so version
+//     strings like "1.2.3" and "v1.2.3.4" are left alone, but a bare "1.2.3.4" is scrubbed. Loopback and private addresses are scrubbed too.
+//   - IPv6 addresses must parse as IPv6, so timestamps like "12:30:45" and names like "pkg::Type" are left alone.
+//   - Phone numbers must start with "+" and have 7 to 15 digits, which may be separated by spaces, dots, dashes and brackets.
+//     Numbers without a country code, like "415-555-0100", aren't found, so dates, durations and IDs aren't mistaken for them.
+//
+// The original Logger is not changed.
+func (l *Logger) WithPIIScrubbing(kinds ...PIIKind) *Logger {
+	c := l.clone()
+	if len(kinds) == 0 {
+		kinds = piiOrder[:]
+	}
+	pii := slices.Clone(c.pii)
+	for _, k := range kinds {
+		if k >= 0 && int(k) < len(piiDetectors) && !slices.Contains(pii, k) {
+			pii = append(pii, k)
+		}
+	}
+	c.pii = pii
+	return c
+}
+
+// scrubPII returns s with the provided kinds of personal data replaced, as described by WithPIIScrubbing.
+func scrubPII(s string, kinds []PIIKind) string {
+	for _, k := range piiOrder {
+		if slices.Contains(kinds, k) {
+			s = piiDetectors[k].scrub(s)
+		}
+	}
+	return s
+}
+
+// scrub returns s with every match of the detector replaced by its token.
+func (d *piiDetector) scrub(s string) string {
+	matches := d.re.FindAllStringIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		canonical, ok := d.check(s, m[0], m[1])
+		if !ok {
+			continue
+		}
+		if b.Len() == 0 {
+			b.Grow(len(s))
+		}
+		b.WriteString(s[last:m[0]])
+		b.WriteString(d.prefix)
+		sum := sha256.Sum256([]byte(canonical))
+		b.WriteString(hex.EncodeToString(sum[:3]))
+		last = m[1]
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// isAlnum reports whether c is an ASCII letter or digit.
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// touches reports whether the character before start, or the one at end, in s is an ASCII letter or digit.
+func touches(s string, start, end int) bool {
+	return (start > 0 && isAlnum(s[start-1])) || (end < len(s) && isAlnum(s[end]))
+}
+
+// checkEmail confirms an email address, which is hashed in lower case.
+func checkEmail(s string, start, end int) (string, bool) {
+	return strings.ToLower(s[start:end]), true
+}
+
+// checkIPv4 confirms an IPv4 address which doesn't touch letters, digits or other dotted numbers.
+func checkIPv4(s string, start, end int) (string, bool) {
+	if touches(s, start, end) || (start > 0 && s[start-1] == '.') || (end+1 < len(s) && s[end] == '.' && isAlnum(s[end+1])) {
+		return "", false
+	}
+	a, err := netip.ParseAddr(s[start:end])
+	if err != nil || !a.Is4() {
+		return "", false
+	}
+	return a.String(), true
+}
+
+// checkIPv6 confirms an IPv6 address which doesn't touch letters or digits.
+func checkIPv6(s string, start, end int) (string, bool) {
+	if touches(s, start, end) || strings.Count(s[start:end], ":") < 2 {
+		return "", false
+	}
+	a, err := netip.ParseAddr(s[start:end])
+	if err != nil || !a.Is6() {
+		return "", false
+	}
+	return a.String(), true
+}
+
+// checkPhone confirms a phone number of 7 to 15 digits which isn't followed by another digit, which is hashed as its digits alone.
+func checkPhone(s string, start, end int) (string, bool) {
+	if touches(s, start, end) {
+		return "", false
+	}
+	var digits []byte
+	for i := start; i < end; i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			digits = append(digits, s[i])
+		}
+	}
+	if len(digits) < 7 || len(digits) > 15 {
+		return "", false
+	}
+	return "+" + string(digits), true
+}
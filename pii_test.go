@@ -0,0 +1,91 @@
+package gcplog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+// piiToken returns the token WithPIIScrubbing replaces the canonical value v with.
+func piiToken(prefix, v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return prefix + hex.EncodeToString(sum[:3])
+}
+
+func TestScrubPII(t *testing.T) {
+	all := piiOrder[:]
+	tests := []struct {
+		in, want string
+	}{
+		// True positives.
+		{"mail ann@example.com now", "mail " + piiToken("email:", "ann@example.com") + " now"},
+		{"ANN@Example.COM", piiToken("email:", "ann@example.com")},
+		{"to <bob.smith+tag@mail.example.co.uk>", "to <" + piiToken("email:", "bob.smith+tag@mail.example.co.uk") + ">"},
+		{"client 203.0.113.7:443 closed", "client " + piiToken("ipv4:", "203.0.113.7") + ":443 closed"},
+		{"from 10.0.0.1.", "from " + piiToken("ipv4:", "10.0.0.1") + "."},
+		{"peer [2001:db8::1]:80", "peer [" + piiToken("ipv6:", "2001:db8::1") + "]:80"},
+		{"2001:DB8:0:0:0:0:0:1 and ::1.", piiToken("ipv6:", "2001:db8::1") + " and " + piiToken("ipv6:", "::1") + "."},
+		{"mapped ::ffff:203.0.113.7", "mapped " + piiToken("ipv6:", "::ffff:203.0.113.7")},
+		{"call +14155550100", "call " + piiToken("phone:", "+14155550100")},
+		{"call +1 (415) 555-0100 today", "call " + piiToken("phone:", "+14155550100") + " today"},
+		{"+44 20 7946 0958", piiToken("phone:", "+442079460958")},
+		{"ids ann@example.com,ann@example.com", "ids " + piiToken("email:", "ann@example.com") + "," + piiToken("email:", "ann@example.com")},
+		// Candidates which aren't personal data, and are left alone.
+		{"upgraded to 1.2.3", "upgraded to 1.2.3"},
+		{"version v1.2.3.4 and 1.2.3.4.5", "version v1.2.3.4 and 1.2.3.4.5"},
+		{"at 2024-01-02T03:04:05.123+01:00", "at 2024-01-02T03:04:05.123+01:00"},
+		{"took 12:30:45 or 1:02", "took 12:30:45 or 1:02"},
+		{"see pkg::Type and std::vector", "see pkg::Type and std::vector"},
+		{"bad 300.1.2.3 and 1.2.3.04", "bad 300.1.2.3 and 1.2.3.04"},
+		{"local 415-555-0100 and sum 3+4", "local 415-555-0100 and sum 3+4"},
+		{"too many +1234567890123456 too few +123456", "too many +1234567890123456 too few +123456"},
+		{"semver 1.0.0+20130313144700", "semver 1.0.0+20130313144700"},
+		{"no user @example.com or ann@localhost", "no user @example.com or ann@localhost"},
+		{"deadbeef:cafe", "deadbeef:cafe"},
+		// Candidates which look like data and are scrubbed, as documented.
+		{"bare 1.2.3.4", "bare " + piiToken("ipv4:", "1.2.3.4")},
+		{"git@github.com:org/repo", piiToken("email:", "git@github.com") + ":org/repo"},
+	}
+	for _, tt := range tests {
+		if got := scrubPII(tt.in, all); got != tt.want {
+			t.Errorf("scrubPII(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWithPIIScrubbing(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).With("user", "ann@example.com", "n", 1)
+	logger.out = &buf
+	emails := logger.WithPIIScrubbing(PIIEmail)
+	emails.Printw("login from 203.0.113.7 by ann@example.com", "ip", "203.0.113.7", "tel", String("t", "+14155550100"))
+	emails.WithPIIScrubbing(PIIIPv4, PIIEmail, PIIKind(-1), PIIKind(99)).Printw("login from 203.0.113.7", "ip", "203.0.113.7")
+	logger.WithMasking().WithPIIScrubbing().Print("password=ann@example.com +14155550100")
+	logger.Print("raw ann@example.com")
+	email, ip, phone := piiToken("email:", "ann@example.com"), piiToken("ipv4:", "203.0.113.7"), piiToken("phone:", "+14155550100")
+	want := `{"severity":"INFO","message":"login from 203.0.113.7 by ` + email + `","ip":"203.0.113.7","n":1,"tel":"+14155550100","user":"` + email + `"}` + "\n" +
+		`{"severity":"INFO","message":"login from ` + ip + `","ip":"` + ip + `","n":1,"user":"` + email + `"}` + "\n" +
+		`{"severity":"INFO","message":"password=*** ` + phone + `","n":1,"user":"` + email + `"}` + "\n" +
+		`{"severity":"INFO","message":"raw ann@example.com","n":1,"user":"ann@example.com"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func BenchmarkPIIScrubbing(b *testing.B) {
+	for _, bb := range []struct{ name, msg string }{
+		{"no match", "GET /orders/1234 returned 200 in 35ms"},
+		{"match", "GET /orders/1234 from 203.0.113.7 for ann@example.com"},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			logger := New(INFO).WithPIIScrubbing()
+			logger.out = io.Discard
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				logger.Print(bb.msg)
+			}
+		})
+	}
+}
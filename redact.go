@@ -0,0 +1,286 @@
+package gcplog
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Redactor is implemented by types which hold sensitive data, like tokens, addresses or card numbers, to control what's logged in their place.
+// When a structured field value, or a value passed to PrintJSON, is a Redactor, the value returned by Redact is written instead.
+// Redactors are found inside structs, maps, slices, arrays and pointers too, up to a depth of maxRedactDepth, and anything nested
+// more deeply than that is replaced, so it can't leak. Redact takes precedence over any other encoding the value has, such as LogFielder.
+//
+// A struct or map which holds a Redactor is written as a JSON object with its keys sorted, following the field names, omitempty options
+// and embedding rules of encoding/json. Values with their own JSON or text encoding, like time.Time, aren't looked inside.
+// Message arguments formatted by Printf aren't redacted.
+type Redactor interface {
+	Redact() any
+}
+
+// maxRedactDepth is how deeply values are searched for Redactors, which stops a value which includes itself looping forever.
+// It's the same as the depth values are cut at when they're encoded, so a Redactor is never cut off early.
+const maxRedactDepth = maxValueDepth
+
+// redactedValue is used in place of a Redactor whose Redact method panics.
+const redactedValue = "(REDACTED)"
+
+var (
+	redactorType      = reflect.TypeOf((*Redactor)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+	redactTypes sync.Map // whether values of each reflect.Type can hold a Redactor, by type
+)
+
+// needsRedaction reports whether v is, or holds, a Redactor.
+func needsRedaction(v any) bool {
+	return v != nil && hasRedactor(reflect.ValueOf(v), 0)
+}
+
+// mayRedact reports whether values of type t can be or hold a Redactor, caching the answer for each type.
+func mayRedact(t reflect.Type) bool {
+	if r, ok := redactTypes.Load(t); ok {
+		return r.(bool)
+	}
+	r := typeMayRedact(t, make(map[reflect.Type]bool))
+	redactTypes.Store(t, r)
+	return r
+}
+
+// typeMayRedact reports whether values of type t can be or hold a Redactor, without looking at types already in seen again.
+func typeMayRedact(t reflect.Type, seen map[reflect.Type]bool) bool {
+	switch {
+	case t.Implements(redactorType):
+		return true
+	case t.Implements(jsonMarshalerType), t.Implements(textMarshalerType), seen[t]:
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Interface:
+		return true // depends on the value it holds
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return typeMayRedact(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if _, _, ok := jsonField(t.Field(i)); ok && typeMayRedact(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasRedactor reports whether v is, or holds, a Redactor which would be written, at the provided depth.
+// Anything which might hold a Redactor beyond maxRedactDepth counts, so redact can replace it.
+func hasRedactor(v reflect.Value, depth int) bool {
+	if !v.IsValid() || !mayRedact(v.Type()) || isNil(v) {
+		return false
+	}
+	if v.Type().Implements(redactorType) || depth >= maxRedactDepth {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return hasRedactor(v.Elem(), elemDepth(v, depth))
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if hasRedactor(v.Index(i), depth+1) {
+				return true
+			}
+		}
+	case reflect.Map:
+		if m, ok := mapOfAny(v); ok { // the most common case, which can be searched without allocating
+			for _, mv := range m {
+				if hasRedactor(reflect.ValueOf(mv), depth+1) {
+					return true
+				}
+			}
+			return false
+		}
+		for iter := v.MapRange(); iter.Next(); {
+			if hasRedactor(iter.Value(), depth+1) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if _, _, ok := jsonField(v.Type().Field(i)); ok && hasRedactor(v.Field(i), depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redact returns v with every Redactor it holds replaced by the value its Redact method returns, at the provided depth.
+// Structs and maps which hold a Redactor are returned as a map[string]any, and slices and arrays as a []any.
+// Values which don't hold a Redactor are returned as they are.
+func redact(v reflect.Value, depth int) any {
+	if !hasRedactor(v, depth) {
+		if !v.IsValid() {
+			return nil
+		}
+		return v.Interface()
+	}
+	if depth >= maxRedactDepth {
+		return maxDepthValue
+	}
+	if r, ok := v.Interface().(Redactor); ok {
+		return redact(reflect.ValueOf(safeRedact(r)), depth+1)
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return redact(v.Elem(), elemDepth(v, depth))
+	case reflect.Slice, reflect.Array:
+		s := make([]any, v.Len())
+		for i := range s {
+			s[i] = redact(v.Index(i), depth+1)
+		}
+		return s
+	case reflect.Map:
+		m := make(map[string]any, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			m[mapKey(iter.Key())] = redact(iter.Value(), depth+1)
+		}
+		return m
+	case reflect.Struct:
+		m := make(map[string]any, v.NumField())
+		jsonStructFields(m, v, func(fv reflect.Value) any { return redact(fv, depth+1) })
+		return m
+	}
+	return v.Interface()
+}
+
+// elemDepth returns the depth of the value the pointer or interface v, at the provided depth, refers to.
+// It's the same, unless that's another pointer or interface, so a pointer which refers back to itself can't be followed forever.
+func elemDepth(v reflect.Value, depth int) int {
+	if k := v.Elem().Kind(); k == reflect.Pointer || k == reflect.Interface {
+		return depth + 1
+	}
+	return depth
+}
+
+// jsonStructFields adds the fields of the struct v to m, as encoding/json would name them, converted by value. Fields of embedded structs
+// are added as if they were fields of v, unless v has a field with the same name. Fields which can't be read through reflection are left out.
+func jsonStructFields(m map[string]any, v reflect.Value, value func(reflect.Value) any) {
+	var embedded []reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		name, omitEmpty, ok := jsonField(f)
+		fv := v.Field(i)
+		if !ok || (omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			if fv.Kind() == reflect.Pointer && f.Type.Elem().Kind() == reflect.Struct {
+				if !fv.IsNil() {
+					embedded = append(embedded, fv.Elem())
+				}
+				continue
+			}
+			if fv.Kind() == reflect.Struct {
+				embedded = append(embedded, fv)
+				continue
+			}
+		}
+		if !fv.CanInterface() {
+			continue
+		}
+		m[orDefault(name, f.Name)] = value(fv)
+	}
+	for _, ev := range embedded {
+		inner := make(map[string]any, ev.NumField())
+		jsonStructFields(inner, ev, value)
+		for k, iv := range inner {
+			if _, ok := m[k]; !ok {
+				m[k] = iv
+			}
+		}
+	}
+}
+
+// jsonField returns the name encoding/json uses for the struct field f, or "" for the default, and whether it has the omitempty option.
+// It returns false if encoding/json leaves the field out.
+func jsonField(f reflect.StructField) (name string, omitEmpty, ok bool) {
+	if !f.IsExported() {
+		t := f.Type
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if !f.Anonymous || t.Kind() != reflect.Struct {
+			return "", false, false
+		}
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	return name, strings.Contains(","+opts+",", ",omitempty,"), true
+}
+
+// isNil reports whether v is a nil pointer, interface, map or slice.
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+// isEmptyValue reports whether v is empty, as the omitempty option of encoding/json defines it.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// mapKey returns the map key k as a string, as encoding/json would write it.
+func mapKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if b, err := tm.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+// safeRedact returns the result of r.Redact, or redactedValue if it panics.
+func safeRedact(r Redactor) (v any) {
+	defer func() {
+		if recover() != nil {
+			v = redactedValue
+		}
+	}()
+	return r.Redact()
+}
+
+// mapOfAny returns v as a map[string]any, if it is one and can be read through reflection.
+func mapOfAny(v reflect.Value) (map[string]any, bool) {
+	if !v.CanInterface() {
+		return nil, false
+	}
+	m, ok := v.Interface().(map[string]any)
+	return m, ok
+}
@@ -0,0 +1,209 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPAN = "4111111111111111"
+
+// card holds a card number, which must never be logged.
+type card struct {
+	PAN    string `json:"pan"`
+	Expiry string `json:"expiry"`
+}
+
+func (c card) Redact() any {
+	return map[string]any{"last4": c.PAN[len(c.PAN)-4:], "expiry": c.Expiry}
+}
+
+// payment holds a card one level down.
+type payment struct {
+	Amount int   `json:"amount"`
+	Card   card  `json:"card"`
+	Backup *card `json:"backup,omitempty"`
+}
+
+// purchase holds a card two levels down.
+type purchase struct {
+	ID       string    `json:"id"`
+	Payment  payment   `json:"payment"`
+	Placed   time.Time `json:"placed"`
+	Notes    string    `json:"notes,omitempty"`
+	Secret   string    `json:"-"`
+	internal card
+}
+
+// wallet holds a card, and is embedded by account, so its fields are promoted.
+type wallet struct {
+	Card  card `json:"card"`
+	Owner string
+}
+
+type account struct {
+	*wallet
+	Owner string
+}
+
+// panicky panics when redacted.
+type panicky struct{ Token string }
+
+func (p *panicky) Redact() any { panic("no") }
+
+// selfRedactor returns itself when redacted.
+type selfRedactor struct{ Token string }
+
+func (s selfRedactor) Redact() any { return s }
+
+func TestRedactor(t *testing.T) {
+	c := card{PAN: testPAN, Expiry: "12/30"}
+	o := purchase{ID: "o1", Payment: payment{Amount: 5, Card: c}, Placed: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Secret: testPAN, internal: c}
+	tests := []struct {
+		name  string
+		print func(l *Logger)
+		want  string
+	}{
+		{
+			name:  "field",
+			print: func(l *Logger) { l.With("card", c).Print("m") },
+			want:  `"card":{"expiry":"12/30","last4":"1111"}`,
+		},
+		{
+			name:  "nested",
+			print: func(l *Logger) { l.Printw("m", "order", o) },
+			want:  `"order":{"id":"o1","payment":{"amount":5,"card":{"expiry":"12/30","last4":"1111"}},"placed":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:  "pointer in map",
+			print: func(l *Logger) { l.Printw("m", "p", map[string]any{"pay": &payment{Card: c, Backup: &c}}) },
+			want:  `"p":{"pay":{"amount":0,"backup":{"expiry":"12/30","last4":"1111"},"card":{"expiry":"12/30","last4":"1111"}}}`,
+		},
+		{
+			name:  "slice",
+			print: func(l *Logger) { l.PrintFields("m", Any("cards", []card{c})) },
+			want:  `"cards":[{"expiry":"12/30","last4":"1111"}]`,
+		},
+		{
+			name:  "group",
+			print: func(l *Logger) { l.WithGroup("req").With("order", &o).Print("m") },
+			want:  `"req":{"order":{"id":"o1","payment":{"amount":5,"card":{"expiry":"12/30","last4":"1111"}},"placed":"2024-01-02T03:04:05Z"}}`,
+		},
+		{
+			name: "embedded",
+			print: func(l *Logger) {
+				l.Printw("m", "account", account{wallet: &wallet{Card: c, Owner: "bob"}, Owner: "ann"})
+			},
+			want: `"account":{"Owner":"ann","card":{"expiry":"12/30","last4":"1111"}}`,
+		},
+		{
+			name:  "PrintJSON",
+			print: func(l *Logger) { l.PrintJSON("m", o) },
+			want:  `"id":"o1","payment":{"amount":5,"card":{"expiry":"12/30","last4":"1111"}},"placed":"2024-01-02T03:04:05Z"`,
+		},
+		{
+			name:  "PrintJSON Redactor",
+			print: func(l *Logger) { l.WithJSONKey("card").PrintJSON("m", c) },
+			want:  `"card":{"expiry":"12/30","last4":"1111"}`,
+		},
+		{
+			name:  "panic",
+			print: func(l *Logger) { l.Printw("m", "p", []*panicky{{Token: testPAN}}) },
+			want:  `"p":["(REDACTED)"]`,
+		},
+		{
+			name:  "loop",
+			print: func(l *Logger) { l.Printw("m", "l", selfRedactor{Token: testPAN}) },
+			want:  `"l":"(MAX DEPTH)"`,
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		logger := New(INFO)
+		logger.out = &buf
+		tt.print(logger)
+		got := buf.String()
+		if !json.Valid(buf.Bytes()) || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: got %s, want it to contain %s", tt.name, got, tt.want)
+		}
+		if strings.Contains(got, testPAN) {
+			t.Errorf("%s: card number logged: %s", tt.name, got)
+		}
+	}
+}
+
+func TestRedactorDepth(t *testing.T) {
+	var v any = card{PAN: testPAN}
+	for i := 0; i < maxRedactDepth+2; i++ {
+		v = []any{v}
+	}
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.Printw("m", "deep", v, "shallow", []any{[]int{1}})
+	if got := buf.String(); strings.Contains(got, testPAN) || !strings.Contains(got, maxDepthValue) || !strings.Contains(got, `"shallow":[[1]]`) {
+		t.Errorf("got %s, want the card replaced by %s", got, maxDepthValue)
+	}
+}
+
+func TestRedactTypes(t *testing.T) {
+	tests := []struct {
+		v    any
+		want bool
+	}{
+		{card{}, true},
+		{purchase{}, true},
+		{map[string]any{}, true},
+		{[]string{}, false},
+		{time.Time{}, false},
+		{struct{ s *card }{}, false},
+		{struct {
+			C card `json:"-"`
+		}{}, false},
+	}
+	for _, tt := range tests {
+		if got := mayRedact(reflect.TypeOf(tt.v)); got != tt.want {
+			t.Errorf("mayRedact(%T) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkRedactor(b *testing.B) {
+	o := purchase{ID: "o1", Payment: payment{Amount: 5, Card: card{PAN: testPAN}}}
+	b.Run("none", func(b *testing.B) {
+		logger := New(INFO).With("m", map[string]any{"a": 1, "b": "x"})
+		logger.out = io.Discard
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			logger.Print("Hello World")
+		}
+	})
+	b.Run("nested", func(b *testing.B) {
+		logger := New(INFO).With("order", o)
+		logger.out = io.Discard
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			logger.Print("Hello World")
+		}
+	})
+}
+
+// hidden embeds an unexported struct type which holds a card. Its exported fields are promoted, as encoding/json does.
+type hidden struct {
+	wallet
+	ID int
+}
+
+func TestRedactorUnexportedEmbedded(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.Printw("m", "h", hidden{wallet: wallet{Card: card{PAN: testPAN}, Owner: "ann"}, ID: 1})
+	if got, want := buf.String(), `"h":{"ID":1,"Owner":"ann","card":{"expiry":"","last4":"1111"}}`; strings.Contains(got, testPAN) || !strings.Contains(got, want) {
+		t.Errorf("got %s, want it to contain %s", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package gcplog
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// WithSeverityRemap returns a new Logger which replaces the severity of its entries using the provided map,
+// for example map[string]string{NOTICE: INFO} writes NOTICE entries as INFO.
+//
+// The remapped severity is the one which is written, and the one which is checked against the level set by SetLevel.
+// Sampling, set by WithSampling, is decided on the original severity, so remapping ERROR to DEBUG doesn't make ERROR entries sampled.
+// Remaps are only applied once, so chains aren't allowed: a pair whose new severity is itself remapped to something else is ignored.
+// Pairs where either severity isn't valid are also ignored. The new map is merged with any existing remaps, replacing the pairs
+// for the same severities, but a new pair which would form a chain with an existing one is ignored, so existing pairs are
+// never dropped. Use TryWithSeverityRemap to find out about ignored pairs. The original Logger is not changed.
+func (l *Logger) WithSeverityRemap(m map[string]string) *Logger {
+	c := l.clone()
+	c.remap, _ = mergeRemap(c.remap, m)
+	return c
+}
+
+// TryWithSeverityRemap is the same as WithSeverityRemap, but returns an error wrapping ErrInvalidRemap, and no Logger,
+// if any of the provided pairs would be ignored, because a severity isn't valid or because it would form a chain.
+func (l *Logger) TryWithSeverityRemap(m map[string]string) (*Logger, error) {
+	c := l.clone()
+	remap, err := mergeRemap(c.remap, m)
+	if err != nil {
+		return nil, err
+	}
+	c.remap = remap
+	return c, nil
+}
+
+// mergeRemap returns the existing remaps with the valid pairs of m added, as described by WithSeverityRemap,
+// and an error describing each pair of m which was ignored. Neither map is modified.
+func mergeRemap(existing, m map[string]string) (map[string]string, error) {
+	var errs []error
+	added := make(map[string]string, len(m))
+	for _, from := range sortedKeys(m) {
+		to := m[from]
+		if !isValidSeverity(from) || !isValidSeverity(to) {
+			errs = append(errs, fmt.Errorf("%w: %s to %s: %w", ErrInvalidRemap, from, to, ErrInvalidSeverity))
+			continue
+		}
+		added[canonicalSeverity(from)] = canonicalSeverity(to)
+	}
+	for _, from := range sortedKeys(added) {
+		if to := added[from]; from != to {
+			if next, ok := added[to]; ok && next != to {
+				errs = append(errs, fmt.Errorf("%w: %s to %s is remapped again to %s", ErrInvalidRemap, from, to, next))
+				delete(added, from)
+			}
+		}
+	}
+	for {
+		merged := make(map[string]string, len(existing)+len(added))
+		for from, to := range existing {
+			merged[from] = to
+		}
+		for from, to := range added {
+			merged[from] = to
+		}
+		chained := ""
+		for _, from := range sortedKeys(added) {
+			if err := remapChain(merged, from); err != nil {
+				errs = append(errs, err)
+				chained = from
+				break
+			}
+		}
+		if chained == "" {
+			return merged, errors.Join(errs...)
+		}
+		delete(added, chained) // the existing pair it chains with is kept
+	}
+}
+
+// remapChain returns an error if the pair in m for the provided severity forms a chain with another pair in m.
+func remapChain(m map[string]string, from string) error {
+	to := m[from]
+	if from == to {
+		return nil
+	}
+	if next, ok := m[to]; ok && next != to {
+		return fmt.Errorf("%w: %s to %s is already remapped to %s", ErrInvalidRemap, from, to, next)
+	}
+	for other, otherTo := range m {
+		if other != from && otherTo == from {
+			return fmt.Errorf("%w: %s to %s would remap %s again, as it's already remapped from %s", ErrInvalidRemap, from, to, from, other)
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in order, so pairs are checked in the same order every time.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
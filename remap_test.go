@@ -0,0 +1,122 @@
+package gcplog
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestWithSeverityRemap(t *testing.T) {
+	tests := []struct {
+		name     string
+		severity string
+		remap    map[string]string
+		want     string
+	}{
+		{"remapped", NOTICE, map[string]string{NOTICE: INFO}, INFO},
+		{"lowercase", NOTICE, map[string]string{"notice": "info"}, INFO},
+		{"identity", NOTICE, map[string]string{NOTICE: NOTICE}, NOTICE},
+		{"other severity", WARNING, map[string]string{NOTICE: INFO}, WARNING},
+		{"invalid value", NOTICE, map[string]string{NOTICE: "BOGUS"}, NOTICE},
+		{"invalid key", NOTICE, map[string]string{"BOGUS": INFO}, NOTICE},
+		{"chain start", NOTICE, map[string]string{NOTICE: INFO, INFO: DEBUG}, NOTICE},
+		{"chain end", INFO, map[string]string{NOTICE: INFO, INFO: DEBUG}, DEBUG},
+		{"chain via identity", NOTICE, map[string]string{NOTICE: INFO, INFO: INFO}, INFO},
+		{"nil", NOTICE, nil, NOTICE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(tt.severity)
+			logger.out = &buf
+			logger.WithSeverityRemap(tt.remap).Print("Hello World")
+			want := `{"severity":"` + tt.want + `","message":"Hello World"}` + "\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestWithSeverityRemapMerges(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(DEBUG)
+	logger.out = &buf
+	remapped := logger.WithSeverityRemap(map[string]string{DEBUG: DEFAULT})
+	remapped.WithSeverityRemap(map[string]string{DEBUG: INFO}).Print("child")
+	remapped.Print("parent")
+	want := `{"severity":"INFO","message":"child"}` + "\n" +
+		`{"severity":"DEFAULT","message":"parent"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithSeverityRemapKeepsExistingPairs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(DEBUG)
+	logger.out = &buf
+	remapped := logger.WithSeverityRemap(map[string]string{NOTICE: INFO}).WithSeverityRemap(map[string]string{INFO: DEBUG, WARNING: NOTICE, ERROR: CRITICAL})
+	for _, sev := range []string{NOTICE, INFO, WARNING, ERROR} {
+		remapped.PrintAt(sev, sev)
+	}
+	want := `{"severity":"INFO","message":"NOTICE"}` + "\n" +
+		`{"severity":"INFO","message":"INFO"}` + "\n" +
+		`{"severity":"WARNING","message":"WARNING"}` + "\n" +
+		`{"severity":"CRITICAL","message":"ERROR"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTryWithSeverityRemap(t *testing.T) {
+	logger := New(DEBUG).WithSeverityRemap(map[string]string{NOTICE: INFO})
+	tests := []struct {
+		name  string
+		remap map[string]string
+		want  error
+	}{
+		{"valid", map[string]string{ERROR: CRITICAL, NOTICE: DEBUG}, nil},
+		{"identity", map[string]string{INFO: INFO}, nil},
+		{"invalid severity", map[string]string{ERROR: "BOGUS"}, ErrInvalidSeverity},
+		{"chain within", map[string]string{ERROR: CRITICAL, CRITICAL: ALERT}, ErrInvalidRemap},
+		{"chain from existing", map[string]string{INFO: DEBUG}, ErrInvalidRemap},
+		{"chain into existing", map[string]string{WARNING: NOTICE}, ErrInvalidRemap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := logger.TryWithSeverityRemap(tt.remap)
+			if !errors.Is(err, tt.want) || (tt.want != nil && !errors.Is(err, ErrInvalidRemap)) {
+				t.Fatalf("TryWithSeverityRemap() error = %v, want %v", err, tt.want)
+			}
+			if (got == nil) != (err != nil) {
+				t.Errorf("TryWithSeverityRemap() = %v, %v, want a Logger only without an error", got, err)
+			}
+		})
+	}
+	var buf bytes.Buffer
+	remapped, _ := logger.TryWithSeverityRemap(map[string]string{NOTICE: DEBUG})
+	remapped.out = &buf
+	remapped.PrintAt(NOTICE, "replaced")
+	if want := `{"severity":"DEBUG","message":"replaced"}` + "\n"; buf.String() != want {
+		t.Errorf("got %s, want %s", buf.String(), want)
+	}
+}
+
+func TestWithSeverityRemapFiltering(t *testing.T) {
+	t.Cleanup(func() { ClearLevel("remap") })
+	SetLevel("remap", NOTICE)
+	var buf bytes.Buffer
+	logger := Named("remap", NOTICE)
+	logger.out = &buf
+	logger.WithSeverityRemap(map[string]string{NOTICE: INFO}).Print("suppressed")
+	logger.SetSeverity(INFO)
+	logger.WithSeverityRemap(map[string]string{INFO: WARNING}).Print("written")
+	want := `{"severity":"WARNING","message":"written","logger":"remap"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got := logger.Counts()[WARNING]; got != 1 {
+		t.Errorf("Counts()[WARNING] = %d, want 1", got)
+	}
+}
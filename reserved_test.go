@@ -0,0 +1,52 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestReservedKeys(t *testing.T) {
+	keys := []string{
+		"severity", "message", "logger", "time", "timestamp", "httpRequest",
+		"logging.googleapis.com/trace", "logging.googleapis.com/spanId", "logging.googleapis.com/trace_sampled",
+		"logging.googleapis.com/labels", "logging.googleapis.com/sourceLocation", "logging.googleapis.com/insertId",
+		"logging.googleapis.com/operation",
+	}
+	paths := map[string]func(l *Logger, key string){
+		"With":      func(l *Logger, key string) { l.With(key, "spoof").Print("Hello World") },
+		"Printw":    func(l *Logger, key string) { l.Printw("Hello World", key, "spoof") },
+		"Printm":    func(l *Logger, key string) { l.Printm("Hello World", map[string]any{key: "spoof"}) },
+		"PrintJSON": func(l *Logger, key string) { l.PrintJSON("Hello World", map[string]any{key: "spoof"}) },
+	}
+	for name, path := range paths {
+		for _, key := range keys {
+			t.Run(name+"/"+key, func(t *testing.T) {
+				var buf bytes.Buffer
+				var errs []error
+				logger := New(ALERT)
+				logger.out = &buf
+				logger.SetErrorHandler(func(err error) { errs = append(errs, err) })
+				path(logger, key)
+				path(logger, key)
+				var e map[string]any
+				if err := json.Unmarshal(bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0], &e); err != nil {
+					t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+				}
+				if e["severity"] != ALERT || e["message"] != "Hello World" {
+					t.Errorf("envelope was changed: %s", buf.String())
+				}
+				if e[reservedPrefix+key] != "spoof" {
+					t.Errorf("field wasn't renamed: %s", buf.String())
+				}
+				if v, ok := e[key]; ok && v == "spoof" {
+					t.Errorf("field wasn't removed: %s", buf.String())
+				}
+				if len(errs) != 1 || !errors.Is(errs[0], ErrReservedKey) {
+					t.Errorf("error handler got %v, want a single ErrReservedKey", errs)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package gcplog
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// samplingInterval is how often a summary of the entries dropped by sampling is written.
+const samplingInterval = 60 * time.Second
+
+// sampler decides which low severity entries are written, and keeps track of the ones which are dropped.
+type sampler struct {
+	fractions map[string]float64 // the fraction of entries to keep, by severity, never modified once set
+	random    func() float64     // returns a number in [0.0, 1.0)
+	mu        sync.Mutex         // guards dropped and since
+	dropped   map[string]uint64  // the number of entries dropped since the last summary, by severity
+	since     time.Time          // when the last summary was written, or the zero time before the first entry
+}
+
+// WithSampling returns a new Logger which only writes the provided fraction of entries at the provided severity.
+// For example, a fraction of 0.01 keeps 1% of entries. The fraction is clamped between 0.0 and 1.0.
+//
+// Only severities below WARNING can be sampled, so WARNING and above are always written. Sampling is decided on the severity
+// an entry is logged at, before WithSeverityRemap changes it, so remapping ERROR to DEBUG doesn't make ERROR entries sampled.
+// If the provided severity is not valid, or is WARNING or above, then the new Logger samples the same as the original.
+//
+// Once a minute, with the next entry, a summary of how many entries were dropped is written at the sampled severity,
+// for example "sampled out 14,302 DEBUG entries in the last 60s". There's no background timer: the summary is written by the
+// first call which writes or drops an entry after the minute is up, measured with the Clock of the Logger, so a Logger which
+// stops writing doesn't report the last entries it dropped. Use WithSamplingSource to decide which entries are kept
+// deterministically, for example in tests. The original Logger is not changed.
+func (l *Logger) WithSampling(severity string, fraction float64) *Logger {
+	c := l.clone()
+	severity = canonicalSeverity(severity)
+	if !isValidSeverity(severity) || SeverityAtLeast(severity, WARNING) {
+		return c
+	}
+	s := newSampler()
+	if c.sampler != nil {
+		s.random = c.sampler.random
+		for sev, f := range c.sampler.fractions {
+			s.fractions[sev] = f
+		}
+	}
+	s.fractions[severity] = min(max(fraction, 0), 1)
+	c.sampler = s
+	return c
+}
+
+// WithSamplingSource returns a new Logger which uses the provided function to decide which entries are sampled by WithSampling.
+// It must return a number in [0.0, 1.0), and an entry is kept when the number is below the fraction for its severity.
+// This makes sampling deterministic in tests. A nil function restores the default, math/rand.Float64.
+// It can be called before or after WithSampling, and the counts of dropped entries start again. The original Logger is not changed.
+func (l *Logger) WithSamplingSource(random func() float64) *Logger {
+	c := l.clone()
+	if random == nil {
+		random = rand.Float64
+	}
+	s := newSampler()
+	s.random = random
+	if c.sampler != nil {
+		for sev, f := range c.sampler.fractions {
+			s.fractions[sev] = f
+		}
+	}
+	c.sampler = s
+	return c
+}
+
+// newSampler returns a sampler which keeps every entry, using the default random source.
+func newSampler() *sampler {
+	return &sampler{
+		fractions: make(map[string]float64),
+		random:    rand.Float64,
+		dropped:   make(map[string]uint64),
+	}
+}
+
+// dropsAll reports whether every entry with the provided severity is dropped.
+func (s *sampler) dropsAll(severity string) bool {
+	f, ok := s.fractions[canonicalSeverity(severity)]
+	return ok && f <= 0
+}
+
+// keep reports whether an entry with the provided severity, before any remapping, should be written, counting it as dropped if not.
+// Entries at WARNING and above are always kept.
+func (s *sampler) keep(severity string) bool {
+	severity = canonicalSeverity(severity)
+	f, ok := s.fractions[severity]
+	if !ok || f >= 1 || SeverityAtLeast(severity, WARNING) {
+		return true
+	}
+	if f > 0 && s.random() < f {
+		return true
+	}
+	s.mu.Lock()
+	s.dropped[severity]++
+	s.mu.Unlock()
+	return false
+}
+
+// summaries returns an entry for each severity which has had entries dropped, if a summary is due at the provided time.
+// The first call starts the interval, so the first summary is due a minute after the first entry.
+func (s *sampler) summaries(name string, now time.Time) []entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.since.IsZero() {
+		s.since = now
+		return nil
+	}
+	elapsed := now.Sub(s.since)
+	if elapsed < samplingInterval {
+		return nil
+	}
+	s.since = now
+	var summaries []entry
+	for _, sev := range severityAll {
+		n := s.dropped[sev]
+		if n == 0 {
+			continue
+		}
+		delete(s.dropped, sev)
+		summaries = append(summaries, entry{
+			severity: sev,
+			message:  fmt.Sprintf("sampled out %s %s entries in the last %ds", groupThousands(n), sev, int(elapsed.Seconds())),
+			name:     name,
+		})
+	}
+	return summaries
+}
+
+// groupThousands formats n in decimal, with a comma between each group of three digits.
+func groupThousands(n uint64) string {
+	s := strconv.FormatUint(n, 10)
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
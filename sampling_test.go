@@ -0,0 +1,89 @@
+package gcplog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSamplingNeverDropsWarningAndAbove(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(ERROR)
+	logger.out = &buf
+	sampled := logger.WithSampling(DEBUG, 0)
+	for _, sev := range []string{WARNING, ERROR, CRITICAL, ALERT, EMERGENCY} {
+		sampled = sampled.WithSampling(sev, 0)
+	}
+	if sampled.sampler == nil {
+		t.Fatal("WithSampling(DEBUG, 0) didn't create a sampler")
+	}
+	sampled.sampler.random = func() float64 { return 0.99 }
+	for _, sev := range severityAll {
+		if SeverityAtLeast(sev, WARNING) {
+			sampled.SetSeverity(sev)
+			sampled.Print("never sampled")
+		}
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 5 {
+		t.Errorf("wrote %d entries, want 5:\n%s", got, buf.String())
+	}
+}
+
+func TestSamplingBeforeRemap(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(DEBUG)
+	logger.out = &buf
+	sampled := logger.WithSeverityRemap(map[string]string{ERROR: DEBUG, INFO: WARNING}).WithSampling(DEBUG, 0).WithSampling(INFO, 0)
+	sampled.PrintAt(ERROR, "kept")
+	sampled.PrintAt(INFO, "dropped")
+	sampled.PrintAt(DEBUG, "dropped")
+	if got, want := buf.String(), `{"severity":"DEBUG","message":"kept"}`+"\n"; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if !sampled.At(ERROR).Enabled() || sampled.At(INFO).Enabled() {
+		t.Error("Enabled() didn't decide sampling on the severity before remapping")
+	}
+}
+
+func TestWithSamplingSource(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(DEBUG)
+	logger.out = &buf
+	keepEveryOther := func() func() float64 {
+		i := 0
+		return func() float64 {
+			i++
+			return float64(i % 2) // 1.0 is dropped, 0.0 is kept
+		}
+	}
+	before := logger.WithSamplingSource(keepEveryOther()).WithSampling(DEBUG, 0.5)
+	after := logger.WithSampling(DEBUG, 0.5).WithSamplingSource(keepEveryOther())
+	for n := 0; n < 4; n++ {
+		before.Printf("before %d", n)
+		after.Printf("after %d", n)
+	}
+	want := `{"severity":"DEBUG","message":"before 1"}` + "\n" + `{"severity":"DEBUG","message":"after 1"}` + "\n" +
+		`{"severity":"DEBUG","message":"before 3"}` + "\n" + `{"severity":"DEBUG","message":"after 3"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if s := after.WithSamplingSource(nil).sampler; s.random == nil || s.fractions[DEBUG] != 0.5 {
+		t.Errorf("WithSamplingSource(nil) = %+v, want the default source and the same fractions", s)
+	}
+}
+
+func TestGroupThousands(t *testing.T) {
+	tests := map[uint64]string{
+		0:        "0",
+		999:      "999",
+		1000:     "1,000",
+		14302:    "14,302",
+		1234567:  "1,234,567",
+		18446744: "18,446,744",
+	}
+	for n, want := range tests {
+		if got := groupThousands(n); got != want {
+			t.Errorf("groupThousands(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
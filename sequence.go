@@ -0,0 +1,34 @@
+package gcplog
+
+import "sync/atomic"
+
+// SequenceScope controls which log entries share the sequence numbers added by WithSequenceNumbers.
+type SequenceScope int
+
+const (
+	SequencePerLogger  SequenceScope = iota // Entries written by the Logger returned by WithSequenceNumbers, and every Logger derived from it
+	SequencePerProcess                      // Entries written by every Logger in the process with sequence numbers per process
+)
+
+// sequenceKey is the key the sequence number added by WithSequenceNumbers is written with.
+const sequenceKey = "seq"
+
+// processSequence numbers the entries of every Logger with sequence numbers per process.
+var processSequence atomic.Uint64
+
+// WithSequenceNumbers returns a new Logger which adds a "seq" field to every log entry, holding a number which goes up by one
+// for each entry written, starting at 1. Cloud Logging doesn't keep the order of entries written in the same millisecond,
+// so sorting by the sequence number recovers the order they were logged in. The numbers are shared by every Logger derived
+// from the new one, or by every Logger in the process when the scope is SequencePerProcess. The default scope is SequencePerLogger.
+//
+// Only entries which are written are numbered, so entries dropped by SetLevel or by sampling don't leave gaps.
+// The original Logger is not changed.
+func (l *Logger) WithSequenceNumbers(scope ...SequenceScope) *Logger {
+	c := l.clone()
+	if len(scope) > 0 && scope[0] == SequencePerProcess {
+		c.seq = &processSequence
+	} else {
+		c.seq = new(atomic.Uint64)
+	}
+	return c
+}
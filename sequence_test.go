@@ -0,0 +1,85 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWithSequenceNumbers(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	seq := logger.WithSequenceNumbers().WithSampling(DEBUG, 0)
+	seq.Print("one")
+	seq.PrintAt(DEBUG, "dropped")
+	seq.WithField("seq", "mine").Print("two")
+	logger.Print("none")
+	seq.WithSequenceNumbers().Print("restarted")
+	want := `{"severity":"INFO","message":"one","seq":1}` + "\n" +
+		`{"severity":"INFO","message":"two","seq":2,"field_seq":"mine"}` + "\n" +
+		`{"severity":"INFO","message":"none"}` + "\n" +
+		`{"severity":"INFO","message":"restarted","seq":1}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithSequenceNumbersPerProcess(t *testing.T) {
+	var buf bytes.Buffer
+	a := New(INFO).WithSequenceNumbers(SequencePerProcess)
+	b := New(INFO).WithSequenceNumbers(SequencePerProcess)
+	a.out, b.out = &buf, &buf
+	first := processSequence.Load()
+	a.Print("a")
+	b.Print("b")
+	if got := processSequence.Load() - first; got != 2 {
+		t.Errorf("two entries advanced the process sequence by %d", got)
+	}
+	var entries [2]struct{ Seq uint64 }
+	for i, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if err := json.Unmarshal([]byte(line), &entries[i]); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+	}
+	if entries[1].Seq != entries[0].Seq+1 {
+		t.Errorf("entries from different Loggers have sequence numbers %d and %d, want consecutive numbers", entries[0].Seq, entries[1].Seq)
+	}
+}
+
+func TestWithSequenceNumbersConcurrent(t *testing.T) {
+	const goroutines, perGoroutine = 20, 50
+	var buf syncBuffer
+	logger := New(INFO).WithSequenceNumbers()
+	logger.out = &buf
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			derived := logger.With("goroutine", i)
+			for j := 0; j < perGoroutine; j++ {
+				derived.Print("hammer")
+			}
+		}(i)
+	}
+	wg.Wait()
+	const n = goroutines * perGoroutine
+	seen := make([]bool, n+1)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != n {
+		t.Fatalf("got %d entries, want %d", len(lines), n)
+	}
+	for _, line := range lines {
+		var entry struct{ Seq int }
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		if entry.Seq < 1 || entry.Seq > n || seen[entry.Seq] {
+			t.Fatalf("sequence number %d is out of range or repeated", entry.Seq)
+		}
+		seen[entry.Seq] = true
+	}
+}
@@ -0,0 +1,69 @@
+package gcplog
+
+import (
+	"log/slog"
+)
+
+// The slog package only defines DEBUG, INFO, WARN and ERROR, so the remaining GCP severities are placed
+// at the conventional offsets between and above them. TRACE sits half a step below DEBUG, and DEFAULT a whole step below.
+const (
+	slogLevelDefault   slog.Level = slog.LevelDebug - 4
+	slogLevelTrace     slog.Level = slog.LevelDebug - 2
+	slogLevelNotice    slog.Level = slog.LevelInfo + 2
+	slogLevelCritical  slog.Level = slog.LevelError + 4
+	slogLevelAlert     slog.Level = slog.LevelError + 8
+	slogLevelEmergency slog.Level = slog.LevelError + 12
+)
+
+// SeverityFromSlogLevel returns the GCP severity for the provided slog.Level.
+// Levels that fall between two GCP severities are rounded down, so slog.LevelWarn+1 is reported as WARNING.
+// Anything below slog.LevelDebug-2, which is TRACE, is reported as DEFAULT.
+func SeverityFromSlogLevel(l slog.Level) string {
+	switch {
+	case l >= slogLevelEmergency:
+		return EMERGENCY
+	case l >= slogLevelAlert:
+		return ALERT
+	case l >= slogLevelCritical:
+		return CRITICAL
+	case l >= slog.LevelError:
+		return ERROR
+	case l >= slog.LevelWarn:
+		return WARNING
+	case l >= slogLevelNotice:
+		return NOTICE
+	case l >= slog.LevelInfo:
+		return INFO
+	case l >= slog.LevelDebug:
+		return DEBUG
+	case l >= slogLevelTrace:
+		return TRACE
+	}
+	return DEFAULT
+}
+
+// SlogLevel returns the slog.Level for the provided GCP severity, so that SeverityFromSlogLevel(SlogLevel(s)) == s.
+// The severity is matched case-insensitively. An invalid severity is treated as DEFAULT.
+func SlogLevel(severity string) slog.Level {
+	switch canonicalSeverity(severity) {
+	case TRACE:
+		return slogLevelTrace
+	case DEBUG:
+		return slog.LevelDebug
+	case INFO:
+		return slog.LevelInfo
+	case NOTICE:
+		return slogLevelNotice
+	case WARNING:
+		return slog.LevelWarn
+	case ERROR:
+		return slog.LevelError
+	case CRITICAL:
+		return slogLevelCritical
+	case ALERT:
+		return slogLevelAlert
+	case EMERGENCY:
+		return slogLevelEmergency
+	}
+	return slogLevelDefault
+}
@@ -0,0 +1,75 @@
+package gcplog
+
+import (
+	"log/slog"
+	"math"
+	"testing"
+)
+
+func TestSlogLevelRoundTrip(t *testing.T) {
+	for _, sev := range severityAll {
+		if got := SeverityFromSlogLevel(SlogLevel(sev)); got != sev {
+			t.Errorf("SeverityFromSlogLevel(SlogLevel(%q)) = %q", sev, got)
+		}
+	}
+}
+
+func TestSlogLevel(t *testing.T) {
+	tests := []struct {
+		severity string
+		want     slog.Level
+	}{
+		{DEFAULT, slog.LevelDebug - 4},
+		{TRACE, slog.LevelDebug - 2},
+		{"trace", slog.LevelDebug - 2},
+		{DEBUG, slog.LevelDebug},
+		{INFO, slog.LevelInfo},
+		{NOTICE, slog.LevelInfo + 2},
+		{WARNING, slog.LevelWarn},
+		{ERROR, slog.LevelError},
+		{CRITICAL, slog.LevelError + 4},
+		{ALERT, slog.LevelError + 8},
+		{EMERGENCY, slog.LevelError + 12},
+		{"warning", slog.LevelWarn},
+		{"", slog.LevelDebug - 4},
+		{"BOGUS", slog.LevelDebug - 4},
+	}
+	for _, tt := range tests {
+		if got := SlogLevel(tt.severity); got != tt.want {
+			t.Errorf("SlogLevel(%q) = %v, want %v", tt.severity, got, tt.want)
+		}
+	}
+}
+
+func TestSeverityFromSlogLevel(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  string
+	}{
+		{slog.Level(math.MinInt), DEFAULT},
+		{slog.LevelDebug - 5, DEFAULT},
+		{slog.LevelDebug - 3, DEFAULT},
+		{slog.LevelDebug - 2, TRACE},
+		{slog.LevelDebug - 1, TRACE},
+		{slog.LevelDebug, DEBUG},
+		{slog.LevelDebug + 1, DEBUG},
+		{slog.LevelInfo, INFO},
+		{slog.LevelInfo + 1, INFO},
+		{slog.LevelInfo + 2, NOTICE},
+		{slog.LevelInfo + 3, NOTICE},
+		{slog.LevelWarn, WARNING},
+		{slog.LevelWarn + 1, WARNING},
+		{slog.LevelError, ERROR},
+		{slog.LevelError + 3, ERROR},
+		{slog.LevelError + 4, CRITICAL},
+		{slog.LevelError + 8, ALERT},
+		{slog.LevelError + 12, EMERGENCY},
+		{slog.LevelError + 100, EMERGENCY},
+		{slog.Level(math.MaxInt), EMERGENCY},
+	}
+	for _, tt := range tests {
+		if got := SeverityFromSlogLevel(tt.level); got != tt.want {
+			t.Errorf("SeverityFromSlogLevel(%v) = %q, want %q", tt.level, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package gcplog
+
+import (
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// outputCallDepth is the number of stack frames between callerSource, when it's called by output, and the user's code.
+const outputCallDepth = 3
+
+// sourceLocation is the location in the source code that a log entry was written from, in the format Cloud Logging expects.
+// The file is package-relative: the import path of the package followed by the name of the file, like "example.com/app/orders/save.go",
+// so it doesn't depend on where the code was built.
+type sourceLocation struct {
+	File     string `json:"file"`
+	Line     string `json:"line"`
+	Function string `json:"function"`
+}
+
+// WithSourceLocation returns a new Logger which adds the source code location of the call to every log entry at or above
+// the provided severity, which Cloud Logging links back to the code. Finding the location has a cost, so when this is off,
+// which is the default, it isn't looked up at all. If the provided severity is not valid, then source locations are turned off.
+// The original Logger is not changed.
+func (l *Logger) WithSourceLocation(minSeverity string) *Logger {
+	c := l.clone()
+	c.sourceMin = ""
+	if isValidSeverity(minSeverity) {
+		c.sourceMin = canonicalSeverity(minSeverity)
+	}
+	return c
+}
+
+// CallerFormat controls how WithCallerPrefix writes the source location at the start of log messages.
+type CallerFormat int
+
+const (
+	CallerOff   CallerFormat = iota // No prefix, which is the default
+	CallerShort                     // The package name, file name and line number, like "orders/save.go:123: "
+	CallerLong                      // The package import path, file name and line number, like "example.com/app/orders/save.go:123: "
+)
+
+// WithCallerPrefix returns a new Logger which starts every log message with the source code location of the call,
+// in the provided format, like the Lshortfile and Llongfile flags of the standard library's log package. It's for
+// log consumers which only read the message text. The structured source location is set separately, by WithSourceLocation.
+//
+// The prefix comes first, before the severity prefix added by PrefixPrint, for example "orders/save.go:123: WARNING: disk full",
+// and before the message is sanitized (see SetSanitize), but after it's trimmed. Frames skipped by WithCallerSkip and Output are skipped here too.
+// If the location can't be found, then the message is left as it is. The original Logger is not changed.
+func (l *Logger) WithCallerPrefix(f CallerFormat) *Logger {
+	c := l.clone()
+	c.callerPrefix = f
+	return c
+}
+
+// prefix returns the message with the source location s at the start, in the format f.
+func (f CallerFormat) prefix(s *sourceLocation, msg string) string {
+	if s == nil || f == CallerOff {
+		return msg
+	}
+	file := s.File
+	if f == CallerShort {
+		file = path.Base(path.Dir(file)) + "/" + path.Base(file)
+	}
+	return file + ":" + s.Line + ": " + msg
+}
+
+// WithCallerSkip returns a new Logger which skips n more stack frames when finding the source location of an entry,
+// so packages which wrap a Logger can report the location of their caller, rather than of the wrapper. For example:
+//
+//	func (o *Obs) Warn(msg string) { o.logger.WithCallerSkip(1).PrintAt(gcplog.WARNING, msg) }
+//
+// Skips add up, so a wrapper of a wrapper calls WithCallerSkip(1) on the Logger it's given, which already skips one frame.
+// The total is never less than zero. The original Logger is not changed.
+func (l *Logger) WithCallerSkip(n int) *Logger {
+	c := l.clone()
+	c.callerSkip = max(c.callerSkip+n, 0)
+	return c
+}
+
+// Output writes a log message with the provided severity, or the severity of the Logger if it's not valid, for wrappers
+// which need control over the source location. It follows the contract of Output in the standard library's log package:
+// calldepth is the number of stack frames to skip when finding the source location, where 1 is the caller of Output.
+// It's added to any frames skipped by WithCallerSkip. The message isn't formatted. It returns any error from writing the entry.
+func (l *Logger) Output(calldepth int, severity, msg string) error {
+	return l.output(record{severity: severity, message: msg, skip: max(calldepth-1, 0)})
+}
+
+// callerSource returns the source location of the function skip frames above the caller of callerSource,
+// or nil if it can't be found.
+func callerSource(skip int) *sourceLocation {
+	pc, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return nil
+	}
+	s := &sourceLocation{File: file, Line: strconv.Itoa(line)}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		s.Function = fn.Name()
+		if pkg := packagePath(s.Function); pkg != "" {
+			s.File = pkg + "/" + path.Base(file)
+		}
+	}
+	return s
+}
+
+// packagePath returns the import path of the package of the function with the provided fully qualified name,
+// like "example.com/app/orders" for "example.com/app/orders.(*Store).Save.func1", or "" if it can't be found.
+func packagePath(function string) string {
+	if i := strings.IndexByte(function, '['); i >= 0 {
+		function = function[:i] // type arguments can contain other import paths
+	}
+	slash := strings.LastIndexByte(function, '/') + 1
+	dot := strings.IndexByte(function[slash:], '.')
+	if dot <= 0 {
+		return ""
+	}
+	return strings.ReplaceAll(function[:slash+dot], "%2e", ".") // the runtime escapes dots in the last element of the import path
+}
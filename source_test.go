@@ -0,0 +1,214 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWithSourceLocation(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithSourceLocation(WARNING)
+	logger.out = &buf
+	logger.Print("below")
+	logger.PrintAt(ERROR, "above")
+	logger.WithSourceLocation("").PrintAt(ERROR, "off")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("wrote %d lines, want 3", len(lines))
+	}
+	for i, line := range lines {
+		var e map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		_, ok := e[sourceLocationKey]
+		if want := i == 1; ok != want {
+			t.Errorf("entry %s has source location %v, want %v", line, ok, want)
+		}
+	}
+	var e struct {
+		Source sourceLocation `json:"logging.googleapis.com/sourceLocation"`
+	}
+	_ = json.Unmarshal([]byte(lines[1]), &e)
+	if e.Source.File != "github.com/tinyinput/gcplog/source_test.go" || e.Source.Function != "github.com/tinyinput/gcplog.TestWithSourceLocation" || e.Source.Line == "" {
+		t.Errorf("source location = %+v, want this test", e.Source)
+	}
+}
+
+// callerLine returns the line number it was called from.
+func callerLine() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line
+}
+
+func TestSourceLocationLine(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithSourceLocation(DEFAULT)
+	logger.out = &buf
+	var want []int
+	logger.Print("Print")
+	want = append(want, callerLine()-1)
+	logger.Printf("%s", "Printf")
+	want = append(want, callerLine()-1)
+	logger.Printw("Printw", "k", 1)
+	want = append(want, callerLine()-1)
+	logger.PrintFields("PrintFields", Int("k", 1))
+	want = append(want, callerLine()-1)
+	logger.Log(ERROR, "Log")
+	want = append(want, callerLine()-1)
+	logger.At(WARNING).Print("At")
+	want = append(want, callerLine()-1)
+	logger.PrintJSON("PrintJSON", map[string]int{"k": 1})
+	want = append(want, callerLine()-1)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("wrote %d lines, want %d", len(lines), len(want))
+	}
+	for i, line := range lines {
+		var e struct {
+			Message string
+			Source  sourceLocation `json:"logging.googleapis.com/sourceLocation"`
+		}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		if e.Source.Line != strconv.Itoa(want[i]) || e.Source.Function != "github.com/tinyinput/gcplog.TestSourceLocationLine" {
+			t.Errorf("%s: source location = %+v, want line %d of this test", e.Message, e.Source, want[i])
+		}
+	}
+}
+
+// obs wraps a Logger, like a package which adds its own logging API. Warn skips its own frame with WithCallerSkip,
+// and Output with the calldepth of Output.
+type obs struct{ logger, skipped *Logger }
+
+func newObs(l *Logger) *obs { return &obs{logger: l, skipped: l.WithCallerSkip(1)} }
+
+func (o *obs) Warn(msg string) { o.skipped.PrintAt(WARNING, msg) }
+
+func (o *obs) Output(msg string) error { return o.logger.Output(2, ERROR, msg) }
+
+// team wraps obs, so entries it writes go through two wrappers.
+type team struct{ obs *obs }
+
+func newTeam(l *Logger) *team { return &team{obs: newObs(l.WithCallerSkip(1))} }
+
+func (t *team) Warn(msg string) { t.obs.Warn(msg) }
+
+func (t *team) Output(msg string) error { return t.obs.Output(msg) }
+
+func TestWithCallerSkip(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithSourceLocation(DEFAULT)
+	logger.out = &buf
+	var want []int
+	newObs(logger).Warn("one wrapper")
+	want = append(want, callerLine()-1)
+	newTeam(logger).Warn("two wrappers")
+	want = append(want, callerLine()-1)
+	_ = newTeam(logger).Output("two wrappers with Output")
+	want = append(want, callerLine()-1)
+	_ = logger.Output(1, NOTICE, "Output")
+	want = append(want, callerLine()-1)
+	logger.WithCallerSkip(1).WithCallerSkip(-5).Print("negative")
+	want = append(want, callerLine()-1)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("wrote %d lines, want %d", len(lines), len(want))
+	}
+	for i, line := range lines {
+		var e struct {
+			Message string
+			Source  sourceLocation `json:"logging.googleapis.com/sourceLocation"`
+		}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		if e.Source.Line != strconv.Itoa(want[i]) || e.Source.Function != "github.com/tinyinput/gcplog.TestWithCallerSkip" {
+			t.Errorf("%s: source location = %+v, want line %d of this test", e.Message, e.Source, want[i])
+		}
+	}
+}
+
+func TestWithCallerPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(WARNING).With("k", 1)
+	logger.out = &buf
+	logger.WithCallerPrefix(CallerShort).Print("  short  ")
+	short := callerLine() - 1
+	logger.WithCallerPrefix(CallerLong).PrefixPrint("long")
+	long := callerLine() - 1
+	newObs(logger.WithCallerPrefix(CallerShort)).Warn("wrapped")
+	wrapped := callerLine() - 1
+	logger.WithCallerPrefix(CallerShort).WithCallerPrefix(CallerOff).Print("off")
+	want := fmt.Sprintf(`{"severity":"WARNING","message":"gcplog/source_test.go:%d: short","k":1}`+"\n"+
+		`{"severity":"WARNING","message":"github.com/tinyinput/gcplog/source_test.go:%d: WARNING: long","k":1}`+"\n"+
+		`{"severity":"WARNING","message":"gcplog/source_test.go:%d: wrapped","k":1}`+"\n"+
+		`{"severity":"WARNING","message":"off","k":1}`+"\n", short, long, wrapped)
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	if err := logger.Output(1, "warn", "%d not formatted"); err != nil {
+		t.Errorf("Output() = %v", err)
+	}
+	_ = logger.Output(1, "BOGUS", "default severity")
+	want := `{"severity":"WARNING","message":"%d not formatted"}` + "\n" +
+		`{"severity":"INFO","message":"default severity"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	logger.out = errWriter{io.ErrClosedPipe}
+	if err := logger.Output(1, ERROR, "failed"); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Output() = %v, want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestPackagePath(t *testing.T) {
+	tests := []struct {
+		function, want string
+	}{
+		{"github.com/tinyinput/gcplog.TestPackagePath", "github.com/tinyinput/gcplog"},
+		{"example.com/app/orders.(*Store).Save.func1", "example.com/app/orders"},
+		{"example.com/app/go%2elib.Map[...]", "example.com/app/go.lib"},
+		{"example.com/app.Map[example.com/other.T]", "example.com/app"},
+		{"main.main", "main"},
+		{"nodot", ""},
+	}
+	for _, tt := range tests {
+		if got := packagePath(tt.function); got != tt.want {
+			t.Errorf("packagePath(%q) = %q, want %q", tt.function, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkSourceLocation(b *testing.B) {
+	b.Run("disabled", func(b *testing.B) {
+		logger := New(ERROR)
+		logger.out = io.Discard
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			logger.Print("Hello World")
+		}
+	})
+	b.Run("enabled", func(b *testing.B) {
+		logger := New(ERROR).WithSourceLocation(DEFAULT)
+		logger.out = io.Discard
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			logger.Print("Hello World")
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package gcplog
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// stackTraceKey is the key the stack trace added by WithStackTraces is written with, which Error Reporting recognizes.
+const stackTraceKey = "stack_trace"
+
+// WithStackTraces returns a new Logger which adds a "stack_trace" field to every log entry at or above the provided severity,
+// holding the stack of the goroutine which wrote it, from the call to the Logger down, in the format of a Go panic.
+// Error Reporting groups entries with stack traces into errors. Frames skipped by WithCallerSkip and Output are left out too,
+// as are the frames of gcplog itself and of the runtime. The stack is only captured for entries at or above the severity.
+//
+// If maxFrames is provided and above zero, then stack traces have at most that many frames, including those of ReportError,
+// and a line saying that frames were elided is written in place of the rest. Otherwise there's no limit.
+// Stack traces are slow to capture, so this is off by default. If the provided severity is not valid, then stack traces
+// are turned off. The original Logger is not changed.
+func (l *Logger) WithStackTraces(minSeverity string, maxFrames ...int) *Logger {
+	c := l.clone()
+	c.stackMin = ""
+	if isValidSeverity(minSeverity) {
+		c.stackMin = canonicalSeverity(minSeverity)
+	}
+	if len(maxFrames) > 0 {
+		c.stackFrames = max(maxFrames[len(maxFrames)-1], 0)
+	}
+	return c
+}
+
+// LogError writes the provided error as a log message at ERROR severity, with a stack trace if WithStackTraces is on for ERROR,
+// for the common case of reporting an error which can't be handled. A nil error writes nothing. It's a shortcut for
+//
+//	logger.At(gcplog.ERROR).Print(err)
+//
+// so the same entry can be written at a different severity, or with other fields, by calling those methods.
+func (l *Logger) LogError(err error) {
+	if err == nil {
+		return
+	}
+	l.output(record{severity: ERROR}, err)
+}
+
+// elidedFrames is the line written in place of the frames left out of a stack trace by WithStackTraces, as a Go panic writes it.
+const elidedFrames = "...additional frames elided..."
+
+// callerStack returns the stack of the current goroutine in the format of a Go panic, without the frames of callerStack
+// and the skip frames above it, so callerStack(0, 0) starts with the caller of callerStack. Each frame is written as
+//
+//	example.com/app.Save(...)
+//		/src/app/save.go:42
+//
+// without the arguments and program counter offsets a panic has, which aren't known. If maxFrames is above zero,
+// then at most that many frames are written. Frames of the runtime, like runtime.main, are left out, as a panic does.
+func callerStack(skip, maxFrames int) string {
+	pcs := make([]uintptr, 32)
+	if maxFrames > 0 {
+		pcs = make([]uintptr, maxFrames+1) // inlined calls only add frames, so one more is enough to know some were left out
+	}
+	n := runtime.Callers(skip+2, pcs) // runtime.Callers and callerStack itself are always skipped
+	for n == len(pcs) && maxFrames <= 0 {
+		pcs = make([]uintptr, 2*len(pcs))
+		n = runtime.Callers(skip+2, pcs)
+	}
+	b := []byte(currentGoroutine())
+	frames := runtime.CallersFrames(pcs[:n])
+	for written := 0; ; {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") {
+			if maxFrames > 0 && written == maxFrames {
+				b = append(b, "\n"+elidedFrames...)
+				break
+			}
+			b = append(b, '\n')
+			b = append(b, f.Function...)
+			b = append(b, "(...)\n\t"...)
+			b = append(b, f.File...)
+			b = append(b, ':')
+			b = strconv.AppendInt(b, int64(f.Line), 10)
+			written++
+		}
+		if !more {
+			break
+		}
+	}
+	return string(b)
+}
+
+// currentGoroutine returns the line a Go panic starts the stack of the current goroutine with, like "goroutine 7 [running]:",
+// which Error Reporting needs to recognize the stack trace.
+func currentGoroutine() string {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// reportedErrorKey is the key of the field which WithReportedErrors adds, holding reportedErrorType.
+const reportedErrorKey = "@type"
+
+// reportedErrorType marks an entry as an error event for Error Reporting.
+const reportedErrorType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+// WithReportedErrors returns a new Logger which adds the field
+//
+//	"@type": "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+//
+// to every log entry at ERROR or above, so Error Reporting treats it as an error, even if it has no stack trace.
+// Entries below ERROR, after any severity remapping, are written as normal. The original Logger is not changed.
+func (l *Logger) WithReportedErrors() *Logger {
+	c := l.clone()
+	c.reportErrors = true
+	return c
+}
+
+// serviceContextKey is the key Error Reporting reads the service an error comes from with.
+const serviceContextKey = "serviceContext"
+
+// serviceContext is the service, and its version, that reported errors come from.
+type serviceContext struct {
+	service string // the name of the service, or "" when there's no service context
+	version string
+	auto    bool // whether it was found by WithAutoServiceContext, rather than set by WithServiceContext
+}
+
+// WithServiceContext returns a new Logger which adds a "serviceContext" field, naming the service and its version, to every entry
+// marked for Error Reporting, so Error Reporting can group and filter errors by service. That's entries written by ReportError,
+// and, with WithReportedErrors, every entry at ERROR or above. ReadBuildInfo can provide the version.
+// An empty version is left out, and an empty service removes the service context. It takes precedence over
+// WithAutoServiceContext, whichever is called first. The original Logger is not changed.
+func (l *Logger) WithServiceContext(service, version string) *Logger {
+	c := l.clone()
+	c.service = serviceContext{service: service, version: version}
+	if service == "" {
+		c.service = serviceContext{}
+	}
+	return c
+}
+
+// WithAutoServiceContext returns a new Logger which adds the service context described by WithServiceContext, found from
+// the environment it's running in. The service is the first of the K_SERVICE (Cloud Run), GAE_SERVICE (App Engine) and
+// FUNCTION_TARGET (Cloud Functions) environment variables which is set, and the version is the first of K_REVISION and GAE_VERSION,
+// or else the version, or revision, from ReadBuildInfo. If no service is found, then there's no service context.
+//
+// The environment is read once, when WithAutoServiceContext is called. A service context set by WithServiceContext
+// is kept instead. The original Logger is not changed.
+func (l *Logger) WithAutoServiceContext() *Logger {
+	c := l.clone()
+	if c.service.service != "" && !c.service.auto {
+		return c
+	}
+	c.service = serviceContext{service: firstEnv("K_SERVICE", "GAE_SERVICE", "FUNCTION_TARGET"), auto: true}
+	if c.service.service == "" {
+		c.service = serviceContext{}
+		return c
+	}
+	c.service.version = firstEnv("K_REVISION", "GAE_VERSION")
+	if c.service.version == "" {
+		b := ReadBuildInfo()
+		c.service.version = orDefault(b.Version, b.Revision)
+	}
+	return c
+}
+
+// firstEnv returns the value of the first of the provided environment variables which isn't empty, or "" if they all are.
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// appendJSON appends the service context to b as a JSON object member, if there is a service.
+func (s serviceContext) appendJSON(b []byte) []byte {
+	if s.service == "" {
+		return b
+	}
+	b = append(b, `,"`+serviceContextKey+`":{"service":`...)
+	b = appendJSONString(b, s.service)
+	if s.version != "" {
+		b = append(b, `,"version":`...)
+		b = appendJSONString(b, s.version)
+	}
+	return append(b, '}')
+}
+
+// ReportError writes the provided error as an error event for Error Reporting, at ERROR severity, or the severity of the Logger
+// if that's more severe, so logger.At(gcplog.CRITICAL).ReportError(err) writes a CRITICAL entry. The entry is marked with the
+// "@type" field described by WithReportedErrors, and has the service context set by WithServiceContext. No API client is needed,
+// as Error Reporting reads the entry from Cloud Logging.
+//
+// The message is the error's message, and a "stack_trace" field holds the message, a blank line and then the stack of the
+// goroutine which called ReportError, in the format of a Go panic, which Error Reporting parses:
+//
+//	connection refused
+//
+//	goroutine 1 [running]:
+//	main.placeOrder(...)
+//		/app/main.go:42
+//	main.main(...)
+//		/app/main.go:17
+//
+// Arguments are written as "...", and program counter offsets are left out, as Error Reporting doesn't need them.
+// A nil error writes nothing.
+func (l *Logger) ReportError(err error) {
+	if err == nil {
+		return
+	}
+	l.output(record{severity: l.reportSeverity(), report: true}, err)
+}
+
+// ReportErrorf is the same as ReportError, but uses the same format as fmt.Printf to write the message.
+func (l *Logger) ReportErrorf(format string, v ...any) {
+	l.output(record{severity: l.reportSeverity(), message: format, printf: true, report: true}, v...)
+}
+
+// reportSeverity returns the severity ReportError writes entries at, which is ERROR or the severity of the Logger, if that's more severe.
+func (l *Logger) reportSeverity() string {
+	if s := l.Severity(); SeverityAtLeast(s, ERROR) {
+		return s
+	}
+	return ERROR
+}
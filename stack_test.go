@@ -0,0 +1,286 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+// errNilPointer is an error whose Error method panics when called on a nil pointer.
+type errNilPointer struct{ msg string }
+
+func (e *errNilPointer) Error() string { return e.msg }
+
+func TestLogError(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).With("order", 7)
+	logger.out = &buf
+	logger.LogError(errors.New("save failed"))
+	logger.LogError(nil)
+	var typedNil *errNilPointer
+	logger.LogError(typedNil)
+	want := `{"severity":"ERROR","message":"save failed","order":7}` + "\n" +
+		`{"severity":"ERROR","message":"\u003cnil\u003e","order":7}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithStackTraces(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithStackTraces(ERROR)
+	logger.out = &buf
+	logger.LogError(errors.New("save failed"))
+	logger.Print("no stack")
+	newObs(logger).Output("wrapped")
+	logger.WithStackTraces("").PrintAt(CRITICAL, "off")
+	logger.With(stackTraceKey, "mine").PrintAt(ERROR, "reserved")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("wrote %d lines, want 5", len(lines))
+	}
+	for i, line := range lines {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		stack, _ := e[stackTraceKey].(string)
+		if i == 1 || i == 3 {
+			if stack != "" {
+				t.Errorf("%v: has a stack trace", e["message"])
+			}
+			continue
+		}
+		frames := strings.Split(stack, "\n")
+		if len(frames) < 3 || !strings.HasPrefix(frames[0], "goroutine ") || !strings.HasPrefix(frames[1], "github.com/tinyinput/gcplog.TestWithStackTraces(") ||
+			!strings.HasPrefix(frames[2], "\t") || !strings.Contains(frames[2], "stack_test.go:") {
+			t.Errorf("%v: stack trace starts %q, want this test", e["message"], frames[:min(len(frames), 3)])
+		}
+		if i == 4 && e["field_"+stackTraceKey] != "mine" {
+			t.Errorf("field using the stack trace key = %v, want it renamed", e["field_"+stackTraceKey])
+		}
+	}
+}
+
+// nested calls itself depth times before calling fn, to give fn a deeper stack.
+func nested(depth int, fn func()) {
+	if depth == 0 {
+		fn()
+		return
+	}
+	nested(depth-1, fn)
+}
+
+func TestWithStackTracesFrames(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithStackTraces(CRITICAL, 3)
+	logger.out = &buf
+	logger.Print("info")
+	logger.PrintAt(ERROR, "error")
+	nested(10, func() { logger.PrintAt(CRITICAL, "capped") })
+	nested(10, func() { logger.ReportError(errors.New("reported")) })
+	nested(10, func() { logger.WithStackTraces(CRITICAL, 0).PrintAt(CRITICAL, "uncapped") })
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("wrote %d lines, want 5:\n%s", len(lines), buf.String())
+	}
+	for i, line := range lines {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		stack, _ := e[stackTraceKey].(string)
+		if i < 2 {
+			if _, ok := e[stackTraceKey]; ok {
+				t.Errorf("%v: has a stack trace", e["message"])
+			}
+			continue
+		}
+		if i == 3 {
+			stack = strings.TrimPrefix(stack, "reported\n\n")
+		}
+		frames := strings.Split(stack, "\n")
+		if !goroutineHeader.MatchString(frames[0]) || len(frames) < 3 || !strings.HasPrefix(frames[1], "github.com/tinyinput/gcplog.TestWithStackTracesFrames.func") {
+			t.Errorf("%v: stack trace starts %q, want this test", e["message"], frames[:min(len(frames), 3)])
+			continue
+		}
+		capped := i < 4
+		if elided := frames[len(frames)-1] == elidedFrames; elided != capped {
+			t.Errorf("%v: last line %q, want elided %v", e["message"], frames[len(frames)-1], capped)
+		}
+		if capped && len(frames) != 1+2*3+1 {
+			t.Errorf("%v: %d lines, want 3 frames:\n%s", e["message"], len(frames), stack)
+		}
+		if !capped && strings.Count(stack, "gcplog.nested(...)") != 11 {
+			t.Errorf("%v: want every frame:\n%s", e["message"], stack)
+		}
+		for j := 1; j+1 < len(frames); j += 2 {
+			if strings.HasPrefix(frames[j], "github.com/tinyinput/gcplog.(*Logger)") || strings.HasPrefix(frames[j], "runtime.") ||
+				!strings.HasSuffix(frames[j], "(...)") || !strings.HasPrefix(frames[j+1], "\t") {
+				t.Errorf("%v: unexpected frame %q %q", e["message"], frames[j], frames[j+1])
+			}
+		}
+	}
+}
+
+func TestWithReportedErrors(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithReportedErrors().With("@type", "mine")
+	logger.out = &buf
+	logger.Print("info")
+	logger.LogError(errors.New("failed"))
+	logger.PrintAt(CRITICAL, "critical")
+	logger.WithSeverityRemap(map[string]string{WARNING: ERROR}).PrintAt(WARNING, "remapped")
+	typ := `"@type":"type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"`
+	want := `{"severity":"INFO","message":"info","@type":"mine"}` + "\n" +
+		`{"severity":"ERROR","message":"failed","field_@type":"mine",` + typ + `}` + "\n" +
+		`{"severity":"CRITICAL","message":"critical","field_@type":"mine",` + typ + `}` + "\n" +
+		`{"severity":"ERROR","message":"remapped","field_@type":"mine",` + typ + `}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := string(logger.AppendEntry(nil, ERROR, "appended")); !strings.HasSuffix(got, typ+"}") {
+		t.Errorf("AppendEntry() = %s, want %s", got, typ)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).With("order", 7)
+	logger.out = &buf
+	logger.ReportError(errors.New("save failed"))
+	logger.WithServiceContext("orders", "v1.2.3").At(CRITICAL).ReportErrorf("lost %d orders", 3)
+	logger.WithServiceContext("orders", "").WithReportedErrors().PrintAt(ERROR, "marked")
+	logger.WithServiceContext("orders", "v1").Print("not reported")
+	logger.ReportError(nil)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("wrote %d lines, want 4:\n%s", len(lines), buf.String())
+	}
+	tests := []struct {
+		severity, message string
+		service           any
+		stack             bool
+	}{
+		{ERROR, "save failed", nil, true},
+		{CRITICAL, "lost 3 orders", map[string]any{"service": "orders", "version": "v1.2.3"}, true},
+		{ERROR, "marked", map[string]any{"service": "orders"}, false},
+		{INFO, "not reported", nil, false},
+	}
+	for i, tt := range tests {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(lines[i]), &e); err != nil {
+			t.Fatalf("invalid JSON %q: %v", lines[i], err)
+		}
+		if e["severity"] != tt.severity || e["message"] != tt.message || e["order"] != float64(7) {
+			t.Errorf("entry %d = %s", i, lines[i])
+		}
+		if reported := e[reportedErrorKey] == reportedErrorType; reported != (i < 3) {
+			t.Errorf("%v: %q = %v", tt.message, reportedErrorKey, e[reportedErrorKey])
+		}
+		if got, _ := json.Marshal(e[serviceContextKey]); string(got) != mustMarshal(t, tt.service) {
+			t.Errorf("%v: serviceContext = %s, want %s", tt.message, got, mustMarshal(t, tt.service))
+		}
+		stack, _ := e[stackTraceKey].(string)
+		if !tt.stack {
+			if stack != "" {
+				t.Errorf("%v: has a stack trace", tt.message)
+			}
+			continue
+		}
+		// Error Reporting's Go parser expects the panic layout: the message, a blank line, then the goroutine header and frames.
+		frames := strings.Split(stack, "\n")
+		if len(frames) < 5 || frames[0] != tt.message || frames[1] != "" || !goroutineHeader.MatchString(frames[2]) ||
+			!strings.HasPrefix(frames[3], "github.com/tinyinput/gcplog.TestReportError(") ||
+			!strings.HasPrefix(frames[4], "\t") || !strings.Contains(frames[4], "stack_test.go:") {
+			t.Errorf("%v: stack trace starts %q, want the message and this test", tt.message, frames[:min(len(frames), 5)])
+		}
+	}
+}
+
+// goroutineHeader matches the first line of a Go stack trace, as Error Reporting parses it.
+var goroutineHeader = regexp.MustCompile(`^goroutine \d+ \[running\]:$`)
+
+// mustMarshal returns the JSON encoding of v.
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestWithAutoServiceContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		version string // the version in the build information
+		want    string
+	}{
+		{"none", nil, "", ``},
+		{"none with build info", nil, "v1.0.0", ``},
+		{"cloud run", map[string]string{"K_SERVICE": "orders", "K_REVISION": "orders-00042"}, "v1.0.0",
+			`,"serviceContext":{"service":"orders","version":"orders-00042"}`},
+		{"app engine", map[string]string{"GAE_SERVICE": "default", "GAE_VERSION": "20240501t120000"}, "",
+			`,"serviceContext":{"service":"default","version":"20240501t120000"}`},
+		{"cloud functions", map[string]string{"FUNCTION_TARGET": "HandleOrder"}, "v1.0.0",
+			`,"serviceContext":{"service":"HandleOrder","version":"v1.0.0"}`},
+		{"no version", map[string]string{"FUNCTION_TARGET": "HandleOrder"}, "",
+			`,"serviceContext":{"service":"HandleOrder"}`},
+		{"cloud run first", map[string]string{"K_SERVICE": "orders", "GAE_SERVICE": "default", "FUNCTION_TARGET": "f", "GAE_VERSION": "7"}, "",
+			`,"serviceContext":{"service":"orders","version":"7"}`},
+		{"version without service", map[string]string{"K_REVISION": "orders-00042"}, "v1.0.0", ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"K_SERVICE", "GAE_SERVICE", "FUNCTION_TARGET", "K_REVISION", "GAE_VERSION"} {
+				t.Setenv(k, tt.env[k])
+			}
+			fakeBuildInfo(t, &debug.BuildInfo{Main: debug.Module{Version: orDefault(tt.version, "(devel)")}})
+			var buf bytes.Buffer
+			logger := New(INFO).WithAutoServiceContext()
+			logger.out = &buf
+			logger.ReportErrorf("failed")
+			var e map[string]json.RawMessage
+			if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+				t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+			}
+			got := ""
+			if sc, ok := e[serviceContextKey]; ok {
+				got = `,"` + serviceContextKey + `":` + string(sc)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithServiceContextPrecedence(t *testing.T) {
+	t.Setenv("K_SERVICE", "detected")
+	t.Setenv("K_REVISION", "detected-1")
+	var buf bytes.Buffer
+	logger := New(ERROR).WithReportedErrors()
+	logger.out = &buf
+	logger.WithServiceContext("explicit", "v2").WithAutoServiceContext().Print("explicit first")
+	logger.WithAutoServiceContext().WithServiceContext("explicit", "").Print("explicit last")
+	logger.WithAutoServiceContext().Print("auto")
+	logger.WithAutoServiceContext().WithServiceContext("", "").Print("removed")
+	logger.WithServiceContext("explicit", "v2").Print("errors")
+	logger.WithServiceContext("explicit", "v2").At(WARNING).Print("warning")
+	typ := `,"@type":"` + reportedErrorType + `"`
+	want := `{"severity":"ERROR","message":"explicit first"` + typ + `,"serviceContext":{"service":"explicit","version":"v2"}}` + "\n" +
+		`{"severity":"ERROR","message":"explicit last"` + typ + `,"serviceContext":{"service":"explicit"}}` + "\n" +
+		`{"severity":"ERROR","message":"auto"` + typ + `,"serviceContext":{"service":"detected","version":"detected-1"}}` + "\n" +
+		`{"severity":"ERROR","message":"removed"` + typ + `}` + "\n" +
+		`{"severity":"ERROR","message":"errors"` + typ + `,"serviceContext":{"service":"explicit","version":"v2"}}` + "\n" +
+		`{"severity":"WARNING","message":"warning"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
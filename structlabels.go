@@ -0,0 +1,115 @@
+package gcplog
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// labelTag is the struct tag read by LabelsFromStruct.
+const labelTag = "gcplabel"
+
+// maxLabelDepth is how deeply LabelsFromStruct flattens nested structs, which stops a struct which points to itself looping forever.
+const maxLabelDepth = 8
+
+// LabelsFromStruct returns Cloud Logging labels for the fields of the provided struct, or pointer to a struct,
+// ready to be passed to WithLabels. Only exported fields with a "gcplabel" tag are used, for example:
+//
+//	type Request struct {
+//		Tenant string `gcplabel:"tenant"`
+//		Retry  int    `gcplabel:"retry,omitempty"`
+//		Trace  *Trace `gcplabel:"trace"`
+//		Secret string
+//	}
+//
+// The tag gives the label key, and the value is formatted with fmt.Sprint. A tag of "-" skips the field, as does an empty key.
+// With the omitempty option, the field is skipped when it holds the zero value for its type.
+// Pointer fields are followed, and skipped when they're nil.
+//
+// Struct fields, other than those which implement fmt.Stringer or error, are flattened: their own tagged fields
+// are added with the key of the struct field and an underscore as a prefix, so the Trace field above could add "trace_id".
+// Embedded structs without a tag are flattened without a prefix. Structs are flattened up to a depth of 8.
+//
+// A nil pointer, or a value which isn't a struct, returns nil.
+func LabelsFromStruct(v any) map[string]string {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	if !rv.CanAddr() {
+		// Copy the struct so it's addressable, and methods with pointer receivers can be used whether or not v was a pointer.
+		p := reflect.New(rv.Type())
+		p.Elem().Set(rv)
+		rv = p.Elem()
+	}
+	labels := make(map[string]string)
+	structLabels(labels, rv, "", 0)
+	return labels
+}
+
+// structLabels adds the labels for the fields of the struct rv to labels, with the provided prefix added to each key.
+func structLabels(labels map[string]string, rv reflect.Value, prefix string, depth int) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, tagged := f.Tag.Lookup(labelTag)
+		if !f.IsExported() {
+			continue
+		}
+		key, opts, _ := strings.Cut(tag, ",")
+		omitEmpty := opts == "omitempty"
+		fv := rv.Field(i)
+		for fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Pointer || (omitEmpty && fv.IsZero()) {
+			continue
+		}
+		if !tagged {
+			if f.Anonymous && fv.Kind() == reflect.Struct && depth+1 < maxLabelDepth {
+				structLabels(labels, fv, prefix, depth+1)
+			}
+			continue
+		}
+		if key == "" || key == "-" {
+			continue
+		}
+		value := formattable(fv)
+		if value == nil {
+			if depth+1 < maxLabelDepth {
+				structLabels(labels, fv, prefix+key+"_", depth+1)
+			}
+			continue
+		}
+		labels[prefix+key] = fmt.Sprint(value)
+	}
+}
+
+// formattable returns the value to format for rv, or nil if rv is a struct which should be flattened instead.
+// A pointer to rv is returned if only the pointer implements fmt.Stringer or error, so its method is used.
+func formattable(rv reflect.Value) any {
+	if rv.CanAddr() {
+		switch p := rv.Addr().Interface().(type) {
+		case fmt.Stringer, error:
+			return p
+		}
+	}
+	v := rv.Interface()
+	switch v.(type) {
+	case fmt.Stringer, error:
+		return v
+	}
+	if rv.Kind() == reflect.Struct {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,99 @@
+package gcplog
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type traceInfo struct {
+	ID      string `gcplabel:"id"`
+	Sampled bool   `gcplabel:"sampled,omitempty"`
+}
+
+type Common struct {
+	Service string `gcplabel:"service"`
+}
+
+type region string
+
+func (r *region) String() string { return "region-" + string(*r) }
+
+type chain struct {
+	Name string `gcplabel:"name"`
+	Next *chain `gcplabel:"next"`
+}
+
+type requestLabels struct {
+	Common
+	Tenant   string        `gcplabel:"tenant"`
+	Retry    int           `gcplabel:"retry,omitempty"`
+	Attempt  int           `gcplabel:"attempt"`
+	Ratio    float64       `gcplabel:"ratio"`
+	Canary   bool          `gcplabel:"canary"`
+	Timeout  time.Duration `gcplabel:"timeout,omitempty"`
+	Trace    traceInfo     `gcplabel:"trace"`
+	Parent   *traceInfo    `gcplabel:"parent"`
+	Missing  *string       `gcplabel:"missing"`
+	Region   region        `gcplabel:"region"`
+	Err      error         `gcplabel:"err,omitempty"`
+	Skipped  string        `gcplabel:"-"`
+	NoKey    string        `gcplabel:",omitempty"`
+	Untagged string
+	secret   string `gcplabel:"secret"`
+}
+
+func TestLabelsFromStruct(t *testing.T) {
+	user := "ann"
+	tests := []struct {
+		name string
+		v    any
+		want map[string]string
+	}{
+		{"nil", nil, nil},
+		{"not a struct", "text", nil},
+		{"nil pointer", (*requestLabels)(nil), nil},
+		{"zero values", requestLabels{}, map[string]string{
+			"service": "", "tenant": "", "attempt": "0", "ratio": "0", "canary": "false", "trace_id": "", "region": "region-",
+		}},
+		{"all tag forms", &requestLabels{
+			Common:   Common{Service: "orders"},
+			Tenant:   "acme",
+			Retry:    2,
+			Ratio:    0.5,
+			Canary:   true,
+			Timeout:  1500 * time.Millisecond,
+			Trace:    traceInfo{ID: "abc", Sampled: true},
+			Parent:   &traceInfo{ID: "def"},
+			Region:   "eu",
+			Err:      errors.New("timed out"),
+			Skipped:  "x",
+			NoKey:    "x",
+			Untagged: "x",
+			secret:   "x",
+		}, map[string]string{
+			"service": "orders", "tenant": "acme", "retry": "2", "attempt": "0", "ratio": "0.5", "canary": "true",
+			"timeout": "1.5s", "trace_id": "abc", "trace_sampled": "true", "parent_id": "def", "region": "region-eu", "err": "timed out",
+		}},
+		{"pointer to scalar", struct {
+			User *string `gcplabel:"user"`
+		}{&user}, map[string]string{"user": "ann"}},
+		{"depth limit", func() *chain {
+			c := &chain{Name: "loop"}
+			c.Next = c
+			return c
+		}(), map[string]string{
+			"name": "loop", "next_name": "loop", "next_next_name": "loop", "next_next_next_name": "loop",
+			"next_next_next_next_name": "loop", "next_next_next_next_next_name": "loop",
+			"next_next_next_next_next_next_name": "loop", "next_next_next_next_next_next_next_name": "loop",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LabelsFromStruct(tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LabelsFromStruct() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
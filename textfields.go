@@ -0,0 +1,123 @@
+package gcplog
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TextFields controls whether structured fields are appended to the message as text, see WithTextFields.
+type TextFields int
+
+const (
+	TextFieldsOff    TextFields = iota // Fields are only written as JSON, which is the default
+	TextFieldsAppend                   // Fields are appended to the message as text, as well as being written as JSON
+	TextFieldsOnly                     // Fields are appended to the message as text, instead of being written as JSON
+)
+
+// WithTextFields returns a new Logger which appends the structured fields of each entry to its message, as logfmt style text,
+// for pipelines which only index the message, like some forwarding to Splunk or Elasticsearch:
+//
+//	logger.WithTextFields().Printw("order saved", "id", 1234, "note", `said "hi"`)
+//	// message: order saved id=1234 note="said \"hi\""
+//
+// Fields are written as key=value, separated by spaces and sorted by key, with the same keys as in the JSON payload, so reserved keys
+// have a "field_" prefix. Values are written as they are in the JSON payload, with strings unquoted, so objects and arrays are written
+// as JSON. A value is quoted, using Go's escaping rules, when it's empty or holds a space, a quote, an equals sign, a backslash or a
+// character which isn't printable. Fields inside groups are written with the group names before their keys, like "http.status=200".
+//
+// With no mode, or TextFieldsAppend, the fields are still written as JSON too. With TextFieldsOnly, they're only written as text,
+// and TextFieldsOff restores the default. If several modes are provided, the last is used. The text is added once the rest of the
+// message is complete, including any severity prefix from PrefixPrint, but before transforms set by SetMessageTransform,
+// and SetMaxMessageBytes applies to the whole message. The original Logger is not changed.
+func (l *Logger) WithTextFields(mode ...TextFields) *Logger {
+	c := l.clone()
+	c.textFields = TextFieldsAppend
+	if len(mode) > 0 {
+		c.textFields = mode[len(mode)-1]
+	}
+	return c
+}
+
+// apply appends the fields of the entry to its message, as described by WithTextFields, removing them from the JSON payload
+// for TextFieldsOnly.
+func (m TextFields) apply(e *entry) {
+	if m == TextFieldsOff || len(e.fields) == 0 {
+		return
+	}
+	e.message = string(appendTextFields([]byte(e.message), "", e.fields, e.isReserved))
+	if m == TextFieldsOnly {
+		e.fields = nil
+	}
+}
+
+// appendTextFields appends each of the fields to b as text, sorted by key, with the prefix before each key.
+// Keys are renamed, or dropped, for reserved in the same way as by appendFields.
+func appendTextFields(b []byte, prefix string, fields map[string]any, reserved func(string) bool) []byte {
+	keys := make([]string, 0, len(fields))
+	var renamed map[string]string // the original key of each renamed field, by its new key
+	for k := range fields {
+		if reserved(k) {
+			if _, ok := fields[reservedPrefix+k]; ok {
+				continue
+			}
+			if renamed == nil {
+				renamed = make(map[string]string)
+			}
+			renamed[reservedPrefix+k] = k
+			k = reservedPrefix + k
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := fields[k]
+		if orig, ok := renamed[k]; ok {
+			v = fields[orig]
+		}
+		if g, ok := v.(group); ok {
+			b = appendTextFields(b, prefix+k+".", g, func(string) bool { return false })
+			continue
+		}
+		if len(b) > 0 {
+			b = append(b, ' ')
+		}
+		b = append(b, textKey(prefix+k)...)
+		b = append(b, '=')
+		b = appendTextValue(b, v)
+	}
+	return b
+}
+
+// textKey returns k with any space, quote, equals sign or character which isn't printable replaced by an underscore,
+// so the key can't be mistaken for part of the value.
+func textKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, k)
+}
+
+// appendTextValue appends v to b as text, as described by WithTextFields.
+func appendTextValue(b []byte, v any) []byte {
+	j := appendJSONValue(nil, v)
+	s := string(j)
+	if len(j) > 0 && j[0] == '"' {
+		_ = json.Unmarshal(j, &s) // the encoder always writes valid JSON strings
+	}
+	if needsTextQuote(s) {
+		return strconv.AppendQuote(b, s)
+	}
+	return append(b, s...)
+}
+
+// needsTextQuote reports whether s must be quoted to be written as a text value.
+func needsTextQuote(s string) bool {
+	return s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r == ' ' || r == '"' || r == '=' || r == '\\' || r == unicode.ReplacementChar || !unicode.IsPrint(r)
+	}) >= 0
+}
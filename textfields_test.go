@@ -0,0 +1,95 @@
+package gcplog
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestWithTextFields(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"plain", "ok", `v=ok`},
+		{"int", 42, `v=42`},
+		{"float", 1.5, `v=1.5`},
+		{"bool", true, `v=true`},
+		{"nil", nil, `v=null`},
+		{"space", "two words", `v=\"two words\"`},
+		{"quote", `say "hi"`, `v=\"say \\\"hi\\\"\"`},
+		{"equals", "a=b", `v=\"a=b\"`},
+		{"backslash", `C:\tmp`, `v=\"C:\\\\tmp\"`},
+		{"empty", "", `v=\"\"`},
+		{"newline", "a\nb", `v=\"a\\nb\"`},
+		{"unicode", "héllo", `v=héllo`},
+		{"html", "<b>", `v=\u003cb\u003e`},
+		{"error", errors.New("disk full"), `v=\"disk full\"`},
+		{"slice", []int{1, 2}, `v=[1,2]`},
+		{"map", map[string]int{"a": 1}, `v=\"{\\\"a\\\":1}\"`},
+		{"typed", Int64("v", 7), `v=7`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO).WithTextFields()
+			logger.out = &buf
+			logger.Printw("m", "v", tt.v)
+			var v bytes.Buffer
+			v.WriteString(`,"v":`)
+			v.Write(appendJSONValue(nil, tt.v))
+			want := `{"severity":"INFO","message":"m ` + tt.want + `"` + v.String() + "}\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got  %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestWithTextFieldsModes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(WARNING).With("zone", "eu", "attempt", 2).WithGroup("http").With("status", 503)
+	logger.out = &buf
+	text := logger.WithTextFields()
+	text.Print("retrying")
+	text.PrefixPrint("retrying")
+	text.Printw("", "severity", "high")
+	logger.WithTextFields(TextFieldsOnly).Print("only")
+	bare := New(INFO).WithTextFields(TextFieldsOnly)
+	bare.out = &buf
+	bare.Print("no fields")
+	logger.WithTextFields(TextFieldsOff).Print("off")
+	logger.WithTextFields(TextFieldsOnly, TextFieldsAppend).WithGroup("").With("a b=c", 1).Print("last mode")
+	want := `{"severity":"WARNING","message":"retrying attempt=2 http.status=503 zone=eu","attempt":2,"http":{"status":503},"zone":"eu"}` + "\n" +
+		`{"severity":"WARNING","message":"WARNING: retrying attempt=2 http.status=503 zone=eu","attempt":2,"http":{"status":503},"zone":"eu"}` + "\n" +
+		`{"severity":"WARNING","message":"attempt=2 http.severity=high http.status=503 zone=eu","attempt":2,"http":{"severity":"high","status":503},"zone":"eu"}` + "\n" +
+		`{"severity":"WARNING","message":"only attempt=2 http.status=503 zone=eu"}` + "\n" +
+		`{"severity":"INFO","message":"no fields"}` + "\n" +
+		`{"severity":"WARNING","message":"off","attempt":2,"http":{"status":503},"zone":"eu"}` + "\n" +
+		`{"severity":"WARNING","message":"last mode attempt=2 http.a_b_c=1 http.status=503 zone=eu","attempt":2,"http":{"a b=c":1,"status":503},"zone":"eu"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithTextFieldsReserved(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithTextFields()
+	logger.out = &buf
+	logger.Printw("m", "message", "x", "logger", "y")
+	logger.SetMaxMessageBytes(12)
+	logger.SetMessageTransform(func(s string) string { return "[t] " + s })
+	logger.Printw("m", "k", "v")
+	if got := string(logger.AppendEntry(nil, INFO, "m")); got != `{"severity":"INFO","message":"[t] m"}` {
+		t.Errorf("AppendEntry() = %s", got)
+	}
+	if got := string(logger.With("k", "v").AppendEntry(nil, INFO, "m")); got != `{"severity":"INFO","message":"[t] m k=v","k":"v"}` {
+		t.Errorf("AppendEntry() = %s", got)
+	}
+	want := `{"severity":"INFO","message":"m field_logger=y field_message=x","field_logger":"y","field_message":"x"}` + "\n" +
+		`{"severity":"INFO","message":"[t] m k=v","k":"v"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
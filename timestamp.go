@@ -0,0 +1,42 @@
+package gcplog
+
+import (
+	"strconv"
+	"time"
+)
+
+// TimestampFormat controls how WithTimestamps records the time of each log entry. Both formats are understood by Cloud Logging.
+type TimestampFormat int
+
+const (
+	TimestampRFC3339 TimestampFormat = iota // A "time" field holding an RFC 3339 string with nanoseconds, like "2024-02-29T13:14:15.5Z"
+	TimestampObject                         // A "timestamp" field holding an object, like {"seconds":1709212455,"nanos":500000000}
+)
+
+// WithTimestamps returns a new Logger which adds the time each entry is written to it, in the provided format, or TimestampRFC3339
+// if none is provided. Without a timestamp, Cloud Logging uses the time it receives the entry, which can be much later for
+// buffered or replayed entries. The time is taken when Print, or one of the other methods, is called, so buffering doesn't change it.
+// The original Logger is not changed.
+func (l *Logger) WithTimestamps(format ...TimestampFormat) *Logger {
+	c := l.clone()
+	c.timestamps = true
+	c.timeFormat = TimestampRFC3339
+	if len(format) > 0 {
+		c.timeFormat = format[0]
+	}
+	return c
+}
+
+// appendJSON appends t to b as a JSON object member, in the format f.
+func (f TimestampFormat) appendJSON(b []byte, t time.Time) []byte {
+	if f == TimestampObject {
+		b = append(b, `,"timestamp":{"seconds":`...)
+		b = strconv.AppendInt(b, t.Unix(), 10)
+		b = append(b, `,"nanos":`...)
+		b = strconv.AppendInt(b, int64(t.Nanosecond()), 10)
+		return append(b, '}')
+	}
+	b = append(b, `,"time":"`...)
+	b = t.UTC().AppendFormat(b, time.RFC3339Nano)
+	return append(b, '"')
+}
@@ -0,0 +1,84 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWithTimestamps(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithTimestamps()
+	logger.out = &buf
+	before := time.Now()
+	logger.Print("Hello World")
+	after := time.Now()
+	var e struct {
+		Severity, Message string
+		Time              time.Time
+	}
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if e.Time.Before(before) || e.Time.After(after) {
+		t.Errorf("time %v isn't between %v and %v", e.Time, before, after)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte(`{"severity":"INFO","message":"Hello World","time":"`)) {
+		t.Errorf("time isn't after the message: %s", buf.String())
+	}
+}
+
+func TestWithTimestampsObject(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithTimestamps(TimestampObject)
+	logger.out = &buf
+	before := time.Now()
+	logger.Print("Hello World")
+	after := time.Now()
+	var e struct {
+		Timestamp struct {
+			Seconds int64
+			Nanos   int64
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	got := time.Unix(e.Timestamp.Seconds, e.Timestamp.Nanos)
+	if got.Before(before) || got.After(after) || e.Timestamp.Nanos >= 1e9 {
+		t.Errorf("timestamp %v isn't between %v and %v", got, before, after)
+	}
+}
+
+func TestWithTimestampsBuffered(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO).WithTimestamps()
+	logger.out = &buf
+	logger.SetBuffered(1<<20, ERROR)
+	logger.Print("buffered")
+	written := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	if err := logger.Flush(); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	var e struct{ Time time.Time }
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if e.Time.After(written) {
+		t.Errorf("time %v is from the flush, not the Print call at %v", e.Time, written)
+	}
+}
+
+func TestWithTimestampsOff(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.WithTimestamps().With("when", "child").Print("")
+	buf.Reset()
+	logger.Print("Hello World")
+	if got, want := buf.String(), `{"severity":"INFO","message":"Hello World"}`+"\n"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
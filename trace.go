@@ -0,0 +1,103 @@
+package gcplog
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	traceKey        = "logging.googleapis.com/trace"         // the key Cloud Logging uses for the trace resource name of a log entry
+	spanIDKey       = "logging.googleapis.com/spanId"        // the key Cloud Logging uses for the span ID of a log entry
+	traceSampledKey = "logging.googleapis.com/trace_sampled" // the key Cloud Logging uses for whether the trace of a log entry was sampled
+)
+
+// traceContext holds the Cloud Trace span that log entries belong to.
+type traceContext struct {
+	trace      string // the trace resource name, like "projects/my-project/traces/abc123", or "" when there's no trace
+	spanID     string
+	sampled    bool
+	sampledSet bool // whether sampled was set by WithTraceSampled, rather than defaulting to true
+}
+
+// WithTrace returns a new Logger which links every log entry to the provided Cloud Trace trace, so the entries are shown with the trace
+// in the Google Cloud console. The trace is written as "projects/<projectID>/traces/<traceID>", or as traceID alone if it already
+// starts with "projects/" or projectID is empty. An empty traceID removes the trace. The original Logger is not changed.
+//
+// Entries with a trace are marked as sampled, as the console only links entries to traces which were sampled.
+// Use WithTraceSampled to set the sampling decision explicitly, which always takes precedence over the default.
+func (l *Logger) WithTrace(projectID, traceID string) *Logger {
+	c := l.clone()
+	c.trace = c.trace.with(projectID, traceID)
+	return c
+}
+
+// with returns t linked to the provided trace, as WithTrace describes.
+func (t traceContext) with(projectID, traceID string) traceContext {
+	switch {
+	case traceID == "":
+		return traceContext{}
+	case projectID == "" || strings.HasPrefix(traceID, "projects/"):
+		t.trace = traceID
+	default:
+		t.trace = "projects/" + projectID + "/traces/" + traceID
+	}
+	return t
+}
+
+// SetProjectID sets the Google Cloud project ID that WithTraceID uses to build trace resource names, so it doesn't need to be
+// passed with every trace. It's typically set once, when the program starts, for example from the GOOGLE_CLOUD_PROJECT environment variable,
+// or with gcpmeta.DetectProjectID.
+// Loggers created from this one after SetProjectID is called use the same project ID.
+func (l *Logger) SetProjectID(id string) {
+	l.mu.Lock()
+	l.projectID = id
+	l.mu.Unlock()
+}
+
+// ProjectID returns the project ID set by SetProjectID, or "" if there isn't one.
+func (l *Logger) ProjectID() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.projectID
+}
+
+// WithTraceID returns a new Logger which links every log entry to the provided Cloud Trace trace, in the project set by SetProjectID.
+// It's the same as WithTrace with that project ID, so if no project ID is set, then traceID must be the full trace resource name,
+// like "projects/my-project/traces/abc123". The original Logger is not changed.
+func (l *Logger) WithTraceID(traceID string) *Logger {
+	l.mu.RLock()
+	projectID := l.projectID
+	l.mu.RUnlock()
+	return l.WithTrace(projectID, traceID)
+}
+
+// WithSpanID returns a new Logger which adds the provided span ID, within the trace set by WithTrace, to every log entry.
+// The span ID is only written when there is a trace. An empty span ID removes it. The original Logger is not changed.
+func (l *Logger) WithSpanID(spanID string) *Logger {
+	c := l.clone()
+	c.trace.spanID = spanID
+	return c
+}
+
+// WithTraceSampled returns a new Logger which marks the trace of every log entry as sampled, or not, replacing the default of true.
+// It's only written when there is a trace. The original Logger is not changed.
+func (l *Logger) WithTraceSampled(sampled bool) *Logger {
+	c := l.clone()
+	c.trace.sampled, c.trace.sampledSet = sampled, true
+	return c
+}
+
+// appendJSON appends the trace, span ID and sampling decision to b as JSON object members with the provided keys, if there is a trace.
+func (t traceContext) appendJSON(b []byte, traceKey, spanIDKey, sampledKey string) []byte {
+	if t.trace == "" {
+		return b
+	}
+	b = appendMemberKey(b, traceKey)
+	b = appendJSONString(b, t.trace)
+	if t.spanID != "" {
+		b = appendMemberKey(b, spanIDKey)
+		b = appendJSONString(b, t.spanID)
+	}
+	b = appendMemberKey(b, sampledKey)
+	return strconv.AppendBool(b, t.sampled || !t.sampledSet)
+}
@@ -0,0 +1,72 @@
+package gcplog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func ExampleLogger_WithTrace() {
+	logger := New(INFO).WithTrace("my-project", "4bf92f3577b34da6a3ce929d0e0e4736").WithSpanID("00f067aa0ba902b7")
+	logger.Print("Hello World")
+	// Output:
+	// {"severity":"INFO","message":"Hello World","logging.googleapis.com/trace":"projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736","logging.googleapis.com/spanId":"00f067aa0ba902b7","logging.googleapis.com/trace_sampled":true}
+}
+
+func TestWithTrace(t *testing.T) {
+	tests := []struct {
+		name   string
+		logger func(l *Logger) *Logger
+		want   string
+	}{
+		{"none", func(l *Logger) *Logger { return l }, ``},
+		{"default sampled", func(l *Logger) *Logger { return l.WithTrace("p", "abc") },
+			`,"logging.googleapis.com/trace":"projects/p/traces/abc","logging.googleapis.com/trace_sampled":true`},
+		{"not sampled", func(l *Logger) *Logger { return l.WithTrace("p", "abc").WithTraceSampled(false) },
+			`,"logging.googleapis.com/trace":"projects/p/traces/abc","logging.googleapis.com/trace_sampled":false`},
+		{"not sampled before trace", func(l *Logger) *Logger { return l.WithTraceSampled(false).WithTrace("p", "abc") },
+			`,"logging.googleapis.com/trace":"projects/p/traces/abc","logging.googleapis.com/trace_sampled":false`},
+		{"explicitly sampled", func(l *Logger) *Logger { return l.WithTraceSampled(true).WithTrace("p", "abc") },
+			`,"logging.googleapis.com/trace":"projects/p/traces/abc","logging.googleapis.com/trace_sampled":true`},
+		{"sampled without trace", func(l *Logger) *Logger { return l.WithTraceSampled(true).WithSpanID("s1") }, ``},
+		{"full resource name", func(l *Logger) *Logger { return l.WithTrace("p", "projects/q/traces/abc") },
+			`,"logging.googleapis.com/trace":"projects/q/traces/abc","logging.googleapis.com/trace_sampled":true`},
+		{"no project", func(l *Logger) *Logger { return l.WithTrace("", "abc").WithSpanID("s1") },
+			`,"logging.googleapis.com/trace":"abc","logging.googleapis.com/spanId":"s1","logging.googleapis.com/trace_sampled":true`},
+		{"removed", func(l *Logger) *Logger { return l.WithTrace("p", "abc").WithSpanID("s1").WithTrace("p", "") }, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO)
+			logger.out = &buf
+			tt.logger(logger).Print("Hello World")
+			want := `{"severity":"INFO","message":"Hello World"` + tt.want + "}\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestWithTraceID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.WithTraceID("projects/q/traces/abc").Print("no project")
+	logger.SetProjectID("my-project")
+	child := logger.With("a", 1)
+	logger.SetProjectID("changed")
+	child.WithTraceID("abc").Print("child")
+	logger.WithTraceID("def").WithSpanID("s1").Print("parent")
+	logger.WithTraceID("projects/q/traces/abc").Print("full resource name")
+	want := `{"severity":"INFO","message":"no project","logging.googleapis.com/trace":"projects/q/traces/abc","logging.googleapis.com/trace_sampled":true}` + "\n" +
+		`{"severity":"INFO","message":"child","a":1,"logging.googleapis.com/trace":"projects/my-project/traces/abc","logging.googleapis.com/trace_sampled":true}` + "\n" +
+		`{"severity":"INFO","message":"parent","logging.googleapis.com/trace":"projects/changed/traces/def","logging.googleapis.com/spanId":"s1","logging.googleapis.com/trace_sampled":true}` + "\n" +
+		`{"severity":"INFO","message":"full resource name","logging.googleapis.com/trace":"projects/q/traces/abc","logging.googleapis.com/trace_sampled":true}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if logger.ProjectID() != "changed" || child.ProjectID() != "my-project" || New(INFO).ProjectID() != "" {
+		t.Errorf("ProjectID() = %q, child %q, want the project IDs that were set", logger.ProjectID(), child.ProjectID())
+	}
+}
@@ -0,0 +1,222 @@
+package gcplog
+
+import (
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// fieldKind is the type of value held by a Field.
+type fieldKind uint8
+
+const (
+	anyKind fieldKind = iota
+	stringKind
+	intKind
+	floatKind
+	boolKind
+	timeKind
+	durationKind
+	errorKind
+)
+
+// Field is a strongly typed structured field, created by functions like String and Int.
+// Fields can be passed to With and Printw in place of a key/value pair, or to PrintFields, for example:
+//
+//	logger.With(gcplog.String("user", u), gcplog.Int("attempt", n)).Print("signed in")
+//
+// Each type is encoded without reflection.
+type Field struct {
+	Key  string
+	kind fieldKind
+	num  int64  // the value of int, bool and duration fields, and the bits of float fields
+	str  string // the value of string fields
+	val  any    // the value of time, error and any fields
+}
+
+// String returns a Field with the provided key and string value.
+func String(key, value string) Field {
+	return Field{Key: key, kind: stringKind, str: value}
+}
+
+// Int returns a Field with the provided key and int value.
+func Int(key string, value int) Field {
+	return Field{Key: key, kind: intKind, num: int64(value)}
+}
+
+// Int64 returns a Field with the provided key and int64 value.
+func Int64(key string, value int64) Field {
+	return Field{Key: key, kind: intKind, num: value}
+}
+
+// Float64 returns a Field with the provided key and float64 value.
+// NaN and infinite values, which JSON can't represent, are written as strings.
+func Float64(key string, value float64) Field {
+	return Field{Key: key, kind: floatKind, num: int64(math.Float64bits(value))}
+}
+
+// Bool returns a Field with the provided key and bool value.
+func Bool(key string, value bool) Field {
+	f := Field{Key: key, kind: boolKind}
+	if value {
+		f.num = 1
+	}
+	return f
+}
+
+// Time returns a Field with the provided key and time value, which is written in RFC 3339 format with nanoseconds.
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, kind: timeKind, val: value}
+}
+
+// Duration returns a Field with the provided key and duration value, which is written with its String method, like "1m30s".
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, kind: durationKind, num: int64(value)}
+}
+
+// Err returns a Field with the key "error" and the message of the provided error. A nil error is written as null.
+func Err(err error) Field {
+	return Field{Key: "error", kind: errorKind, val: err}
+}
+
+// Any returns a Field with the provided key and value, which is encoded in the same way as values passed to With.
+func Any(key string, value any) Field {
+	return Field{Key: key, kind: anyKind, val: value}
+}
+
+// PrintFields writes a log message with the severity of the Logger, adding the provided fields to this entry only.
+// The fields replace any fields of the Logger with the same key. Unless settings like WithFieldEncoder or WithMasking change
+// field values, they're encoded straight from the Field values, so PrintFields allocates less than Printw.
+func (l *Logger) PrintFields(msg string, fields ...Field) {
+	l.output(record{message: msg, typed: fields})
+}
+
+// typedFields converts fields into a map of fields, keyed by their keys.
+func typedFields(fields []Field) map[string]any {
+	if len(fields) == 0 {
+		return nil
+	}
+	m := make(map[string]any, len(fields))
+	for _, f := range fields {
+		m[f.Key] = f
+	}
+	return m
+}
+
+// value returns the value of the Field as its usual Go type.
+func (f Field) value() any {
+	switch f.kind {
+	case stringKind:
+		return f.str
+	case intKind:
+		return f.num
+	case floatKind:
+		return math.Float64frombits(uint64(f.num))
+	case boolKind:
+		return f.num == 1
+	case durationKind:
+		return time.Duration(f.num)
+	}
+	return f.val
+}
+
+// appendJSON appends the JSON encoding of the value of the Field to b.
+func (f Field) appendJSON(b []byte) []byte {
+	switch f.kind {
+	case stringKind:
+		return appendJSONString(b, f.str)
+	case intKind:
+		return strconv.AppendInt(b, f.num, 10)
+	case floatKind:
+		return appendJSONFloat(b, math.Float64frombits(uint64(f.num)))
+	case boolKind:
+		return strconv.AppendBool(b, f.num == 1)
+	case durationKind:
+		return appendJSONString(b, time.Duration(f.num).String())
+	case timeKind:
+		if t, ok := f.val.(time.Time); ok && t.Year() >= 0 && t.Year() <= 9999 {
+			b = append(b, '"')
+			b = t.AppendFormat(b, time.RFC3339Nano)
+			return append(b, '"')
+		}
+	case errorKind:
+		if f.val == nil {
+			return append(b, "null"...)
+		}
+	}
+	return appendJSONValue(b, f.val)
+}
+
+// appendJSONFloat appends f to b in the same format as json.Marshal, or as a string if it's NaN or infinite.
+func appendJSONFloat(b []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return appendJSONString(b, strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	start := len(b)
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// Remove the leading zero of a two digit exponent, so 1e-07 is written as 1e-7, like json.Marshal.
+		if n := len(b) - start; n >= 4 && b[len(b)-4] == 'e' && b[len(b)-3] == '-' && b[len(b)-2] == '0' {
+			b[len(b)-2] = b[len(b)-1]
+			b = b[:len(b)-1]
+		}
+	}
+	return b
+}
+
+// hexDigits is used by appendJSONString to write \u escapes.
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s to b as a JSON string, escaped in the same way as json.Marshal,
+// including the HTML characters <, > and &, so the output is identical.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
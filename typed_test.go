@@ -0,0 +1,152 @@
+package gcplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleLogger_PrintFields() {
+	logger := New(INFO)
+	logger.PrintFields("signed in", String("user", "ann"), Int("attempt", 2), Bool("mfa", true))
+	// Output:
+	// {"severity":"INFO","message":"signed in","attempt":2,"mfa":true,"user":"ann"}
+}
+
+func TestTypedFields(t *testing.T) {
+	when := time.Date(2024, 2, 29, 13, 14, 15, 500, time.UTC)
+	tests := []struct {
+		name  string
+		field Field
+		want  string
+	}{
+		{"String", String("k", `a "quoted" <tag> & line\n`), `"k":"a \"quoted\" \u003ctag\u003e \u0026 line\\n"`},
+		{"Int", Int("k", -7), `"k":-7`},
+		{"Int64", Int64("k", math.MaxInt64), `"k":9223372036854775807`},
+		{"Float64", Float64("k", 1.25), `"k":1.25`},
+		{"Float64 small", Float64("k", 1e-7), `"k":1e-7`},
+		{"Float64 large", Float64("k", 1e21), `"k":1e+21`},
+		{"Float64 NaN", Float64("k", math.NaN()), `"k":"NaN"`},
+		{"Float64 Inf", Float64("k", math.Inf(-1)), `"k":"-Inf"`},
+		{"Bool true", Bool("k", true), `"k":true`},
+		{"Bool false", Bool("k", false), `"k":false`},
+		{"Time", Time("k", when), `"k":"2024-02-29T13:14:15.0000005Z"`},
+		{"Duration", Duration("k", 90*time.Second), `"k":"1m30s"`},
+		{"Err", Err(errors.New("it broke")), `"error":"it broke"`},
+		{"Err nil", Err(nil), `"error":null`},
+		{"Any map", Any("k", map[string]int{"a": 1}), `"k":{"a":1}`},
+		{"Any nil", Any("k", nil), `"k":null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := New(INFO)
+			logger.out = &buf
+			logger.PrintFields("Hello World", tt.field)
+			want := `{"severity":"INFO","message":"Hello World",` + tt.want + "}\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if !json.Valid(buf.Bytes()) {
+				t.Errorf("invalid JSON: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestTypedFieldsMatchJSON(t *testing.T) {
+	floats := []float64{0, -0.5, 1, 123456789, 1e20, 1e21, 1e-6, 1e-7, 3.14159e-300, math.MaxFloat64, math.SmallestNonzeroFloat64}
+	for _, f := range floats {
+		j, _ := json.Marshal(f)
+		if got := string(appendJSONFloat(nil, f)); got != string(j) {
+			t.Errorf("appendJSONFloat(%v) = %s, want %s", f, got, j)
+		}
+	}
+	strs := []string{"", "plain", "tab\tnew\nline\r", "\x00\x1f\x7f", `back\slash "quote"`, "<>&", "  ", "héllo 世界 😀", "bad \xff\xfe utf8", "\xe2\x82"}
+	for _, s := range strs {
+		j, _ := json.Marshal(s)
+		if got := string(appendJSONString(nil, s)); got != string(j) {
+			t.Errorf("appendJSONString(%q) = %s, want %s", s, got, j)
+		}
+	}
+}
+
+func TestTypedFieldsWith(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(INFO)
+	logger.out = &buf
+	logger.With(String("user", "ann"), "plain", 1, Int("n", 2), "trailing").Printw("w", Bool("ok", true), "x", 3)
+	logger.WithDurationEncoding(DurationMillis).PrintFields("encoded", Duration("took", time.Second))
+	logger.PrintFields("empty")
+	want := `{"severity":"INFO","message":"w","n":2,"ok":true,"plain":1,"trailing":"(MISSING)","user":"ann","x":3}` + "\n" +
+		`{"severity":"INFO","message":"encoded","took":1000}` + "\n" +
+		`{"severity":"INFO","message":"empty"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrintFieldsMerge(t *testing.T) {
+	var buf bytes.Buffer
+	var reported []error
+	logger := New(INFO).With("user", "bob", "region", "eu")
+	logger.out = &buf
+	logger.SetErrorHandler(func(err error) { reported = append(reported, err) })
+	logger.PrintFields("merged", String("user", "ann"), Int("n", 1), Int("n", 2), String("message", "clash"))
+	logger.WithMasking(regexp.MustCompile("secret")).PrintFields("masked", String("token", "secret"))
+	want := `{"severity":"INFO","message":"merged","field_message":"clash","n":2,"region":"eu","user":"ann"}` + "\n" +
+		`{"severity":"INFO","message":"masked","region":"eu","token":"***","user":"bob"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrReservedKey) {
+		t.Errorf("reported %v, want the reserved key", reported)
+	}
+}
+
+func TestPrintFieldsAllocs(t *testing.T) {
+	logger := New(INFO)
+	logger.out = io.Discard
+	typed := testing.AllocsPerRun(100, func() {
+		logger.PrintFields("Hello World", String("user", "ann"), Int("attempt", 12345), Float64("ratio", 0.5), Bool("ok", true))
+	})
+	pairs := testing.AllocsPerRun(100, func() {
+		logger.Printw("Hello World", "user", "ann", "attempt", 12345, "ratio", 0.5, "ok", true)
+	})
+	if typed > pairs {
+		t.Errorf("PrintFields allocated %v times, more than the %v of Printw", typed, pairs)
+	}
+}
+
+func BenchmarkPrintw(b *testing.B) {
+	logger := New(INFO)
+	logger.out = io.Discard
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Printw("Hello World", "user", "ann", "attempt", 12345, "ratio", 0.5, "ok", true)
+	}
+}
+
+func BenchmarkPrintFields(b *testing.B) {
+	logger := New(INFO)
+	logger.out = io.Discard
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.PrintFields("Hello World", String("user", "ann"), Int("attempt", 12345), Float64("ratio", 0.5), Bool("ok", true))
+	}
+}
+
+func BenchmarkAppendJSONString(b *testing.B) {
+	s := strings.Repeat("Hello <World> ", 10)
+	buf := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = appendJSONString(buf[:0], s)
+	}
+}